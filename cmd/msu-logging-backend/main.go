@@ -24,6 +24,8 @@ func main() {
 	go application.RMQSrv.MustRun()
 	go application.MinioSrv.MustRun()
 	go application.HTTPSrv.MustRun()
+	go application.Webhooks.Run()
+	go application.Leases.Run()
 
 	//shutdown
 
@@ -35,6 +37,8 @@ func main() {
 	application.GRPCSrv.Stop()
 	application.WSSrv.Stop()
 	application.RMQSrv.Stop()
+	application.Webhooks.Stop()
+	application.Leases.Stop()
 	log.Info("Application stopped")
 }
 
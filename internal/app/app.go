@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"log/slog"
 	grpcapp "msu-logging-backend/internal/app/grpc"
 	httpapp "msu-logging-backend/internal/app/http"
@@ -8,8 +9,19 @@ import (
 	rmqapp "msu-logging-backend/internal/app/rmq"
 	wsapp "msu-logging-backend/internal/app/websocket"
 	"msu-logging-backend/internal/config"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/lib/export"
 	"msu-logging-backend/internal/services/audioservice"
+	"msu-logging-backend/internal/services/leaseservice"
+	"msu-logging-backend/internal/services/protocolservice"
+	"msu-logging-backend/internal/services/recordings"
+	"msu-logging-backend/internal/services/search"
+	"msu-logging-backend/internal/services/taskevents"
+	"msu-logging-backend/internal/services/uploads"
+	"msu-logging-backend/internal/services/webhooks"
 	"msu-logging-backend/internal/storage/mysql"
+	"net/http"
+	"time"
 )
 
 type App struct {
@@ -18,6 +30,8 @@ type App struct {
 	RMQSrv   *rmqapp.App
 	MinioSrv *minioapp.App
 	HTTPSrv  *httpapp.App
+	Webhooks *webhooks.Service
+	Leases   *leaseservice.LeaseService
 }
 
 func New(
@@ -29,15 +43,84 @@ func New(
 		panic(err)
 	}
 
+	// объекты строк, записанных до миграции 8, берутся из presigned-ссылок
+	if filled, err := storage.BackfillObjectKeys(context.Background()); err != nil {
+		log.Error("Failed to backfill object keys", slog.String("error", err.Error()))
+	} else if filled > 0 {
+		log.Info("Object keys backfilled", slog.Int("objects", filled))
+	}
+
+	// протоколы задач, сохранённые до ревизий, становятся ревизией 1
+	if seeded, err := storage.SeedLegacyRevisions(context.Background()); err != nil {
+		log.Error("Failed to seed legacy protocol revisions", slog.String("error", err.Error()))
+	} else if seeded > 0 {
+		log.Info("Legacy protocol revisions seeded", slog.Int("revisions", seeded))
+	}
+
 	app := &App{}
 
 	app.MinioSrv = minioapp.New(log)
 	app.RMQSrv = rmqapp.New(log, cfg)
 
-	audio_service := audioservice.New(log, storage, storage, app.RMQSrv, app.MinioSrv, cfg.MessageBroker.TranscribeQueue, cfg.MessageBroker.ProcessQueue)
-	app.GRPCSrv = grpcapp.New(log, cfg.GRPC.Port, audio_service)
-	app.WSSrv = wsapp.New(log, cfg.Websocket.Port, audio_service, storage, cfg.Websocket.CertFile, cfg.Websocket.KeyFile)
-	app.HTTPSrv = httpapp.New(log, cfg.HTTP.Address, storage, cfg, audio_service, app.MinioSrv)
+	events := taskevents.New()
+	recordingManager := recordings.New(recordings.Limits{
+		MaxSessions: cfg.Websocket.MaxSessions,
+		MaxSources:  cfg.Websocket.MaxSources,
+		MaxDuration: cfg.Websocket.MaxRecordingDuration,
+		MaxBytes:    cfg.Websocket.MaxRecordingBytes,
+	})
+
+	var vad *audio.VAD
+	if cfg.VAD.Enabled {
+		vad = &audio.VAD{
+			Threshold:       cfg.VAD.Threshold,
+			FrameDuration:   cfg.VAD.FrameDuration,
+			Padding:         cfg.VAD.Padding,
+			AutoStopSilence: cfg.VAD.AutoStopSilence,
+		}
+	}
+
+	search_service := search.New(log, storage, storage, app.MinioSrv)
+	protocol_service := protocolservice.New(log, app.MinioSrv, storage, search_service)
+	app.Webhooks = webhooks.New(log, storage, cfg.Webhooks.MaxAttempts, cfg.Webhooks.Backoff, cfg.Webhooks.MaxBackoff, cfg.Webhooks.Timeout, cfg.Webhooks.PollInterval)
+	audio_service := audioservice.New(log, storage, events, app.RMQSrv, app.MinioSrv, protocol_service, app.Webhooks, search_service, audioservice.Config{
+		TranscribeQueue: cfg.MessageBroker.TranscribeQueue,
+		ProtocolQueue:   cfg.MessageBroker.ProcessQueue,
+		Dispatch:        cfg.Workers.Dispatch,
+		Storage:         cfg.Upload.Storage,
+		PartSize:        cfg.Upload.PartSize,
+		TempDir:         cfg.Upload.TempDir,
+		VAD:             vad,
+	})
+	// в RabbitMQ из пула уходят только задачи, которые не взял ни один pull-воркер
+	var pushFallback time.Duration
+	if cfg.Workers.Dispatch == audioservice.DispatchBoth {
+		pushFallback = cfg.Workers.PushFallback
+	}
+	app.Leases = leaseservice.New(log, storage, audio_service, cfg.Workers.LeaseTimeout, cfg.Workers.MaxLeaseWait, cfg.Workers.PollInterval, pushFallback, cfg.Workers.MaxAttempts)
+	app.GRPCSrv = grpcapp.New(log, cfg.GRPC.Port, audio_service, app.Leases)
+	app.WSSrv = wsapp.New(log, cfg.Websocket, audio_service, storage, storage, storage, events, recordingManager, vad)
+	var wsHandler http.Handler
+	if cfg.Websocket.Mount == wsapp.MountHTTP {
+		wsHandler = app.WSSrv.Handler()
+	}
+
+	resumableDir := cfg.Upload.ResumableDir
+	if resumableDir == "" {
+		resumableDir = cfg.Upload.TempDir
+	}
+	uploadLimits := audio.Limits{
+		AllowedTypes: cfg.Upload.AllowedTypes,
+		MaxSize:      cfg.Upload.MaxSize,
+		MaxDuration:  cfg.Upload.MaxDuration,
+	}
+	upload_service := uploads.New(log, storage, audio_service, resumableDir, uploadLimits, cfg.Upload.ResumableExpiry)
+
+	exporter, err := export.New(cfg.Export.TemplatesDir, cfg.Export.PDFFont)
+	if err != nil {
+		panic(err)
+	}
+	app.HTTPSrv = httpapp.New(log, cfg.HTTP.Address, storage, cfg, audio_service, app.MinioSrv, recordingManager, wsHandler, exporter, protocol_service, upload_service, uploadLimits, events, app.Webhooks, search_service)
 
 	return app
 }
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log/slog"
 	transcribeserver "msu-logging-backend/internal/grpc/transcribe-server"
+	workerserver "msu-logging-backend/internal/grpc/worker-server"
 	"msu-logging-backend/internal/services/audioservice"
+	"msu-logging-backend/internal/services/leaseservice"
 	"net"
 
 	"google.golang.org/grpc"
@@ -20,9 +22,11 @@ func New(
 	log *slog.Logger,
 	port int,
 	audioService *audioservice.AudioService,
+	leaseService *leaseservice.LeaseService,
 ) *App {
 	gRPCServer := grpc.NewServer()
 	transcribeserver.Register(gRPCServer, audioService)
+	workerserver.Register(gRPCServer, log, leaseService, audioService)
 
 	return &App{
 		log:        log,
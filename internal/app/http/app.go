@@ -4,13 +4,29 @@ import (
 	"log/slog"
 	minioapp "msu-logging-backend/internal/app/minio"
 	"msu-logging-backend/internal/config"
+	"msu-logging-backend/internal/http-server/handlers/admin"
 	audiotask "msu-logging-backend/internal/http-server/handlers/audio-task"
 	"msu-logging-backend/internal/http-server/handlers/auth"
+	"msu-logging-backend/internal/http-server/handlers/download"
 	loadfile "msu-logging-backend/internal/http-server/handlers/load-file"
+	"msu-logging-backend/internal/http-server/handlers/revisions"
+	"msu-logging-backend/internal/http-server/handlers/tasks"
 	updateprotocol "msu-logging-backend/internal/http-server/handlers/update-protocol"
+	"msu-logging-backend/internal/http-server/handlers/uploads"
 	"msu-logging-backend/internal/http-server/handlers/valuation"
+	"msu-logging-backend/internal/http-server/handlers/webhooks"
 	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/http-server/openapi"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/lib/export"
 	"msu-logging-backend/internal/services/audioservice"
+	"msu-logging-backend/internal/services/protocolservice"
+	"msu-logging-backend/internal/services/recordings"
+	"msu-logging-backend/internal/services/search"
+	"msu-logging-backend/internal/services/taskevents"
+	uploadservice "msu-logging-backend/internal/services/uploads"
+	webhookservice "msu-logging-backend/internal/services/webhooks"
 	"msu-logging-backend/internal/storage/mysql"
 	"net/http"
 	"os"
@@ -33,32 +49,105 @@ func New(
 	config *config.Config,
 	audioService *audioservice.AudioService,
 	minioService *minioapp.App,
+	recordingManager *recordings.Manager,
+	wsHandler http.Handler,
+	exporter *export.Renderer,
+	protocolService *protocolservice.ProtocolService,
+	uploadService *uploadservice.Service,
+	uploadLimits audio.Limits,
+	events *taskevents.Broker,
+	webhookService *webhookservice.Service,
+	searchService *search.Service,
 ) *App {
 
 	router := chi.NewRouter()
+	if config.HTTP.TrustForwardedHeaders {
+		// раньше логгера, чтобы в логах был адрес клиента, а не прокси
+		router.Use(mymiddleware.Forwarded)
+	}
 	router.Use(cors.Handler(cors.Options{
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Range", "If-None-Match", "If-Match", "Last-Event-ID",
+			"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"},
+		ExposedHeaders: []string{"Link", "Content-Disposition", "Content-Range", "Accept-Ranges", "ETag", "X-Request-Id",
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length"},
 		AllowedOrigins:   []string{"http://localhost:3000"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 	router.Use(mymiddleware.EnableCORS)
 	router.Use(middleware.RequestID)
+	router.Use(mymiddleware.RequestIDHeader)
 	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
+	router.Use(mymiddleware.Recoverer(log))
 	router.Use(middleware.URLFormat)
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "route not found")
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		response.Fail(w, r, http.StatusMethodNotAllowed, response.CodeMethodNotAllowed, "method not allowed")
+	})
+
+	// URLFormat отрезает расширение, так что маршрут отвечает на /openapi.yaml
+	router.Get("/openapi", openapi.Handler)
 	router.Post("/valuation", valuation.NewRateHandler(log, storage))
 	router.Get("/token", auth.NewTokenHandler(log, storage, config.HTTP.TokenTTL))
 
 	router.Group(func(r chi.Router) {
 		r.Use(mymiddleware.JWTVerifier(log, os.Getenv("JWT_SECRET")))
-		r.Get("/taskstatus", audiotask.NewTaskStatusHandler(log, storage, storage))
-		r.Post("/loadaudio", loadfile.NewLoadFileHandler(log, audioService))
-		r.Post("/updateprotocol", updateprotocol.NewUpdateProtocolHandler(log, storage, minioService))
+		r.Get("/taskstatus", audiotask.NewTaskStatusHandler(log, storage, storage, storage, storage, storage))
+		r.Get("/taskstatus/events", audiotask.NewTaskEventsHandler(log, events, storage, storage, storage))
+		r.Post("/loadaudio", loadfile.NewLoadFileHandler(log, audioService, uploadLimits))
+		r.Post("/updateprotocol", updateprotocol.NewUpdateProtocolHandler(log, protocolService, config.HTTP.RequireRevision))
+		r.Route("/uploads", func(r chi.Router) {
+			r.Use(uploads.TusResumable(uploadService))
+			r.Post("/", uploads.NewCreateHandler(log, uploadService))
+			r.Head("/{uploadId}", uploads.NewHeadHandler(log, uploadService))
+			r.Patch("/{uploadId}", uploads.NewPatchHandler(log, uploadService))
+			r.Delete("/{uploadId}", uploads.NewDeleteHandler(log, uploadService))
+		})
+	})
+
+	if wsHandler != nil {
+		// токен /ws проверяет сам при апгрейде
+		router.Get("/ws", wsHandler.ServeHTTP)
+	}
+
+	router.Group(func(r chi.Router) {
+		r.Use(mymiddleware.TaskAccess(log, os.Getenv("ADMIN_TOKEN")))
+		r.Get("/tasks", tasks.NewListHandler(log, storage))
+		r.Get("/search", tasks.NewSearchHandler(log, searchService))
+		r.Route("/tasks/{id}", func(r chi.Router) {
+			r.Use(mymiddleware.TaskScope(log))
+			r.Get("/", tasks.NewGetHandler(log, storage, storage, storage, storage, storage))
+			r.Get("/audio", download.NewAudioHandler(log, storage, minioService))
+			r.Get("/transcript", download.NewTranscriptHandler(log, storage, minioService))
+			r.Get("/protocol", download.NewProtocolHandler(log, storage, minioService))
+			r.Get("/protocol/export", download.NewExportHandler(log, storage, storage, minioService, exporter))
+			r.Get("/protocol/revisions", revisions.NewListHandler(log, protocolService))
+			r.Get("/protocol/revisions/{rev}", revisions.NewGetHandler(log, protocolService))
+			r.Post("/protocol/revisions/{rev}/revert", revisions.NewRevertHandler(log, protocolService))
+			r.Get("/protocol/diff", revisions.NewDiffHandler(log, protocolService))
+			r.Route("/webhooks", webhookRoutes(log, webhookService))
+		})
 	})
 
+	router.Group(func(r chi.Router) {
+		r.Use(mymiddleware.AdminVerifier(log, os.Getenv("ADMIN_TOKEN")))
+		r.Get("/admin/recordings", admin.NewActiveRecordingsHandler(log, recordingManager))
+		// глобальные вебхуки, на события всех задач
+		r.Route("/admin/webhooks", webhookRoutes(log, webhookService))
+		r.Post("/admin/search/reindex", admin.NewReindexHandler(log, searchService))
+	})
+
+	undocumented, err := openapi.Undocumented(router)
+	if err != nil {
+		log.Error("Failed to walk routes", slog.String("error", err.Error()))
+	}
+	for _, route := range undocumented {
+		log.Warn("Route is missing from the OpenAPI document", slog.String("route", route))
+	}
+
 	HTTPServer := &http.Server{
 		Addr:    address,
 		Handler: router,
@@ -99,3 +188,16 @@ func (a *App) Stop() {
 	a.log.With(slog.String("op", op)).
 		Info("Stopping HTTP server")
 }
+
+// webhookRoutes mounts the same handlers for task webhooks and global ones,
+// the scope comes from TaskScope.
+func webhookRoutes(log *slog.Logger, service *webhookservice.Service) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/", webhooks.NewListHandler(log, service))
+		r.Post("/", webhooks.NewCreateHandler(log, service))
+		r.Get("/{webhookId}", webhooks.NewGetHandler(log, service))
+		r.Delete("/{webhookId}", webhooks.NewDeleteHandler(log, service))
+		r.Get("/{webhookId}/deliveries", webhooks.NewDeliveriesHandler(log, service))
+		r.Post("/{webhookId}/deliveries/{deliveryId}/redeliver", webhooks.NewRedeliverHandler(log, service))
+	}
+}
@@ -0,0 +1,512 @@
+package httpapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"msu-logging-backend/internal/config"
+	"msu-logging-backend/internal/http-server/openapi"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/services/recordings"
+	"msu-logging-backend/internal/services/taskevents"
+	uploadservice "msu-logging-backend/internal/services/uploads"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	testSecret     = "test-secret"
+	testAdminToken = "test-admin-token"
+)
+
+// newTestRouter builds the real router. Services that need MySQL, MinIO or
+// RabbitMQ are nil, so the tests only take paths that end before them.
+func newTestRouter(t *testing.T, adminToken string) http.Handler {
+	t.Helper()
+
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{HTTP: config.HTTPConfig{RequireRevision: true}}
+	uploadService := uploadservice.New(log, nil, nil, t.TempDir(), audio.Limits{MaxSize: 100}, time.Hour)
+	ws := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	app := New(log, "", nil, cfg, nil, nil, recordings.New(recordings.Limits{}), ws, nil, nil,
+		uploadService, audio.Limits{}, taskevents.New(), nil, nil)
+
+	return app.HTTPServer.Handler
+}
+
+func taskToken(t *testing.T, taskId int, secret string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"taskId": taskId}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// spec is the document the router serves.
+type spec map[string]any
+
+func loadSpec(t *testing.T, router http.Handler) spec {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.yaml: %d", w.Code)
+	}
+
+	// в именованный тип yaml.v3 декодирует и вложенные объекты
+	var doc map[string]any
+	if err := yaml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("openapi.yaml: %v", err)
+	}
+	return doc
+}
+
+// resolve follows $ref until it reaches a definition.
+func (s spec) resolve(node any) map[string]any {
+	m, _ := node.(map[string]any)
+	for m != nil {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			break
+		}
+		var target any = map[string]any(s)
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			next, _ := target.(map[string]any)
+			target = next[part]
+		}
+		m, _ = target.(map[string]any)
+	}
+	return m
+}
+
+func (s spec) operation(method, route string) map[string]any {
+	paths, _ := s["paths"].(map[string]any)
+	item, _ := paths[route].(map[string]any)
+	op, _ := item[strings.ToLower(method)].(map[string]any)
+	return op
+}
+
+// operations returns "method route" of every documented operation.
+func (s spec) operations() [][2]string {
+	var result [][2]string
+	paths, _ := s["paths"].(map[string]any)
+	for route, item := range paths {
+		for method := range item.(map[string]any) {
+			switch method {
+			case "get", "head", "post", "put", "patch", "delete":
+				result = append(result, [2]string{strings.ToUpper(method), route})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i][1]+result[i][0] < result[j][1]+result[j][0]
+	})
+	return result
+}
+
+// validate returns the mismatches between a decoded JSON value and the schema.
+func (s spec) validate(schema any, value any, at string) []string {
+	m := s.resolve(schema)
+	if m == nil {
+		return nil
+	}
+
+	var problems []string
+	if all, ok := m["allOf"].([]any); ok {
+		for _, part := range all {
+			problems = append(problems, s.validate(part, value, at)...)
+		}
+	}
+	if value == nil {
+		if nullable, _ := m["nullable"].(bool); !nullable && m["type"] != nil {
+			problems = append(problems, at+": null")
+		}
+		return problems
+	}
+
+	switch m["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: %T, want object", at, value))
+		}
+		required, _ := m["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: no required %q", at, name))
+			}
+		}
+		properties, _ := m["properties"].(map[string]any)
+		for name, property := range properties {
+			if v, ok := object[name]; ok {
+				problems = append(problems, s.validate(property, v, at+"."+name)...)
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: %T, want array", at, value))
+		}
+		for i, item := range items {
+			problems = append(problems, s.validate(m["items"], item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: %T, want string", at, value))
+		}
+		if m["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not date-time", at, str))
+			}
+		}
+		if enum, ok := m["enum"].([]any); ok {
+			found := false
+			for _, allowed := range enum {
+				found = found || fmt.Sprint(allowed) == str
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%s: %q is not in %v", at, str, enum))
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			problems = append(problems, fmt.Sprintf("%s: %v, want integer", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %T, want number", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %T, want boolean", at, value))
+		}
+	}
+
+	return problems
+}
+
+type routeCase struct {
+	name   string
+	method string
+	target string
+	// route - путь в документе, пусто для ответов роутера на неизвестные пути
+	route  string
+	header map[string]string
+	body   string
+	status int
+	code   string
+}
+
+// check sends the request and compares the response with the case and, for
+// documented routes, with the document.
+func check(t *testing.T, router http.Handler, doc spec, tc routeCase) {
+	t.Helper()
+
+	r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+	for name, value := range tc.header {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != tc.status {
+		t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body.String())
+	}
+
+	if tc.code != "" {
+		var body response.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("error body is not JSON: %v: %q", err, w.Body.String())
+		}
+		if body.Status != response.StatusError || body.Code != tc.code || body.Error == "" {
+			t.Errorf("body = %+v, want status %q, code %q and a message", body, response.StatusError, tc.code)
+		}
+		if body.RequestId == "" || body.RequestId != w.Header().Get("X-Request-Id") {
+			t.Errorf("request_id = %q, X-Request-Id = %q", body.RequestId, w.Header().Get("X-Request-Id"))
+		}
+	}
+
+	if tc.route == "" {
+		return
+	}
+	op := doc.operation(tc.method, tc.route)
+	if op == nil {
+		t.Fatalf("%s %s is not documented", tc.method, tc.route)
+	}
+	responses, _ := op["responses"].(map[string]any)
+	documented := doc.resolve(responses[strconv.Itoa(tc.status)])
+	if documented == nil {
+		t.Fatalf("%s %s: status %d is not documented", tc.method, tc.route, tc.status)
+	}
+	if tc.method == http.MethodHead {
+		return
+	}
+
+	content, _ := documented["content"].(map[string]any)
+	media, _ := content["application/json"].(map[string]any)
+	if media == nil {
+		if tc.code != "" {
+			t.Errorf("%s %s: status %d is documented without a JSON body", tc.method, tc.route, tc.status)
+		}
+		return
+	}
+	var value any
+	if err := json.Unmarshal(w.Body.Bytes(), &value); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	for _, problem := range doc.validate(media["schema"], value, "body") {
+		t.Error(problem)
+	}
+}
+
+var pathParams = strings.NewReplacer(
+	"{id}", "1",
+	"{rev}", "1",
+	"{uploadId}", "upload",
+	"{webhookId}", "1",
+	"{deliveryId}", "1",
+)
+
+// The document and the router must describe the same routes. A new route
+// without a description fails here.
+func TestRoutesMatchDocument(t *testing.T) {
+	routes := newTestRouter(t, testAdminToken).(chi.Routes)
+
+	undocumented, err := openapi.Undocumented(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range undocumented {
+		t.Errorf("%s is missing from openapi.yaml", route)
+	}
+
+	unrouted, err := openapi.Unrouted(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range unrouted {
+		t.Errorf("%s is documented but not routed", route)
+	}
+}
+
+// Every operation with security answers 401 without credentials, and
+// documents it.
+func TestUnauthenticated(t *testing.T) {
+	router := newTestRouter(t, testAdminToken)
+	doc := loadSpec(t, router)
+
+	for _, operation := range doc.operations() {
+		method, route := operation[0], operation[1]
+		if doc.operation(method, route)["security"] == nil {
+			continue
+		}
+		// /ws проверяет токен сам при апгрейде
+		if route == "/ws" {
+			continue
+		}
+
+		t.Run(method+" "+route, func(t *testing.T) {
+			check(t, router, doc, routeCase{
+				method: method,
+				target: pathParams.Replace(route),
+				route:  route,
+				header: map[string]string{"Tus-Resumable": "1.0.0"},
+				status: http.StatusUnauthorized,
+				code:   response.CodeUnauthorized,
+			})
+		})
+	}
+}
+
+// Without ADMIN_TOKEN the admin API answers 403.
+func TestAdminDisabled(t *testing.T) {
+	router := newTestRouter(t, "")
+	doc := loadSpec(t, router)
+
+	for _, operation := range doc.operations() {
+		method, route := operation[0], operation[1]
+		if !strings.HasPrefix(route, "/admin/") {
+			continue
+		}
+
+		t.Run(method+" "+route, func(t *testing.T) {
+			check(t, router, doc, routeCase{
+				method: method,
+				target: pathParams.Replace(route),
+				route:  route,
+				header: map[string]string{"Authorization": "Bearer anything"},
+				status: http.StatusForbidden,
+				code:   response.CodeForbidden,
+			})
+		})
+	}
+}
+
+// /tasks/{id} checks the id before the handler, for every operation.
+func TestInvalidTaskId(t *testing.T) {
+	router := newTestRouter(t, testAdminToken)
+	doc := loadSpec(t, router)
+
+	for _, operation := range doc.operations() {
+		method, route := operation[0], operation[1]
+		if !strings.HasPrefix(route, "/tasks/{id}") {
+			continue
+		}
+
+		t.Run(method+" "+route, func(t *testing.T) {
+			check(t, router, doc, routeCase{
+				method: method,
+				target: strings.Replace(pathParams.Replace(route), "/tasks/1", "/tasks/abc", 1),
+				route:  route,
+				header: map[string]string{"Authorization": "Bearer " + testAdminToken},
+				status: http.StatusBadRequest,
+				code:   response.CodeBadRequest,
+			})
+		})
+	}
+}
+
+// Every tus request without Tus-Resumable answers 412.
+func TestTusResumableRequired(t *testing.T) {
+	router := newTestRouter(t, testAdminToken)
+	doc := loadSpec(t, router)
+	cookie := "jwt_token=" + taskToken(t, 1, testSecret)
+
+	for _, operation := range doc.operations() {
+		method, route := operation[0], operation[1]
+		if !strings.HasPrefix(route, "/uploads") {
+			continue
+		}
+
+		tc := routeCase{
+			method: method,
+			target: pathParams.Replace(route),
+			route:  route,
+			header: map[string]string{"Cookie": cookie},
+			status: http.StatusPreconditionFailed,
+		}
+		// у HEAD нет тела
+		if method != http.MethodHead {
+			tc.code = response.CodePreconditionFailed
+		}
+		t.Run(method+" "+route, func(t *testing.T) {
+			check(t, router, doc, tc)
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	router := newTestRouter(t, testAdminToken)
+	doc := loadSpec(t, router)
+
+	admin := map[string]string{"Authorization": "Bearer " + testAdminToken}
+	cookie := map[string]string{"Cookie": "jwt_token=" + taskToken(t, 1, testSecret)}
+	tus := map[string]string{"Cookie": cookie["Cookie"], "Tus-Resumable": "1.0.0"}
+	with := func(base map[string]string, name, value string) map[string]string {
+		header := map[string]string{name: value}
+		for k, v := range base {
+			header[k] = v
+		}
+		return header
+	}
+
+	tests := []routeCase{
+		{name: "unknown route", method: "GET", target: "/nowhere", status: 404, code: response.CodeNotFound},
+		{name: "wrong method", method: "DELETE", target: "/tasks", header: admin, status: 405, code: response.CodeMethodNotAllowed},
+		{
+			name: "token of another secret", method: "GET", target: "/taskstatus", route: "/taskstatus",
+			header: map[string]string{"Cookie": "jwt_token=" + taskToken(t, 1, "other")}, status: 401, code: response.CodeUnauthorized,
+		},
+		{
+			name: "wrong admin token", method: "GET", target: "/admin/recordings", route: "/admin/recordings",
+			header: map[string]string{"Authorization": "Bearer wrong"}, status: 401, code: response.CodeUnauthorized,
+		},
+		{name: "valuation invalid json", method: "POST", target: "/valuation", route: "/valuation", body: "{", status: 400, code: response.CodeInvalidJSON},
+
+		{name: "update invalid json", method: "POST", target: "/updateprotocol", route: "/updateprotocol", header: cookie, body: "protocol", status: 400, code: response.CodeInvalidJSON},
+		{name: "update invalid If-Match", method: "POST", target: "/updateprotocol", route: "/updateprotocol", header: with(cookie, "If-Match", "r1"), body: `{"new_protocol":"x"}`, status: 400, code: response.CodeBadRequest},
+		{name: "update negative base", method: "POST", target: "/updateprotocol", route: "/updateprotocol", header: cookie, body: `{"new_protocol":"x","base_revision":-1}`, status: 400, code: response.CodeBadRequest},
+		{name: "update without revision", method: "POST", target: "/updateprotocol", route: "/updateprotocol", header: cookie, body: `{"new_protocol":"x"}`, status: 428, code: response.CodePreconditionRequired},
+
+		{name: "upload without tus version", method: "POST", target: "/uploads", route: "/uploads", header: cookie, status: 412, code: response.CodePreconditionFailed},
+		{name: "upload without length", method: "POST", target: "/uploads", route: "/uploads", header: tus, status: 400, code: response.CodeBadRequest},
+		{name: "upload too large", method: "POST", target: "/uploads", route: "/uploads", header: with(tus, "Upload-Length", "1000"), status: 413, code: response.CodeTooLarge},
+		{name: "upload bad metadata", method: "POST", target: "/uploads", route: "/uploads", header: with(with(tus, "Upload-Length", "10"), "Upload-Metadata", "filename !!!"), status: 400, code: response.CodeBadRequest},
+		{name: "patch without tus version", method: "PATCH", target: "/uploads/upload", route: "/uploads/{uploadId}", header: cookie, status: 412, code: response.CodePreconditionFailed},
+		{name: "patch wrong content type", method: "PATCH", target: "/uploads/upload", route: "/uploads/{uploadId}", header: with(tus, "Content-Type", "audio/wav"), status: 415, code: response.CodeUnsupportedMedia},
+		{name: "patch without offset", method: "PATCH", target: "/uploads/upload", route: "/uploads/{uploadId}", header: with(tus, "Content-Type", "application/offset+octet-stream"), status: 400, code: response.CodeBadRequest},
+		{name: "delete without tus version", method: "DELETE", target: "/uploads/upload", route: "/uploads/{uploadId}", header: cookie, status: 412, code: response.CodePreconditionFailed},
+
+		{name: "tasks invalid filter", method: "GET", target: "/tasks?limit=many", route: "/tasks", header: admin, status: 400, code: response.CodeBadRequest},
+		{name: "search without query", method: "GET", target: "/search", route: "/search", header: admin, status: 400, code: response.CodeBadRequest},
+		{name: "invalid task id", method: "GET", target: "/tasks/abc", route: "/tasks/{id}", header: admin, status: 400, code: response.CodeBadRequest},
+		{name: "zero task id", method: "GET", target: "/tasks/0/audio", route: "/tasks/{id}/audio", header: admin, status: 400, code: response.CodeBadRequest},
+		{name: "another task", method: "GET", target: "/tasks/2", route: "/tasks/{id}", header: cookie, status: 404, code: response.CodeNotFound},
+		{name: "another task protocol", method: "GET", target: "/tasks/2/protocol", route: "/tasks/{id}/protocol", header: cookie, status: 404, code: response.CodeNotFound},
+		{name: "export unknown format", method: "GET", target: "/tasks/1/protocol/export?format=odt", route: "/tasks/{id}/protocol/export", header: cookie, status: 406, code: response.CodeNotAcceptable},
+		{name: "export not acceptable", method: "GET", target: "/tasks/1/protocol/export", route: "/tasks/{id}/protocol/export", header: with(cookie, "Accept", "image/png"), status: 406, code: response.CodeNotAcceptable},
+		{name: "invalid revision", method: "GET", target: "/tasks/1/protocol/revisions/abc", route: "/tasks/{id}/protocol/revisions/{rev}", header: cookie, status: 400, code: response.CodeBadRequest},
+		{name: "revert to revision 0", method: "POST", target: "/tasks/1/protocol/revisions/0/revert", route: "/tasks/{id}/protocol/revisions/{rev}/revert", header: cookie, status: 400, code: response.CodeBadRequest},
+		{name: "revert invalid If-Match", method: "POST", target: "/tasks/1/protocol/revisions/1/revert", route: "/tasks/{id}/protocol/revisions/{rev}/revert", header: with(cookie, "If-Match", "*1"), status: 400, code: response.CodeBadRequest},
+		{name: "diff without from", method: "GET", target: "/tasks/1/protocol/diff", route: "/tasks/{id}/protocol/diff", header: cookie, status: 400, code: response.CodeBadRequest},
+		{name: "diff invalid to", method: "GET", target: "/tasks/1/protocol/diff?from=1&to=x", route: "/tasks/{id}/protocol/diff", header: cookie, status: 400, code: response.CodeBadRequest},
+
+		{name: "webhook empty body", method: "POST", target: "/tasks/1/webhooks", route: "/tasks/{id}/webhooks", header: cookie, status: 400, code: response.CodeInvalidJSON},
+		{name: "webhook invalid json", method: "POST", target: "/tasks/1/webhooks", route: "/tasks/{id}/webhooks", header: cookie, body: "[", status: 400, code: response.CodeInvalidJSON},
+		{name: "webhook invalid id", method: "GET", target: "/tasks/1/webhooks/abc", route: "/tasks/{id}/webhooks/{webhookId}", header: cookie, status: 400, code: response.CodeBadRequest},
+		{name: "delete webhook invalid id", method: "DELETE", target: "/tasks/1/webhooks/0", route: "/tasks/{id}/webhooks/{webhookId}", header: cookie, status: 400, code: response.CodeBadRequest},
+		{name: "deliveries invalid id", method: "GET", target: "/tasks/1/webhooks/x/deliveries", route: "/tasks/{id}/webhooks/{webhookId}/deliveries", header: cookie, status: 400, code: response.CodeBadRequest},
+		{name: "redeliver invalid delivery", method: "POST", target: "/tasks/1/webhooks/1/deliveries/x/redeliver", route: "/tasks/{id}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver", header: cookie, status: 400, code: response.CodeBadRequest},
+		{name: "admin webhook invalid json", method: "POST", target: "/admin/webhooks", route: "/admin/webhooks", header: admin, body: "{", status: 400, code: response.CodeInvalidJSON},
+		{name: "admin webhook invalid id", method: "GET", target: "/admin/webhooks/abc", route: "/admin/webhooks/{webhookId}", header: admin, status: 400, code: response.CodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check(t, router, doc, tt)
+		})
+	}
+}
+
+func TestSuccessResponses(t *testing.T) {
+	router := newTestRouter(t, testAdminToken)
+	doc := loadSpec(t, router)
+
+	check(t, router, doc, routeCase{
+		method: "GET",
+		target: "/admin/recordings",
+		route:  "/admin/recordings",
+		header: map[string]string{"Authorization": "Bearer " + testAdminToken},
+		status: http.StatusOK,
+	})
+
+	// заголовки tus отдаются и на ошибку
+	r := httptest.NewRequest(http.MethodPost, "/uploads", nil)
+	r.Header.Set("Cookie", "jwt_token="+taskToken(t, 1, testSecret))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Tus-Version") != "1.0.0" || w.Header().Get("Tus-Max-Size") != "100" {
+		t.Errorf("tus headers = %v", w.Header())
+	}
+}
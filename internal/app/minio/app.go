@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
 	"os"
 	"time"
 
@@ -11,6 +12,13 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+// PresignExpiry is how long links handed out to clients and workers stay valid.
+const PresignExpiry = time.Hour
+
+// staleUploadAge - загрузка старше этого точно брошена: записи столько не идут,
+// а бакет могут делить несколько экземпляров
+const staleUploadAge = 24 * time.Hour
+
 type App struct {
 	log         *slog.Logger
 	client      *minio.Client
@@ -42,6 +50,8 @@ func (a *App) Run() error {
 
 	a.client = client
 	log.Info("Minio is ready")
+
+	go a.abortIncompleteUploads(time.Now())
 	return nil
 }
 
@@ -51,7 +61,13 @@ func (a *App) MustRun() {
 	}
 }
 
-func (a *App) UploadFile(objectName, filePath string) (string, error) {
+func (a *App) UploadFile(objectName, filePath string) (rabbitmodels.ObjectRef, error) {
+	return a.UploadFileWithContentType(objectName, filePath, "")
+}
+
+// UploadFileWithContentType stores the object with the given Content-Type,
+// empty contentType lets minio guess it from the object name.
+func (a *App) UploadFileWithContentType(objectName, filePath, contentType string) (rabbitmodels.ObjectRef, error) {
 	const op = "minioapp.UploadFile"
 
 	log := a.log.With(
@@ -59,16 +75,66 @@ func (a *App) UploadFile(objectName, filePath string) (string, error) {
 	)
 	log.Info("Uploading file to minio...")
 
-	_, err := a.client.FPutObject(context.Background(), a.bucket_name, objectName, filePath, minio.PutObjectOptions{})
+	_, err := a.client.FPutObject(context.Background(), a.bucket_name, objectName, filePath, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
 	if err != nil {
-		return "", fmt.Errorf("%s: Ошибка при загрузке файла: %w", op, err)
+		return rabbitmodels.ObjectRef{}, fmt.Errorf("%s: Ошибка при загрузке файла: %w", op, err)
 	}
 
 	log.Info(fmt.Sprintf("Файл %s успешно загружен в бакет %s\n", objectName, a.bucket_name))
 
-	link, err := a.client.PresignedGetObject(context.Background(), a.bucket_name, objectName, time.Hour, nil)
+	return a.ref(objectName), nil
+}
+
+func (a *App) ref(objectName string) rabbitmodels.ObjectRef {
+	return rabbitmodels.ObjectRef{Bucket: a.bucket_name, Key: objectName}
+}
+
+// PresignedURL returns a link to the object valid for PresignExpiry.
+// An empty ref gives an empty link.
+func (a *App) PresignedURL(ctx context.Context, object rabbitmodels.ObjectRef) (string, error) {
+	const op = "minioapp.PresignedURL"
+
+	if object.IsZero() {
+		return "", nil
+	}
+
+	bucket := object.Bucket
+	if bucket == "" {
+		bucket = a.bucket_name
+	}
+
+	link, err := a.client.PresignedGetObject(ctx, bucket, object.Key, PresignExpiry, nil)
 	if err != nil {
 		return "", fmt.Errorf("%s: Ошибка при получении временной ссылки на файл: %w", op, err)
 	}
 	return link.String(), nil
 }
+
+// abortIncompleteUploads drops multipart uploads abandoned by a crashed
+// process. Only uploads older than staleUploadAge are touched, so recordings
+// of other instances sharing the bucket keep going.
+func (a *App) abortIncompleteUploads(startedAt time.Time) {
+	const op = "minioapp.abortIncompleteUploads"
+
+	log := a.log.With(slog.String("op", op))
+
+	ctx := context.Background()
+	for upload := range a.client.ListIncompleteUploads(ctx, a.bucket_name, "", true) {
+		if upload.Err != nil {
+			log.Error("Failed to list incomplete uploads", slog.String("error", upload.Err.Error()))
+			return
+		}
+		if !upload.Initiated.Before(startedAt.Add(-staleUploadAge)) {
+			continue
+		}
+
+		err := minio.Core{Client: a.client}.AbortMultipartUpload(ctx, a.bucket_name, upload.Key, upload.UploadID)
+		if err != nil {
+			log.Error("Failed to abort upload", slog.String("object", upload.Key), slog.String("error", err.Error()))
+			continue
+		}
+		log.Info("Aborted stale upload", slog.String("object", upload.Key))
+	}
+}
@@ -0,0 +1,84 @@
+package minioapp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo is what the backend needs to serve an object over HTTP.
+type ObjectInfo struct {
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// OpenObject returns a reader of the object. Seek does not download the
+// skipped data, so a Range request reads only the requested part.
+func (a *App) OpenObject(ctx context.Context, object rabbitmodels.ObjectRef) (io.ReadSeekCloser, ObjectInfo, error) {
+	const op = "minioapp.OpenObject"
+
+	if object.IsZero() {
+		return nil, ObjectInfo{}, fmt.Errorf("%s: %w", op, ErrObjectNotFound)
+	}
+
+	bucket := object.Bucket
+	if bucket == "" {
+		bucket = a.bucket_name
+	}
+
+	reader, err := a.client.GetObject(ctx, bucket, object.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// GetObject ленивый, ошибки приходят только со Stat или Read
+	stat, err := reader.Stat()
+	if err != nil {
+		reader.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ObjectInfo{}, fmt.Errorf("%s: %w", op, ErrObjectNotFound)
+		}
+		return nil, ObjectInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reader, ObjectInfo{
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		ETag:         stat.ETag,
+		LastModified: stat.LastModified,
+	}, nil
+}
+
+// PutObject stores small data, such as protocol text, without a temp file.
+func (a *App) PutObject(ctx context.Context, objectName string, data []byte, contentType string) (rabbitmodels.ObjectRef, error) {
+	const op = "minioapp.PutObject"
+
+	_, err := a.client.PutObject(ctx, a.bucket_name, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return rabbitmodels.ObjectRef{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return a.ref(objectName), nil
+}
+
+func (a *App) RemoveObject(ctx context.Context, object rabbitmodels.ObjectRef) error {
+	const op = "minioapp.RemoveObject"
+
+	if err := a.client.RemoveObject(ctx, object.Bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package minioapp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// MinPartSize - S3 не принимает части меньше 5 МиБ, кроме последней
+const MinPartSize = 5 << 20
+
+// Stream uploads an object while its data arrives. Data is buffered up to
+// the part size and sent as one part of a multipart upload, so a slow
+// upload blocks Write instead of growing the buffer. The upload is started
+// by the first part, a short object is stored with one PutObject.
+// Not safe for concurrent use.
+type Stream struct {
+	app      *App
+	core     minio.Core
+	partSize int
+	// name выбирает имя объекта и Content-Type по первым байтам
+	name func(head []byte) (objectName string, contentType string)
+
+	objectName  string
+	contentType string
+	uploadId    string
+	parts       []minio.CompletePart
+	buf         []byte
+	size        int64
+	// patch правит первую часть, которая ждёт Complete, nil - части уходят сразу
+	patch func(head []byte, size int64)
+	head  []byte
+}
+
+func (a *App) NewStream(partSize int, name func(head []byte) (string, string)) *Stream {
+	if partSize < MinPartSize {
+		partSize = MinPartSize
+	}
+
+	return &Stream{
+		app:      a,
+		core:     minio.Core{Client: a.client},
+		partSize: partSize,
+		name:     name,
+		buf:      make([]byte, 0, partSize),
+	}
+}
+
+func (s *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), s.partSize-len(s.buf))
+		s.buf = append(s.buf, p[:n]...)
+		s.size += int64(n)
+		written += n
+		p = p[n:]
+
+		if len(s.buf) == s.partSize {
+			if err := s.flush(context.Background()); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// HoldHead keeps the first part until Complete, where patch puts the final
+// object size into it, e.g. into a WAV header. It is called before the first
+// Write, the held part takes one more part size of memory.
+func (s *Stream) HoldHead(patch func(head []byte, size int64)) {
+	s.patch = patch
+}
+
+// Size is how many bytes were written, uploaded or not.
+func (s *Stream) Size() int64 {
+	return s.size
+}
+
+// ObjectName is empty until the first part is sent.
+func (s *Stream) ObjectName() string {
+	return s.objectName
+}
+
+func (s *Stream) flush(ctx context.Context) error {
+	const op = "minioapp.Stream.flush"
+
+	if s.uploadId == "" {
+		s.objectName, s.contentType = s.name(s.buf)
+
+		uploadId, err := s.core.NewMultipartUpload(ctx, s.app.bucket_name, s.objectName, minio.PutObjectOptions{
+			ContentType: s.contentType,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: start multipart upload: %w", op, err)
+		}
+		s.uploadId = uploadId
+	}
+
+	if s.patch != nil && s.head == nil {
+		s.head = s.buf
+		s.buf = make([]byte, 0, s.partSize)
+		return nil
+	}
+
+	// номер 1 остаётся за удержанной первой частью
+	partNumber := len(s.parts) + 1
+	if s.head != nil {
+		partNumber++
+	}
+	if err := s.putPart(ctx, partNumber, s.buf); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.buf = s.buf[:0]
+
+	return nil
+}
+
+func (s *Stream) putPart(ctx context.Context, partNumber int, data []byte) error {
+	part, err := s.core.PutObjectPart(ctx, s.app.bucket_name, s.objectName, s.uploadId, partNumber,
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectPartOptions{})
+	if err != nil {
+		return fmt.Errorf("upload part %d: %w", partNumber, err)
+	}
+
+	s.parts = append(s.parts, minio.CompletePart{PartNumber: partNumber, ETag: part.ETag})
+
+	return nil
+}
+
+// Complete uploads the rest of the data and returns the stored object.
+func (s *Stream) Complete(ctx context.Context) (object rabbitmodels.ObjectRef, contentType string, err error) {
+	const op = "minioapp.Stream.Complete"
+
+	if s.uploadId == "" {
+		s.objectName, s.contentType = s.name(s.buf)
+		if s.patch != nil {
+			s.patch(s.buf, s.size)
+		}
+
+		_, err := s.app.client.PutObject(ctx, s.app.bucket_name, s.objectName, bytes.NewReader(s.buf), int64(len(s.buf)), minio.PutObjectOptions{
+			ContentType: s.contentType,
+		})
+		if err != nil {
+			return object, "", fmt.Errorf("%s: put object: %w", op, err)
+		}
+	} else {
+		if len(s.buf) > 0 {
+			if err := s.flush(ctx); err != nil {
+				return object, "", fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		if s.head != nil {
+			s.patch(s.head, s.size)
+			if err := s.putPart(ctx, 1, s.head); err != nil {
+				return object, "", fmt.Errorf("%s: %w", op, err)
+			}
+			// части в CompleteMultipartUpload идут по возрастанию номеров
+			last := len(s.parts) - 1
+			s.parts = append([]minio.CompletePart{s.parts[last]}, s.parts[:last]...)
+			s.head = nil
+		}
+
+		_, err := s.core.CompleteMultipartUpload(ctx, s.app.bucket_name, s.objectName, s.uploadId, s.parts, minio.PutObjectOptions{
+			ContentType: s.contentType,
+		})
+		if err != nil {
+			return object, "", fmt.Errorf("%s: complete multipart upload: %w", op, err)
+		}
+	}
+	s.buf = nil
+
+	s.app.log.Info("Object streamed to minio",
+		slog.String("object", s.objectName),
+		slog.Int("parts", len(s.parts)),
+		slog.Int64("size", s.size),
+	)
+
+	return s.app.ref(s.objectName), s.contentType, nil
+}
+
+// Abort drops the uploaded parts.
+func (s *Stream) Abort(ctx context.Context) error {
+	const op = "minioapp.Stream.Abort"
+
+	s.buf = nil
+	s.head = nil
+	if s.uploadId == "" {
+		return nil
+	}
+
+	if err := s.core.AbortMultipartUpload(ctx, s.app.bucket_name, s.objectName, s.uploadId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.uploadId = ""
+
+	return nil
+}
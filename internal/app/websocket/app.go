@@ -3,95 +3,230 @@ package wsapp
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
-	"msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/config"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/audio"
 	"msu-logging-backend/internal/services/audioservice"
-	"msu-logging-backend/internal/storage/filerepository"
+	"msu-logging-backend/internal/services/recordings"
+	"msu-logging-backend/internal/services/taskevents"
+	"msu-logging-backend/internal/storage"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// Режимы размещения /ws: отдельный сервер или общий HTTP-роутер.
+const (
+	MountStandalone = "standalone"
+	MountHTTP       = "http"
+)
+
 type App struct {
-	log             *slog.Logger
-	server          *http.Server
-	port            int
-	upgrader        websocket.Upgrader
-	audio_service   *audioservice.AudioService
-	fileRepo        *filerepository.FileRepository
-	taskStatusSaver TaskStatusSaver
-	certFile        string
-	keyFile         string
+	log              *slog.Logger
+	server           *http.Server
+	handler          http.Handler
+	mount            string
+	tls              bool
+	port             int
+	upgrader         websocket.Upgrader
+	audio_service    *audioservice.AudioService
+	recordings       *recordings.Manager
+	vad              *audio.VAD
+	taskStatusGetter TaskStatusGetter
+	metadataSaver    TaskMetadataSaver
+	trackStarter     TrackStarter
+	events           *taskevents.Broker
+	certFile         string
+	keyFile          string
+
+	pingInterval   time.Duration
+	pongTimeout    time.Duration
+	idleTimeout    time.Duration
+	writeTimeout   time.Duration
+	maxMessageSize int64
+
+	resumeGracePeriod time.Duration
+	suspendedMu       sync.Mutex
+	suspended         map[trackKey]*suspendedRecording
+
+	sessionsMu sync.Mutex
+	sessions   map[*session]struct{}
+	active     sync.WaitGroup
 }
 
-type TaskStatusSaver interface {
-	UpdateTaskStatusByID(ctx context.Context, id int32, task_status string) error
+type TaskStatusGetter interface {
+	GetTaskStatusByID(ctx context.Context, id int32) (string, error)
+}
+
+type TrackStarter interface {
+	StartTrack(ctx context.Context, taskId int32, source string) error
+}
+
+type TaskMetadataSaver interface {
+	SaveTaskMetadata(ctx context.Context, taskId int32, metadata rabbitmodels.TaskMetadata) error
 }
 
 func New(
 	log *slog.Logger,
-	port int,
+	cfg config.WebsocketConfig,
 	audio_service *audioservice.AudioService,
-	taskStatusSaver TaskStatusSaver,
-	certFile string,
-	keyFile string,
+	taskStatusGetter TaskStatusGetter,
+	metadataSaver TaskMetadataSaver,
+	trackStarter TrackStarter,
+	events *taskevents.Broker,
+	recordingManager *recordings.Manager,
+	vad *audio.VAD,
 ) *App {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			//origin:= r.Header.Get("Origin")
-			return true
-		},
+		CheckOrigin:     newOriginChecker(cfg.AllowedOrigins),
+		Subprotocols:    []string{bearerSubprotocol},
 	}
 
-	mux := http.NewServeMux()
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
-		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		},
+	pingInterval := cfg.PingInterval
+	if cfg.PongTimeout > 0 && (pingInterval <= 0 || pingInterval >= cfg.PongTimeout) {
+		// пинг должен успеть дойти до истечения PongTimeout
+		pingInterval = cfg.PongTimeout * 9 / 10
 	}
 
 	app := &App{
-		log:             log,
-		server:          server,
-		port:            port,
-		upgrader:        upgrader,
-		certFile:        certFile,
-		keyFile:         keyFile,
-		fileRepo:        filerepository.NewFileRepository(),
-		audio_service:   audio_service,
-		taskStatusSaver: taskStatusSaver,
+		log:              log,
+		mount:            cfg.Mount,
+		tls:              cfg.TLS,
+		port:             cfg.Port,
+		upgrader:         upgrader,
+		certFile:         cfg.CertFile,
+		keyFile:          cfg.KeyFile,
+		recordings:       recordingManager,
+		vad:              vad,
+		audio_service:    audio_service,
+		taskStatusGetter: taskStatusGetter,
+		metadataSaver:    metadataSaver,
+		trackStarter:     trackStarter,
+		events:           events,
+
+		pingInterval:   pingInterval,
+		pongTimeout:    cfg.PongTimeout,
+		idleTimeout:    cfg.IdleTimeout,
+		writeTimeout:   cfg.WriteTimeout,
+		maxMessageSize: cfg.MaxMessageSize,
+
+		resumeGracePeriod: cfg.ResumeGracePeriod,
+		suspended:         make(map[trackKey]*suspendedRecording),
+
+		sessions: make(map[*session]struct{}),
 	}
 
-	mux.HandleFunc("/ws", app.handleWebSocket)
+	app.handler = http.HandlerFunc(app.handleWebSocket)
+	// при mount: http заголовки разбирает роутер HTTP-сервера
+	if cfg.TrustForwardedHeaders && app.mount != MountHTTP {
+		app.handler = mymiddleware.Forwarded(app.handler)
+	}
+
+	if app.mount != MountHTTP {
+		mux := http.NewServeMux()
+		mux.Handle("/ws", app.handler)
+
+		app.server = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Port),
+			Handler: mux,
+			TLSConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+	}
 
 	return app
 }
 
-func (a *App) handleWebSocketConnection(conn *websocket.Conn, task_id int32) error {
+// Handler отдает обработчик /ws для монтирования на HTTP-роутер (mount: http).
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+func (a *App) handleWebSocketConnection(conn *websocket.Conn, recording *recordings.Recording, expiresAt time.Time) error {
 	const op = "websocket.handleWebSocketConnection"
 	log := a.log.With(
 		slog.String("op", op),
 	)
 
-	filename := fmt.Sprintf("audio_%v.wav", task_id)
-	a.fileRepo.CreateAudioFile(filename)
+	task_id := recording.TaskId
+
+	s := newSession(a, conn, recording)
+
+	resumed := false
+	if rec, ok := a.takeSuspended(trackKey{taskId: task_id, source: recording.Source}); ok {
+		s.track = rec.track
+		s.state = rec.state
+		s.format = rec.format
+		s.metadata = rec.metadata
+		s.trackMetadata = rec.trackMetadata
+		s.detector = rec.detector
+		s.bytes = rec.track.Size()
+		if s.format.IsPCM() {
+			s.bytes -= audio.WAVHeaderSize
+		}
+		recording.Attach(rec.track, rec.track.Size(), rec.startedAt)
+		resumed = true
+	} else {
+		track, err := a.audio_service.NewTrackWriter(task_id, recording.Source)
+		if err != nil {
+			s.closeWith(websocket.CloseInternalServerErr, "failed to create recording")
+			return err
+		}
+		s.track = track
+		recording.Attach(track, 0, time.Time{})
+	}
+
+	s.setupKeepalive()
+
+	go s.writeLoop()
+	go s.keepalive()
+
+	events, unsubscribe := a.events.Subscribe(task_id)
+	go s.forwardEvents(events)
+
+	a.addSession(s)
+
 	defer func() {
-		a.fileRepo.CloseAudioFile(filename)
-		if err := a.audio_service.StartFileProcessing(task_id, filename); err != nil {
-			log.Error("Failed to process closed websocket", slog.String("error", err.Error()))
+		if s.state != StateStopped && !s.aborted {
+			a.suspend(s)
 		}
-		a.fileRepo.DeleteAudioFile(filename)
+		// done раньше отписки: forwardEvents отличает конец сессии от отставания
+		close(s.done)
+		unsubscribe()
+		a.removeSession(s)
 	}()
 
-	log.Info("Created audio file")
+	if !expiresAt.IsZero() {
+		expiry := time.AfterFunc(time.Until(expiresAt), func() {
+			s.closeWith(websocket.ClosePolicyViolation, "token expired")
+		})
+		defer expiry.Stop()
+	}
+
+	if resumed {
+		log.Info("Resumed audio file", slog.Int64("bytes", s.bytes))
+	} else {
+		log.Info("Created audio file")
+	}
+	s.push(ServerMessage{Type: ServerReady, Source: recording.Source, State: s.state, Resumed: resumed, Bytes: s.bytes})
+
 	for {
 		messageType, p, err := conn.ReadMessage()
 		if err != nil {
+			if s.idleExpired.Load() {
+				s.finishIdle()
+				return nil
+			}
 			if websocket.IsCloseError(
 				err,
 				websocket.CloseNormalClosure,
@@ -105,44 +240,118 @@ func (a *App) handleWebSocketConnection(conn *websocket.Conn, task_id int32) err
 			return fmt.Errorf("read error: %w", err)
 		}
 
-		if messageType == websocket.BinaryMessage {
-			if err := a.fileRepo.WriteAudioData(filename, p); err != nil {
+		switch messageType {
+		case websocket.TextMessage:
+			s.handleControl(p)
+		case websocket.BinaryMessage:
+			if err := s.handleAudio(p); err != nil {
+				if code, ok := limitCloseCode(err); ok {
+					s.closeWith(code, err.Error())
+					return nil
+				}
 				a.log.Error("Write error", slog.String("error", err.Error()))
-				return fmt.Errorf("write error: %w", err)
+				s.closeWith(websocket.CloseInternalServerErr, "failed to write audio")
+				return err
 			}
 		}
+
+		s.touch()
 	}
 }
 
 func (a *App) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := a.upgrader.Upgrade(w, r, nil)
+	const op = "websocket.handleWebSocket"
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("remote_addr", r.RemoteAddr),
+	)
+
+	// всё проверяем до апгрейда, чтобы ответить нормальным HTTP-статусом
+	if !a.upgrader.CheckOrigin(r) {
+		log.Warn("Origin is not allowed", slog.String("origin", r.Header.Get("Origin")))
+		response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "origin is not allowed")
+		return
+	}
+
+	claims, err := authenticate(r)
 	if err != nil {
-		a.log.Error("WebSocket upgrade failed", slog.String("error", err.Error()))
+		log.Warn("WebSocket authentication failed", slog.String("error", err.Error()))
+		response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, err.Error())
 		return
 	}
+	task_id := claims.taskId
 
-	tokenString := r.URL.Query().Get("token")
-	fmt.Println(tokenString)
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		source = rabbitmodels.DefaultTrackSource
+	}
+	if !rabbitmodels.ValidTrackSource(source) {
+		response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "source must be 1-32 letters, digits, '-' or '_'")
+		return
+	}
 
-	jwt_claims, ok := middleware.ParseTokenString(tokenString)
-	if !ok {
-		a.log.Error("JWT error")
+	taskStatus, err := a.taskStatusGetter.GetTaskStatusByID(r.Context(), task_id)
+	if err != nil {
+		log.Error("No task with this TaskId", slog.String("error", err.Error()))
+		response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "task not found")
 		return
 	}
 
-	task_id := int32(jwt_claims["taskId"].(float64))
-	err = a.taskStatusSaver.UpdateTaskStatusByID(context.Background(), task_id, "none")
+	switch taskStatus {
+	case "":
+		// через сервис, чтобы статус дошёл до SSE и вебхуков
+		err = a.audio_service.SetTaskStatus(task_id, "none")
+		if err != nil {
+			log.Error("Error while updating the task", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to update task")
+			return
+		}
+	case "none":
+		// переподключение к незаконченной записи
+	default:
+		response.Fail(w, r, http.StatusConflict, response.CodeConflict, "recording of this task is already finished")
+		return
+	}
+
+	recording, err := a.recordings.Acquire(task_id, source)
+	switch {
+	case errors.Is(err, recordings.ErrTaskBusy), errors.Is(err, recordings.ErrTooManySources):
+		response.Fail(w, r, http.StatusConflict, response.CodeConflict, err.Error())
+		return
+	case errors.Is(err, recordings.ErrTooManySessions):
+		log.Warn("Recording limit reached", slog.Int("task_id", int(task_id)))
+		response.Fail(w, r, http.StatusServiceUnavailable, response.CodeUnavailable, err.Error())
+		return
+	case err != nil:
+		log.Error("Failed to start recording", slog.String("error", err.Error()))
+		response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to start recording")
+		return
+	}
+	defer a.recordings.Release(recording)
 
+	err = a.trackStarter.StartTrack(r.Context(), task_id, source)
+	if errors.Is(err, storage.ErrTrackFinished) {
+		response.Fail(w, r, http.StatusConflict, response.CodeConflict, "recording of this source is already finished")
+		return
+	}
 	if err != nil {
-		a.log.Error("Error while updating the task", slog.String("error", err.Error()))
+		log.Error("Failed to register track", slog.String("error", err.Error()))
+		response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to start recording")
 		return
 	}
 
-	if err := a.handleWebSocketConnection(conn, task_id); err != nil {
-		a.log.Error("WebSocket connection error", slog.String("error", err.Error()))
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade сам ответил клиенту
+		log.Error("WebSocket upgrade failed", slog.String("error", err.Error()))
 		return
 	}
+	defer conn.Close()
 
+	if err := a.handleWebSocketConnection(conn, recording, claims.expiresAt); err != nil {
+		log.Error("WebSocket connection error", slog.String("error", err.Error()))
+		return
+	}
 }
 
 func (a *App) Run() error {
@@ -152,9 +361,21 @@ func (a *App) Run() error {
 		slog.String("op", op),
 	)
 
-	log.Info("Secure WebSocket server is running...")
+	if a.server == nil {
+		log.Info("WebSocket is served by the HTTP router on /ws")
+		return nil
+	}
 
-	if err := a.server.ListenAndServeTLS(a.certFile, a.keyFile); err != nil && err != http.ErrServerClosed {
+	var err error
+	if a.tls {
+		log.Info("Secure WebSocket server is running...", slog.Int("port", a.port))
+		err = a.server.ListenAndServeTLS(a.certFile, a.keyFile)
+	} else {
+		// TLS терминируется на прокси
+		log.Info("Plaintext WebSocket server is running...", slog.Int("port", a.port))
+		err = a.server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -173,5 +394,39 @@ func (a *App) Stop() error {
 	a.log.With(slog.String("op", op)).
 		Info("Stopping WebSocket server", slog.Int("port", a.port))
 
-	return a.server.Close()
+	var err error
+	if a.server != nil {
+		err = a.server.Close()
+	}
+
+	// http.Server не закрывает захваченные websocket-соединения
+	a.closeSessions(websocket.CloseGoingAway, "server is shutting down")
+	a.finishSuspended()
+
+	return err
+}
+
+func (a *App) addSession(s *session) {
+	a.sessionsMu.Lock()
+	a.sessions[s] = struct{}{}
+	a.active.Add(1)
+	a.sessionsMu.Unlock()
+}
+
+func (a *App) removeSession(s *session) {
+	a.sessionsMu.Lock()
+	delete(a.sessions, s)
+	a.active.Done()
+	a.sessionsMu.Unlock()
+}
+
+// closeSessions closes every open connection and waits until their recordings are suspended.
+func (a *App) closeSessions(code int, reason string) {
+	a.sessionsMu.Lock()
+	for s := range a.sessions {
+		s.closeWith(code, reason)
+	}
+	a.sessionsMu.Unlock()
+
+	a.active.Wait()
 }
@@ -0,0 +1,109 @@
+package wsapp
+
+import (
+	"errors"
+	"msu-logging-backend/internal/http-server/middleware"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Браузер не умеет ставить заголовки на WebSocket, поэтому токен можно
+// передать через Sec-WebSocket-Protocol: "bearer, <token>".
+const bearerSubprotocol = "bearer"
+
+var (
+	errNoToken      = errors.New("token is required")
+	errInvalidToken = errors.New("invalid token")
+)
+
+type wsClaims struct {
+	taskId    int32
+	expiresAt time.Time
+}
+
+// authenticate looks for the token in the query, the cookie and the subprotocol header.
+func authenticate(r *http.Request) (wsClaims, error) {
+	tokenString := tokenFromRequest(r)
+	if tokenString == "" {
+		return wsClaims{}, errNoToken
+	}
+
+	claims, ok := middleware.ParseTokenString(tokenString)
+	if !ok {
+		return wsClaims{}, errInvalidToken
+	}
+
+	taskClaim, ok := claims["taskId"].(float64)
+	if !ok {
+		return wsClaims{}, errInvalidToken
+	}
+
+	result := wsClaims{taskId: int32(taskClaim)}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		result.expiresAt = exp.Time
+	}
+
+	return result, nil
+}
+
+func tokenFromRequest(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	if cookie, err := r.Cookie(middleware.JWTCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if strings.EqualFold(protocol, bearerSubprotocol) && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	return ""
+}
+
+// newOriginChecker allows origins from the list, "*" allows any.
+// With an empty list only same-origin requests pass, as gorilla does by default.
+func newOriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	if len(allowedOrigins) == 0 {
+		return checkSameOrigin
+	}
+
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			return func(r *http.Request) bool { return true }
+		}
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			// не браузер
+			return true
+		}
+		return allowed[strings.ToLower(origin)]
+	}
+}
+
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,88 @@
+package wsapp
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// setupKeepalive limits frame size and arms the read deadline, which
+// every pong or client frame pushes forward. A half-open connection
+// fails the read after pongTimeout and the recording is suspended.
+func (s *session) setupKeepalive() {
+	if s.app.maxMessageSize > 0 {
+		s.conn.SetReadLimit(s.app.maxMessageSize)
+	}
+
+	s.lastActivity.Store(time.Now().UnixNano())
+	s.storeState()
+	s.extendReadDeadline()
+	s.conn.SetPongHandler(func(string) error {
+		s.extendReadDeadline()
+		return nil
+	})
+}
+
+func (s *session) extendReadDeadline() {
+	if s.app.pongTimeout > 0 {
+		s.conn.SetReadDeadline(time.Now().Add(s.app.pongTimeout))
+	}
+}
+
+// touch is called by the reader after every client frame.
+func (s *session) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+	s.storeState()
+	s.extendReadDeadline()
+}
+
+// storeState publishes the state for keepalive, which runs in its own
+// goroutine.
+func (s *session) storeState() {
+	s.paused.Store(s.state == StatePaused)
+	s.stopped.Store(s.state == StateStopped)
+}
+
+// keepalive pings the client and closes the connection when the client
+// sends nothing for idleTimeout. A paused recording is never idle, after
+// stop the client only waits for status and protocol_ready frames.
+func (s *session) keepalive() {
+	if s.app.pingInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.app.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			last := time.Unix(0, s.lastActivity.Load())
+			if s.app.idleTimeout > 0 && !s.paused.Load() && !s.stopped.Load() && time.Since(last) > s.app.idleTimeout {
+				s.idleExpired.Store(true)
+				s.closeWith(websocket.CloseNormalClosure, "idle timeout")
+				return
+			}
+
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(closeWriteTimeout))
+			if err != nil {
+				s.log.Debug("Failed to send ping", slog.String("error", err.Error()))
+				return
+			}
+		}
+	}
+}
+
+// finishIdle sends what was recorded before the idle timeout to processing.
+func (s *session) finishIdle() {
+	s.log.Info("Recording is idle, finishing", slog.Int64("bytes", s.bytes))
+
+	if s.state == StateStopped {
+		return
+	}
+	s.state = StateStopped
+	s.finish()
+}
@@ -0,0 +1,143 @@
+package wsapp
+
+import (
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/audio"
+)
+
+// Протокол /ws
+//
+// Токен проверяется до апгрейда: ?token=..., cookie jwt_token или
+// Sec-WebSocket-Protocol: bearer, <token>. Ошибки отдаются HTTP-статусом:
+// 401 - нет или неверный токен, 403 - origin не из allowed_origins,
+// 400 - неверный source, 404 - нет задачи, 409 - запись задачи или этого
+// source уже закончена, source пишется в другом соединении или источников
+// больше max_sources, 503 - достигнут max_sessions.
+//
+// С mount: standalone /ws слушает свой порт (tls: false - без TLS, когда его
+// снимает прокси), с mount: http - путь /ws на порту HTTP-сервера. За прокси
+// включите trust_forwarded_headers (websocket для standalone, HTTP для
+// mount: http), тогда адрес клиента и host берутся из X-Forwarded-For/X-Real-IP,
+// X-Forwarded-Host и X-Forwarded-Proto.
+//
+// Одну задачу могут одновременно писать несколько устройств: каждое
+// подключается с тем же токеном и своим ?source=<имя> (по умолчанию main) и
+// пишет отдельную дорожку со своим объектом в MinIO. Транскрибация
+// начинается, когда закончены все дорожки, в запросе воркеру есть все.
+//
+// Клиент шлёт аудио бинарными фреймами и управляет записью текстовыми
+// JSON-фреймами {"type": ...}:
+//
+//	start     начать запись (бинарный фрейм до start тоже начинает запись),
+//	          можно указать формат: {"type":"start","format":{"mime_type":"audio/webm"}}
+//	          или для сырого PCM: {"format":{"encoding":"pcm_s16le","sample_rate":48000,"channels":1}}
+//	pause     приостановить, бинарные фреймы отклоняются до resume
+//	resume    продолжить запись
+//	stop      закончить запись и отправить её в обработку, соединение остаётся открытым
+//	metadata  {"type":"metadata","metadata":{"title":...,"participants":[...]}},
+//	          метаданные дорожки: {"track":{"label":"Ноутбук у окна","device":...}}
+//
+// Контейнер определяется по содержимому записи, объявленный mime_type
+// используется, если его не удалось распознать. Сырой PCM оборачивается в WAV.
+// Для PCM работает VAD: после vad.auto_stop_silence тишины после речи запись
+// останавливается как после stop.
+//
+// При upload.storage = stream запись уходит в MinIO частями по upload.part_size
+// прямо во время записи, у WAV в заголовке длина не указана (0xFFFFFFFF).
+// При upload.storage = disk запись пишется во временный файл, длина в
+// заголовке WAV исправляется. В обоих случаях тишина PCM в начале и в конце
+// обрезается, если включён VAD.
+//
+// Если соединение оборвалось без stop, запись ждёт переподключения с тем же
+// токеном resume_grace_period и только потом уходит в обработку.
+//
+// Сервер шлёт ping каждые ping_interval. Если за pong_timeout от клиента не
+// пришло ни pong, ни фрейма, соединение считается оборванным (см. выше про
+// resume_grace_period). Если клиент не шлёт фреймов дольше idle_timeout и
+// запись не на паузе, запись завершается как после stop.
+//
+// Фрейм больше max_message_size рвёт соединение. Следующий фрейм читается
+// только после того, как предыдущий записан на диск, а ответы клиенту
+// буферизуются ограниченно, поэтому быстрый отправитель упирается в TCP.
+// Клиенту стоит ждать ack и следить за bufferedAmount.
+//
+// Сервер отвечает текстовыми JSON-фреймами:
+//
+//	ready           сразу после подключения, state = idle; если запись
+//	                продолжается после обрыва - resumed = true, state прежний,
+//	                bytes = сколько байт уже сохранено, слать нужно с этого смещения
+//	ack             подтверждение управляющего фрейма (ack = его type) или
+//	                бинарного фрейма (ack = "audio"), bytes = всего записано байт
+//	status          смена статуса задачи (transcribing, making protocol, finished, failed)
+//	progress        прогресс воркера
+//	protocol_ready  протокол готов, ссылки в short_protocol и full_protocol
+//	auto_stop       запись остановлена сервером из-за тишины, дальше как после stop
+//	error           error.code и error.message, соединение не закрывается
+//
+// Сервер закрывает соединение с кодом:
+//
+//	1000  протокол готов или истёк idle_timeout
+//	1001  сервер останавливается
+//	1008  истёк токен или превышен max_recording_duration
+//	1009  превышен max_recording_bytes или max_message_size
+//	1011  не удалось записать аудио
+//
+// При превышении лимита записанное до него уходит в обработку как после stop.
+
+const (
+	ClientStart    = "start"
+	ClientPause    = "pause"
+	ClientResume   = "resume"
+	ClientStop     = "stop"
+	ClientMetadata = "metadata"
+)
+
+const (
+	ServerReady    = "ready"
+	ServerAck      = "ack"
+	ServerAutoStop = "auto_stop"
+	ServerError    = "error"
+)
+
+const (
+	StateIdle      = "idle"
+	StateRecording = "recording"
+	StatePaused    = "paused"
+	StateStopped   = "stopped"
+)
+
+const (
+	ErrCodeBadMessage    = "bad_message"
+	ErrCodeBadState      = "bad_state"
+	ErrCodeBadFormat     = "bad_format"
+	ErrCodeWriteFailed   = "write_failed"
+	ErrCodeLimitExceeded = "limit_exceeded"
+	ErrCodeInternal      = "internal"
+)
+
+type ClientMessage struct {
+	Type     string                     `json:"type"`
+	Format   audio.Format               `json:"format"`
+	Metadata rabbitmodels.TaskMetadata  `json:"metadata"`
+	Track    rabbitmodels.TrackMetadata `json:"track"`
+}
+
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ServerMessage struct {
+	Type          string                     `json:"type"`
+	TaskId        int32                      `json:"task_id"`
+	Source        string                     `json:"source,omitempty"`
+	Ack           string                     `json:"ack,omitempty"`
+	State         string                     `json:"state,omitempty"`
+	Resumed       bool                       `json:"resumed,omitempty"`
+	Bytes         int64                      `json:"bytes,omitempty"`
+	Status        string                     `json:"status,omitempty"`
+	Progress      *rabbitmodels.TaskProgress `json:"progress,omitempty"`
+	ShortProtocol string                     `json:"short_protocol,omitempty"`
+	FullProtocol  string                     `json:"full_protocol,omitempty"`
+	Error         *ErrorBody                 `json:"error,omitempty"`
+}
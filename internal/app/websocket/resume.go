@@ -0,0 +1,116 @@
+package wsapp
+
+import (
+	"fmt"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/services/audioservice"
+	"time"
+)
+
+// suspendedRecording is a recording whose connection dropped before stop.
+// It waits resumeGracePeriod for the client to reconnect.
+type suspendedRecording struct {
+	track         audioservice.TrackWriter
+	state         string
+	format        audio.Format
+	metadata      rabbitmodels.TaskMetadata
+	trackMetadata rabbitmodels.TrackMetadata
+	detector      *audio.Detector
+	startedAt     time.Time
+	timer         *time.Timer
+}
+
+// trackKey identifies one source of a task.
+type trackKey struct {
+	taskId int32
+	source string
+}
+
+// suspend keeps the track open and schedules processing after the grace period.
+func (a *App) suspend(s *session) {
+	s.recording.Detach()
+
+	key := trackKey{taskId: s.taskId, source: s.recording.Source}
+
+	rec := &suspendedRecording{
+		track:         s.track,
+		state:         s.state,
+		format:        s.format,
+		metadata:      s.metadata,
+		trackMetadata: s.trackMetadata,
+		detector:      s.detector,
+		startedAt:     s.recording.StartedAt(),
+	}
+
+	if a.resumeGracePeriod <= 0 {
+		a.finishRecording(key, rec.track, rec.trackMetadata, rec.detector)
+		return
+	}
+
+	a.suspendedMu.Lock()
+	a.suspended[key] = rec
+	rec.timer = time.AfterFunc(a.resumeGracePeriod, func() {
+		a.suspendedMu.Lock()
+		if a.suspended[key] != rec {
+			a.suspendedMu.Unlock()
+			return
+		}
+		delete(a.suspended, key)
+		a.suspendedMu.Unlock()
+
+		a.log.Info("Grace period expired, processing recording", slog.Int("task_id", int(key.taskId)), slog.String("source", key.source))
+		a.finishRecording(key, rec.track, rec.trackMetadata, rec.detector)
+	})
+	a.suspendedMu.Unlock()
+
+	a.log.Info("Recording suspended", slog.Int("task_id", int(s.taskId)), slog.String("source", key.source), slog.Int64("bytes", s.bytes))
+}
+
+// takeSuspended removes the recording from the waiting list, if it is still there.
+func (a *App) takeSuspended(key trackKey) (*suspendedRecording, bool) {
+	a.suspendedMu.Lock()
+	defer a.suspendedMu.Unlock()
+
+	rec, ok := a.suspended[key]
+	if !ok {
+		return nil, false
+	}
+
+	rec.timer.Stop()
+	delete(a.suspended, key)
+
+	return rec, true
+}
+
+// finishSuspended processes every waiting recording right away, used on shutdown.
+func (a *App) finishSuspended() {
+	a.suspendedMu.Lock()
+	recordings := a.suspended
+	a.suspended = make(map[trackKey]*suspendedRecording)
+	a.suspendedMu.Unlock()
+
+	for key, rec := range recordings {
+		rec.timer.Stop()
+		a.finishRecording(key, rec.track, rec.trackMetadata, rec.detector)
+	}
+}
+
+// finishRecording completes the track and sends it to processing.
+func (a *App) finishRecording(key trackKey, track audioservice.TrackWriter, trackMetadata rabbitmodels.TrackMetadata, detector *audio.Detector) error {
+	if detector != nil {
+		trackMetadata.SpeechDurationSeconds = detector.SpeechDuration().Seconds()
+	}
+
+	if err := track.Finish(trackMetadata); err != nil {
+		a.log.Error("Failed to process recording",
+			slog.Int("task_id", int(key.taskId)),
+			slog.String("source", key.source),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to process recording: %w", err)
+	}
+
+	return nil
+}
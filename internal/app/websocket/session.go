@@ -0,0 +1,307 @@
+package wsapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/services/audioservice"
+	"msu-logging-backend/internal/services/recordings"
+	"msu-logging-backend/internal/services/taskevents"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	sendBuffer = 64
+
+	closeWriteTimeout = time.Second
+)
+
+// session is one recording over one websocket connection.
+// state and bytes belong to the reader goroutine, only writeLoop writes data frames to conn.
+type session struct {
+	app       *App
+	log       *slog.Logger
+	conn      *websocket.Conn
+	recording *recordings.Recording
+	track     audioservice.TrackWriter
+	taskId    int32
+	state     string
+	bytes     int64
+	format    audio.Format
+	metadata  rabbitmodels.TaskMetadata
+	// trackMetadata описывает только это устройство
+	trackMetadata rabbitmodels.TrackMetadata
+	// detector есть только у PCM, для контейнеров речь не определяем
+	detector *audio.Detector
+	// aborted - запись отброшена после ошибки, ждать переподключения нечего
+	aborted bool
+
+	send chan ServerMessage
+	done chan struct{}
+	// writerDone закрывается, когда writeLoop вышел, чтобы push не зависал
+	writerDone chan struct{}
+
+	lastActivity atomic.Int64
+	paused       atomic.Bool
+	stopped      atomic.Bool
+	idleExpired  atomic.Bool
+}
+
+func newSession(app *App, conn *websocket.Conn, recording *recordings.Recording) *session {
+	return &session{
+		app:        app,
+		log:        app.log.With(slog.Int("task_id", int(recording.TaskId))),
+		conn:       conn,
+		recording:  recording,
+		taskId:     recording.TaskId,
+		state:      StateIdle,
+		send:       make(chan ServerMessage, sendBuffer),
+		done:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+	}
+}
+
+func (s *session) writeLoop() {
+	defer close(s.writerDone)
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.send:
+			if s.app.writeTimeout > 0 {
+				s.conn.SetWriteDeadline(time.Now().Add(s.app.writeTimeout))
+			}
+			if err := s.conn.WriteJSON(msg); err != nil {
+				// клиент не читает, рвём соединение, запись будет приостановлена
+				s.log.Error("Failed to send message", slog.String("error", err.Error()))
+				s.conn.Close()
+				return
+			}
+			if msg.Type == taskevents.EventProtocolReady {
+				s.closeWith(websocket.CloseNormalClosure, "protocol is ready")
+				return
+			}
+		}
+	}
+}
+
+// forwardEvents turns task events into server frames. If the broker drops
+// the session as lagging, the connection is closed like a slow reader in
+// writeLoop: the recording waits for the client to reconnect.
+func (s *session) forwardEvents(events <-chan taskevents.Event) {
+	defer func() {
+		select {
+		case <-s.done:
+		default:
+			s.log.Warn("Task events are lagging, closing websocket")
+			s.closeWith(websocket.CloseTryAgainLater, "events are lagging")
+		}
+	}()
+
+	for event := range events {
+		s.push(ServerMessage{
+			Type:          event.Type,
+			Status:        event.Status,
+			Progress:      event.Progress,
+			ShortProtocol: event.ShortProtocol,
+			FullProtocol:  event.FullProtocol,
+		})
+	}
+}
+
+// closeWith tells the client why the session ends and drops the connection.
+// WriteControl may be called concurrently with writeLoop.
+func (s *session) closeWith(code int, reason string) {
+	s.log.Info("Closing websocket", slog.Int("code", code), slog.String("reason", reason))
+
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := s.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeWriteTimeout)); err != nil {
+		s.log.Debug("Failed to send close frame", slog.String("error", err.Error()))
+	}
+	s.conn.Close()
+}
+
+func (s *session) push(msg ServerMessage) {
+	msg.TaskId = s.taskId
+
+	// если клиент медленно читает, буфер заполняется и чтение аудио встаёт
+	select {
+	case s.send <- msg:
+	case <-s.done:
+	case <-s.writerDone:
+	}
+}
+
+func (s *session) ack(what string) {
+	s.push(ServerMessage{Type: ServerAck, Ack: what, State: s.state, Bytes: s.bytes})
+}
+
+func (s *session) fail(code, message string) {
+	s.push(ServerMessage{
+		Type:  ServerError,
+		State: s.state,
+		Bytes: s.bytes,
+		Error: &ErrorBody{Code: code, Message: message},
+	})
+}
+
+func (s *session) handleControl(data []byte) {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.fail(ErrCodeBadMessage, "control message must be JSON")
+		return
+	}
+
+	switch msg.Type {
+	case ClientStart:
+		if s.state != StateIdle {
+			s.fail(ErrCodeBadState, fmt.Sprintf("cannot start in state %s", s.state))
+			return
+		}
+		if err := msg.Format.Validate(); err != nil {
+			s.fail(ErrCodeBadFormat, err.Error())
+			return
+		}
+		s.format = msg.Format
+		s.track.SetFormat(s.format)
+		if s.format.IsPCM() {
+			if err := s.writeWAVHeader(); err != nil {
+				s.log.Error("Failed to write WAV header", slog.String("error", err.Error()))
+				s.fail(ErrCodeWriteFailed, "failed to write audio")
+				return
+			}
+		}
+		s.state = StateRecording
+	case ClientPause:
+		if s.state != StateRecording {
+			s.fail(ErrCodeBadState, fmt.Sprintf("cannot pause in state %s", s.state))
+			return
+		}
+		s.state = StatePaused
+	case ClientResume:
+		if s.state != StatePaused {
+			s.fail(ErrCodeBadState, fmt.Sprintf("cannot resume in state %s", s.state))
+			return
+		}
+		s.state = StateRecording
+	case ClientStop:
+		if s.state == StateStopped {
+			s.fail(ErrCodeBadState, "recording is already stopped")
+			return
+		}
+		s.state = StateStopped
+		s.ack(msg.Type)
+		s.finish()
+		return
+	case ClientMetadata:
+		// метаданные дорожки сохраняются вместе с ней в конце записи
+		s.trackMetadata.Merge(msg.Track)
+		s.metadata.Merge(msg.Metadata)
+		err := s.app.metadataSaver.SaveTaskMetadata(context.Background(), s.taskId, s.metadata)
+		if err != nil {
+			s.log.Error("Failed to save metadata", slog.String("error", err.Error()))
+			s.fail(ErrCodeInternal, "failed to save metadata")
+			return
+		}
+	default:
+		s.fail(ErrCodeBadMessage, fmt.Sprintf("unknown message type %q", msg.Type))
+		return
+	}
+
+	s.ack(msg.Type)
+}
+
+func (s *session) handleAudio(data []byte) error {
+	switch s.state {
+	case StateIdle:
+		// старые клиенты не шлют start
+		s.state = StateRecording
+	case StatePaused:
+		s.fail(ErrCodeBadState, "recording is paused")
+		return nil
+	case StateStopped:
+		s.fail(ErrCodeBadState, "recording is stopped")
+		return nil
+	}
+
+	if err := s.recording.Write(data); err != nil {
+		if _, ok := limitCloseCode(err); ok {
+			// записанное до лимита всё равно обрабатываем
+			s.fail(ErrCodeLimitExceeded, err.Error())
+			s.state = StateStopped
+			s.finish()
+			return err
+		}
+		// записанное уже не собрать, клиент начнёт заново с bytes = 0
+		s.track.Abort()
+		s.aborted = true
+		s.fail(ErrCodeWriteFailed, "failed to write audio")
+		return fmt.Errorf("write error: %w", err)
+	}
+
+	s.bytes += int64(len(data))
+	s.ack("audio")
+
+	if s.detectSilence(data) {
+		s.log.Info("Trailing silence, stopping recording", slog.Int64("bytes", s.bytes))
+		s.state = StateStopped
+		s.push(ServerMessage{Type: ServerAutoStop, State: s.state, Bytes: s.bytes})
+		s.finish()
+	}
+
+	return nil
+}
+
+// detectSilence feeds PCM to the VAD and reports that the speaker stopped talking.
+func (s *session) detectSilence(data []byte) bool {
+	if s.app.vad == nil || !s.format.IsPCM() {
+		return false
+	}
+	if s.detector == nil {
+		s.detector = s.app.vad.NewDetector(s.format.SampleRate, s.format.Channels)
+	}
+
+	s.detector.Write(data)
+	return s.detector.Silent()
+}
+
+// writeWAVHeader puts a placeholder header before raw PCM,
+// the sizes are fixed when the recording is finished.
+func (s *session) writeWAVHeader() error {
+	var header bytes.Buffer
+	if err := audio.WriteWAVHeader(&header, s.format.SampleRate, s.format.Channels, audio.WAVUnknownSize); err != nil {
+		return err
+	}
+
+	return s.recording.Write(header.Bytes())
+}
+
+// finish closes the recording and sends it to processing.
+func (s *session) finish() {
+	s.recording.Detach()
+
+	key := trackKey{taskId: s.taskId, source: s.recording.Source}
+	if err := s.app.finishRecording(key, s.track, s.trackMetadata, s.detector); err != nil {
+		s.fail(ErrCodeInternal, "failed to start processing")
+	}
+}
+
+// limitCloseCode maps a recording limit error to the close code.
+func limitCloseCode(err error) (int, bool) {
+	switch {
+	case errors.Is(err, recordings.ErrMaxBytes):
+		return websocket.CloseMessageTooBig, true
+	case errors.Is(err, recordings.ErrMaxDuration):
+		return websocket.ClosePolicyViolation, true
+	}
+	return 0, false
+}
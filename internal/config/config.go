@@ -16,6 +16,11 @@ type Config struct {
 	Websocket     WebsocketConfig     `yaml:"websocket"`
 	MessageBroker MessageBrokerConfig `yaml:"message_broker"`
 	HTTP          HTTPConfig          `yaml:"HTTP"`
+	Workers       WorkersConfig       `yaml:"workers"`
+	VAD           VADConfig           `yaml:"vad"`
+	Upload        UploadConfig        `yaml:"upload"`
+	Export        ExportConfig        `yaml:"export"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
 }
 
 type GRPCConfig struct {
@@ -24,9 +29,66 @@ type GRPCConfig struct {
 }
 
 type WebsocketConfig struct {
+	// Mount - standalone: свой сервер на Port, http: /ws на роутере HTTP-сервера
+	Mount string `yaml:"mount" env-default:"standalone"`
+	// TLS - для standalone, false - plaintext, когда TLS снимает прокси
+	TLS      bool   `yaml:"tls" env-default:"true"`
 	Port     int    `yaml:"port"`
 	KeyFile  string `yaml:"keyfile"`
 	CertFile string `yaml:"certfile"`
+	// TrustForwardedHeaders - брать адрес клиента и host из X-Forwarded-*, только за прокси;
+	// для standalone, при mount: http действует HTTP.trust_forwarded_headers
+	TrustForwardedHeaders bool `yaml:"trust_forwarded_headers"`
+	// ResumeGracePeriod - сколько ждём переподключения после обрыва, 0 - не ждём
+	ResumeGracePeriod time.Duration `yaml:"resume_grace_period" env-default:"30s"`
+	// AllowedOrigins - откуда можно открывать /ws, "*" - откуда угодно, пусто - только тот же origin
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// лимиты записи, 0 - без лимита
+	MaxSessions          int           `yaml:"max_sessions" env-default:"100"`
+	MaxSources           int           `yaml:"max_sources" env-default:"4"`
+	MaxRecordingDuration time.Duration `yaml:"max_recording_duration" env-default:"4h"`
+	MaxRecordingBytes    int64         `yaml:"max_recording_bytes" env-default:"2147483648"`
+	// keepalive: без pong дольше PongTimeout соединение считается оборванным,
+	// без фреймов от клиента дольше IdleTimeout (кроме паузы) запись завершается
+	PingInterval   time.Duration `yaml:"ping_interval" env-default:"20s"`
+	PongTimeout    time.Duration `yaml:"pong_timeout" env-default:"60s"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout" env-default:"5m"`
+	WriteTimeout   time.Duration `yaml:"write_timeout" env-default:"10s"`
+	MaxMessageSize int64         `yaml:"max_message_size" env-default:"1048576"`
+}
+
+// UploadConfig - куда пишутся записи: stream - сразу в MinIO частями по part_size,
+// disk - во временный файл в temp_dir, который загружается в конце
+type UploadConfig struct {
+	Storage  string `yaml:"storage" env-default:"stream"`
+	PartSize int    `yaml:"part_size" env-default:"5242880"`
+	TempDir  string `yaml:"temp_dir"`
+	// ResumableDir хранит недокачанные /uploads, должен переживать рестарт (по умолчанию temp_dir)
+	ResumableDir    string        `yaml:"resumable_dir"`
+	ResumableExpiry time.Duration `yaml:"resumable_expiry" env-default:"24h"`
+	// лимиты для /loadaudio и /uploads, 0 - без ограничения
+	MaxSize     int64         `yaml:"max_size" env-default:"4294967296"`
+	MaxDuration time.Duration `yaml:"max_duration" env-default:"6h"`
+	// AllowedTypes - MIME-типы по содержимому файла, допускаются маски audio/*
+	AllowedTypes []string `yaml:"allowed_types"`
+}
+
+// ExportConfig - шаблоны экспорта протокола: <name>.md.tmpl и <name>.html.tmpl
+// из templates_dir дополняют и переопределяют встроенные. PDF пишется шрифтом
+// pdf_font (TrueType с нужными алфавитами), без него PDF недоступен
+type ExportConfig struct {
+	TemplatesDir string `yaml:"templates_dir"`
+	PDFFont      string `yaml:"pdf_font"`
+}
+
+// VADConfig - определение речи в PCM/WAV: обрезка тишины и автостоп записи
+type VADConfig struct {
+	Enabled bool `yaml:"enabled" env-default:"true"`
+	// Threshold - уровень в dBFS, тише - тишина
+	Threshold       float64       `yaml:"threshold" env-default:"-45"`
+	FrameDuration   time.Duration `yaml:"frame_duration" env-default:"30ms"`
+	Padding         time.Duration `yaml:"padding" env-default:"500ms"`
+	AutoStopSilence time.Duration `yaml:"auto_stop_silence" env-default:"2m"`
 }
 
 type MessageBrokerConfig struct {
@@ -35,9 +97,35 @@ type MessageBrokerConfig struct {
 	ProcessQueue    string `yaml:"process_queue"`
 }
 
+// WorkersConfig - как задачи доходят до воркеров: push - RabbitMQ, pull - пул gRPC,
+// both - пул, а не взятая за push_fallback задача уходит в RabbitMQ
+type WorkersConfig struct {
+	Dispatch     string        `yaml:"dispatch" env-default:"push"`
+	LeaseTimeout time.Duration `yaml:"lease_timeout" env-default:"5m"`
+	MaxLeaseWait time.Duration `yaml:"max_lease_wait" env-default:"30s"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	PushFallback time.Duration `yaml:"push_fallback" env-default:"2m"`
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"5"`
+}
+
+// WebhooksConfig - доставка вебхуков: после неудачи попытка повторяется
+// через backoff, 2*backoff, ... (не больше max_backoff), всего max_attempts раз
+type WebhooksConfig struct {
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"8"`
+	Backoff      time.Duration `yaml:"backoff" env-default:"30s"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"1h"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"10s"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"5s"`
+}
+
 type HTTPConfig struct {
 	Address  string        `yaml:"address"`
 	TokenTTL time.Duration `yaml:"tokenTTL"`
+	// TrustForwardedHeaders - как у websocket, для всех маршрутов HTTP-сервера, в том числе /ws при mount: http
+	TrustForwardedHeaders bool `yaml:"trust_forwarded_headers"`
+	// RequireRevision - /updateprotocol без If-Match и base_revision отклоняется с 428,
+	// false - такая правка сохраняется поверх любой ревизии
+	RequireRevision bool `yaml:"require_revision" env-default:"true"`
 }
 
 func MustLoad() *Config {
@@ -55,6 +143,10 @@ func MustLoad() *Config {
 		panic("failed to read config: " + err.Error())
 	}
 
+	if err := cfg.Validate(); err != nil {
+		panic("invalid config: " + err.Error())
+	}
+
 	err := godotenv.Load(fmt.Sprintf(".env.%s", cfg.Env))
 	if err != nil {
 		panic("failed to load environment variables:  " + err.Error())
@@ -63,6 +155,20 @@ func MustLoad() *Config {
 	return &cfg
 }
 
+// Validate rejects values that would otherwise silently turn a feature off.
+func (c *Config) Validate() error {
+	switch c.Workers.Dispatch {
+	case "push", "pull", "both":
+	default:
+		return fmt.Errorf("workers.dispatch must be push, pull or both, got %q", c.Workers.Dispatch)
+	}
+	if c.Workers.MaxAttempts < 1 {
+		return fmt.Errorf("workers.max_attempts must be at least 1, got %d", c.Workers.MaxAttempts)
+	}
+
+	return nil
+}
+
 func fetchConfigPath() string {
 	var res string
 
@@ -0,0 +1,35 @@
+package rabbitmodels
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job kinds match the two worker pipelines: ASR and NLP.
+const (
+	JobKindTranscribe = "transcribe"
+	JobKindProtocol   = "protocol"
+)
+
+const (
+	JobStatePending = "pending"
+	JobStateLeased  = "leased"
+	JobStateDone    = "done"
+	// JobStatePushed - задачу никто не взял из пула, она ушла в RabbitMQ (dispatch both)
+	JobStatePushed = "pushed"
+	// JobStateFailed - попытки кончились, задача больше не выдаётся
+	JobStateFailed = "failed"
+)
+
+// Job is a unit of work in the pull pool. Payload holds the same JSON body
+// that push workers receive from RabbitMQ (TranscribeRequest or ProtocolRequest).
+type Job struct {
+	Id             int64           `json:"job_id"`
+	TaskId         int32           `json:"task_id"`
+	Kind           string          `json:"kind"`
+	Payload        json.RawMessage `json:"payload"`
+	LeaseId        string          `json:"lease_id"`
+	WorkerId       string          `json:"worker_id"`
+	LeaseExpiresAt time.Time       `json:"lease_expires_at"`
+	Attempts       int             `json:"attempts"`
+}
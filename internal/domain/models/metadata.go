@@ -0,0 +1,27 @@
+package rabbitmodels
+
+// TaskMetadata describes the meeting a task was recorded at.
+// It is filled by the client and by the backend while processing.
+type TaskMetadata struct {
+	Title        string            `json:"title,omitempty"`
+	Participants []string          `json:"participants,omitempty"`
+	Extra        map[string]string `json:"extra,omitempty"`
+	// SpeechDurationSeconds считает бэкенд по PCM/WAV, Merge его не трогает
+	SpeechDurationSeconds float64 `json:"speech_duration_seconds,omitempty"`
+}
+
+// Merge overrides fields that are set in other, extra keys are merged.
+func (m *TaskMetadata) Merge(other TaskMetadata) {
+	if other.Title != "" {
+		m.Title = other.Title
+	}
+	if len(other.Participants) > 0 {
+		m.Participants = other.Participants
+	}
+	if len(other.Extra) > 0 && m.Extra == nil {
+		m.Extra = make(map[string]string, len(other.Extra))
+	}
+	for key, value := range other.Extra {
+		m.Extra[key] = value
+	}
+}
@@ -0,0 +1,39 @@
+package rabbitmodels
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ObjectRef points to an object in MinIO. It is stored instead of presigned
+// URLs, which expire, links are presigned when the object is served.
+type ObjectRef struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+func (o ObjectRef) IsZero() bool {
+	return o.Key == ""
+}
+
+// ObjectRefFromLink takes the bucket and the key from a path-style presigned
+// URL (http://host/bucket/key?X-Amz-...), as links were stored before
+// ObjectRef. The key is percent-decoded.
+func ObjectRefFromLink(link string) (ObjectRef, bool) {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" {
+		return ObjectRef{}, false
+	}
+
+	path, err := url.PathUnescape(parsed.EscapedPath())
+	if err != nil {
+		return ObjectRef{}, false
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if bucket == "" || key == "" {
+		return ObjectRef{}, false
+	}
+
+	return ObjectRef{Bucket: bucket, Key: key}, true
+}
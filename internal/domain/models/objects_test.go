@@ -0,0 +1,44 @@
+package rabbitmodels
+
+import "testing"
+
+func TestObjectRefFromLink(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want ObjectRef
+		ok   bool
+	}{
+		{
+			name: "presigned",
+			link: "http://minio:9000/audio/audio_12_main.wav?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Expires=3600",
+			want: ObjectRef{Bucket: "audio", Key: "audio_12_main.wav"},
+			ok:   true,
+		},
+		{
+			name: "escaped key",
+			link: "http://minio:9000/audio/%D0%B7%D0%B0%D0%BF%D0%B8%D1%81%D1%8C%201.ogg?X-Amz-Expires=3600",
+			want: ObjectRef{Bucket: "audio", Key: "запись 1.ogg"},
+			ok:   true,
+		},
+		{
+			name: "key with slashes",
+			link: "https://minio.local/audio/tasks/12/full%2Btext.txt",
+			want: ObjectRef{Bucket: "audio", Key: "tasks/12/full+text.txt"},
+			ok:   true,
+		},
+		{name: "no key", link: "http://minio:9000/audio/", ok: false},
+		{name: "not a url", link: "audio/audio_12_main.wav", ok: false},
+		{name: "bad escape", link: "http://minio:9000/audio/%zz", ok: false},
+		{name: "empty", link: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ObjectRefFromLink(tt.link)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ObjectRefFromLink(%q) = %+v, %v, want %+v, %v", tt.link, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package rabbitmodels
+
+import "time"
+
+// TaskProgress is the latest progress a worker reported for a task.
+type TaskProgress struct {
+	TaskId     int32     `json:"task_id"`
+	Percent    float64   `json:"percent"`
+	EtaSeconds int64     `json:"eta_seconds"`
+	Stage      string    `json:"stage"`
+	Message    string    `json:"message,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -1,11 +1,16 @@
 package rabbitmodels
 
+// TranscribeRequest carries every track of the task. AudioFileLink and
+// ContentType repeat the first track for workers that know only one file.
 type TranscribeRequest struct {
 	TaskId        int32
 	AudioFileLink string
+	ContentType   string
+	Tracks        []Track
 }
 
 type ProtocolRequest struct {
 	TaskId          int32
 	TranscribedText string
+	Language        string
 }
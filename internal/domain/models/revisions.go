@@ -0,0 +1,29 @@
+package rabbitmodels
+
+import "time"
+
+// Откуда взялась ревизия протокола.
+const (
+	RevisionSourceNLP    = "nlp"
+	RevisionSourceEdit   = "edit"
+	RevisionSourceRevert = "revert"
+	// RevisionSourceLegacy - протокол, сохранённый до появления ревизий
+	RevisionSourceLegacy = "legacy"
+)
+
+// AnyRevision as the base of a change skips the check that the change is
+// made on top of the current revision.
+const AnyRevision = -1
+
+// ProtocolRevision is one saved version of the short protocol. Revisions
+// are numbered from 1 per task, the last one is the current protocol.
+type ProtocolRevision struct {
+	TaskId int32  `json:"task_id"`
+	Number int    `json:"revision"`
+	Source string `json:"source"`
+	Author string `json:"author,omitempty"`
+	// RevertedFrom - номер ревизии, содержимое которой восстановлено
+	RevertedFrom int       `json:"reverted_from,omitempty"`
+	Object       ObjectRef `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,51 @@
+package rabbitmodels
+
+import "time"
+
+// Какой текст задачи проиндексирован для поиска.
+const (
+	SearchKindTranscript = "transcript"
+	SearchKindProtocol   = "protocol"
+)
+
+func ValidSearchKind(kind string) bool {
+	return kind == SearchKindTranscript || kind == SearchKindProtocol
+}
+
+// SearchDocument is the indexed text of a task, one per kind.
+type SearchDocument struct {
+	TaskId    int32
+	Kind      string
+	Body      string
+	UpdatedAt time.Time
+}
+
+// SearchFilter selects documents for a search, zero fields are not applied.
+type SearchFilter struct {
+	// Match - запрос в синтаксисе MATCH ... IN BOOLEAN MODE
+	Match string
+	// TaskId ограничивает поиск одной задачей (доступ по JWT задачи)
+	TaskId   int32
+	Kinds    []string
+	Statuses []string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// SearchHit is a found document with the matched fragment of its text.
+type SearchHit struct {
+	TaskId    int32      `json:"task_id"`
+	Kind      string     `json:"kind"`
+	Status    string     `json:"status"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Score     float64    `json:"score"`
+	Snippet   string     `json:"snippet"`
+	// Highlighted - тот же фрагмент, экранированный для HTML, совпадения в <mark>
+	Highlighted string `json:"highlighted"`
+	// Highlights - совпадения в Snippet, [начало, конец) в символах
+	Highlights [][2]int  `json:"highlights"`
+	Body       string    `json:"-"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
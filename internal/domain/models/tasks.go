@@ -0,0 +1,33 @@
+package rabbitmodels
+
+import "time"
+
+// TaskFilter selects tasks for listing, zero fields are not applied.
+type TaskFilter struct {
+	// TaskId ограничивает выборку одной задачей (доступ по JWT задачи)
+	TaskId   int32
+	Statuses []string
+	Source   string
+	From     time.Time
+	To       time.Time
+	// AfterId - курсор: id последней задачи предыдущей страницы
+	AfterId   int32
+	Ascending bool
+	Limit     int
+}
+
+// TaskSummary is a task as it is shown in listings.
+type TaskSummary struct {
+	Id        int32        `json:"id"`
+	Status    string       `json:"status"`
+	Language  string       `json:"language,omitempty"`
+	CreatedAt *time.Time   `json:"created_at,omitempty"`
+	Sources   []string     `json:"sources,omitempty"`
+	Metadata  TaskMetadata `json:"metadata"`
+}
+
+// TranscriptSummary describes the stored transcript without its segments.
+type TranscriptSummary struct {
+	Segments        int     `json:"segments"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
@@ -0,0 +1,54 @@
+package rabbitmodels
+
+import "regexp"
+
+// Одна задача может записываться с нескольких устройств, каждое - отдельная дорожка.
+const (
+	DefaultTrackSource = "main"
+
+	TrackStateRecording = "recording"
+	TrackStateUploaded  = "uploaded"
+)
+
+var trackSourcePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidTrackSource reports whether the source name is safe to use in file and object names.
+func ValidTrackSource(source string) bool {
+	return trackSourcePattern.MatchString(source)
+}
+
+// TrackMetadata describes the device a track was recorded with.
+type TrackMetadata struct {
+	Label  string            `json:"label,omitempty"`
+	Device string            `json:"device,omitempty"`
+	Extra  map[string]string `json:"extra,omitempty"`
+	// SpeechDurationSeconds считает бэкенд по PCM/WAV
+	SpeechDurationSeconds float64 `json:"speech_duration_seconds,omitempty"`
+}
+
+// Merge overrides fields that are set in other, extra keys are merged.
+func (m *TrackMetadata) Merge(other TrackMetadata) {
+	if other.Label != "" {
+		m.Label = other.Label
+	}
+	if other.Device != "" {
+		m.Device = other.Device
+	}
+	if len(other.Extra) > 0 && m.Extra == nil {
+		m.Extra = make(map[string]string, len(other.Extra))
+	}
+	for key, value := range other.Extra {
+		m.Extra[key] = value
+	}
+}
+
+type Track struct {
+	Source string
+	State  string
+	Object ObjectRef
+	// AudioFileLink - в задании воркеру свежая presigned-ссылка на Object,
+	// в ответах API - путь /tasks/{id}/audio; в БД не хранится
+	AudioFileLink string
+	ContentType   string
+	Metadata      TrackMetadata
+}
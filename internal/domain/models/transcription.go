@@ -0,0 +1,62 @@
+package rabbitmodels
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type TranscriptionWord struct {
+	Word       string  `json:"word"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Confidence float64 `json:"confidence"`
+}
+
+type TranscriptionSegment struct {
+	Start      float64             `json:"start"`
+	End        float64             `json:"end"`
+	Speaker    string              `json:"speaker,omitempty"`
+	Text       string              `json:"text"`
+	Confidence float64             `json:"confidence"`
+	Words      []TranscriptionWord `json:"words,omitempty"`
+}
+
+// TranscriptionResult is what ASR workers report back for a task.
+// Old workers only send plain text, in that case Segments is empty.
+type TranscriptionResult struct {
+	Language string                 `json:"language,omitempty"`
+	Text     string                 `json:"text"`
+	Segments []TranscriptionSegment `json:"segments,omitempty"`
+}
+
+// FullText returns Text or, if the worker did not fill it, joins segment texts.
+func (r TranscriptionResult) FullText() string {
+	if r.Text != "" || len(r.Segments) == 0 {
+		return r.Text
+	}
+
+	parts := make([]string, 0, len(r.Segments))
+	for _, segment := range r.Segments {
+		if segment.Speaker != "" {
+			parts = append(parts, segment.Speaker+": "+segment.Text)
+		} else {
+			parts = append(parts, segment.Text)
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// ParseTranscriptionResult accepts both the structured JSON result
+// (text, language, segments) and the legacy plain text result.
+func ParseTranscriptionResult(raw string) TranscriptionResult {
+	trimmed := strings.TrimSpace(raw)
+	if strings.HasPrefix(trimmed, "{") {
+		var result TranscriptionResult
+		if err := json.Unmarshal([]byte(trimmed), &result); err == nil {
+			return result
+		}
+	}
+
+	return TranscriptionResult{Text: raw}
+}
@@ -0,0 +1,27 @@
+package rabbitmodels
+
+import "time"
+
+// Состояния resumable-загрузки: части принимаются, пока загрузка в uploading,
+// processing ставится ровно один раз, когда пришёл последний байт.
+const (
+	UploadStateUploading  = "uploading"
+	UploadStateProcessing = "processing"
+	UploadStateFinished   = "finished"
+	UploadStateFailed     = "failed"
+)
+
+// Upload is a resumable upload of one track. Offset is the number of bytes
+// stored so far, the upload is complete when it reaches Length.
+type Upload struct {
+	Id          string    `json:"id"`
+	TaskId      int32     `json:"task_id"`
+	Source      string    `json:"source"`
+	Filename    string    `json:"filename,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Length      int64     `json:"length"`
+	Offset      int64     `json:"offset"`
+	State       string    `json:"state"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
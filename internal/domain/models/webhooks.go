@@ -0,0 +1,54 @@
+package rabbitmodels
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Состояния доставки вебхука: pending ждёт очередной попытки, failed - попытки кончились.
+const (
+	DeliveryStatePending   = "pending"
+	DeliveryStateDelivered = "delivered"
+	DeliveryStateFailed    = "failed"
+)
+
+// Webhook is a subscription to task events. TaskId 0 subscribes to every task,
+// empty Events to every event type.
+type Webhook struct {
+	Id        int64     `json:"id"`
+	TaskId    int32     `json:"task_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (w Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent to one webhook, together with the
+// outcome of the last attempt. A manual redelivery is a new delivery.
+type WebhookDelivery struct {
+	Id             int64           `json:"id"`
+	WebhookId      int64           `json:"webhook_id"`
+	TaskId         int32           `json:"task_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	State          string          `json:"state"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	RedeliveryOf   int64           `json:"redelivery_of,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
@@ -3,13 +3,14 @@ package transcribeserver
 import (
 	"context"
 	"fmt"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
 
 	msu_loggingv1 "github.com/makarmolochaev/msu-logging-protos/gen/go/msu-logging"
 	"google.golang.org/grpc"
 )
 
 type AudioProcessor interface {
-	WhenAudioTranscribed(taskId int32, transcribedText string) error
+	WhenAudioTranscribed(taskId int32, result rabbitmodels.TranscriptionResult) error
 	WhenProtocolIsReady(taskId int32, protocolText string) error
 }
 
@@ -35,7 +36,7 @@ func (s *serverAPI) SendTranscribeResult(
 	fmt.Println("Recieved gRPC message SendTranscribeResult")
 
 	if req.GetSuccess() {
-		err := s.audio_service.WhenAudioTranscribed(req.GetTaskId(), req.GetResult())
+		err := s.audio_service.WhenAudioTranscribed(req.GetTaskId(), rabbitmodels.ParseTranscriptionResult(req.GetResult()))
 		if err == nil {
 			return &msu_loggingv1.Result{Success: true}, nil
 		}
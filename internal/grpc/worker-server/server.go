@@ -0,0 +1,305 @@
+package workerserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/services/audioservice"
+	"msu-logging-backend/internal/services/leaseservice"
+	"msu-logging-backend/internal/storage"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type LeaseTaskRequest struct {
+	WorkerId    string   `json:"worker_id"`
+	Kinds       []string `json:"kinds"`
+	WaitSeconds int32    `json:"wait_seconds"`
+}
+
+type LeaseTaskResponse struct {
+	Found          bool            `json:"found"`
+	JobId          int64           `json:"job_id,omitempty"`
+	LeaseId        string          `json:"lease_id,omitempty"`
+	TaskId         int32           `json:"task_id,omitempty"`
+	Kind           string          `json:"kind,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	LeaseExpiresAt time.Time       `json:"lease_expires_at,omitempty"`
+}
+
+type RenewLeaseRequest struct {
+	JobId   int64  `json:"job_id"`
+	LeaseId string `json:"lease_id"`
+}
+
+type RenewLeaseResponse struct {
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// CompleteTaskRequest carries the same result as TranscribeResult/ProtocolResult:
+// plain text, or structured JSON for transcriptions.
+type CompleteTaskRequest struct {
+	JobId   int64  `json:"job_id"`
+	LeaseId string `json:"lease_id"`
+	Success bool   `json:"success"`
+	Result  string `json:"result"`
+}
+
+// ReportProgressRequest of a pull worker is addressed by JobId and LeaseId
+// and accepted while the lease is held, TaskId is optional then and must be
+// the task of the job. A push worker has no lease and sends only TaskId.
+type ReportProgressRequest struct {
+	JobId      int64   `json:"job_id"`
+	LeaseId    string  `json:"lease_id"`
+	TaskId     int32   `json:"task_id"`
+	Percent    float64 `json:"percent"`
+	EtaSeconds int64   `json:"eta_seconds"`
+	Stage      string  `json:"stage"`
+	Message    string  `json:"message"`
+}
+
+type Result struct {
+	Success bool `json:"success"`
+}
+
+type WorkerServer interface {
+	LeaseTask(ctx context.Context, req *LeaseTaskRequest) (*LeaseTaskResponse, error)
+	RenewLease(ctx context.Context, req *RenewLeaseRequest) (*RenewLeaseResponse, error)
+	CompleteTask(ctx context.Context, req *CompleteTaskRequest) (*Result, error)
+	ReportProgress(ctx context.Context, req *ReportProgressRequest) (*Result, error)
+}
+
+type LeaseProvider interface {
+	LeaseTask(ctx context.Context, workerId string, kinds []string, wait time.Duration) (rabbitmodels.Job, bool, error)
+	RenewLease(ctx context.Context, jobId int64, leaseId string) (time.Time, error)
+	CompleteTask(ctx context.Context, jobId int64, leaseId string, success bool, result string) error
+	LeasedJob(ctx context.Context, jobId int64, leaseId string) (rabbitmodels.Job, error)
+}
+
+type ProgressReporter interface {
+	ReportProgress(taskId int32, progress rabbitmodels.TaskProgress) error
+	ReportPushProgress(ctx context.Context, taskId int32, progress rabbitmodels.TaskProgress) error
+}
+
+type serverAPI struct {
+	log           *slog.Logger
+	lease_service LeaseProvider
+	audio_service ProgressReporter
+}
+
+func Register(gRPC *grpc.Server, log *slog.Logger, lease_service LeaseProvider, audio_service ProgressReporter) {
+	gRPC.RegisterService(&workerServiceDesc, &serverAPI{
+		log:           log,
+		lease_service: lease_service,
+		audio_service: audio_service,
+	})
+}
+
+func (s *serverAPI) LeaseTask(
+	ctx context.Context,
+	req *LeaseTaskRequest,
+) (*LeaseTaskResponse, error) {
+	if req.WorkerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "worker_id is required")
+	}
+
+	job, ok, err := s.lease_service.LeaseTask(ctx, req.WorkerId, req.Kinds, time.Duration(req.WaitSeconds)*time.Second)
+	if err != nil {
+		if errors.Is(err, leaseservice.ErrUnknownJobKind) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to lease task")
+	}
+	if !ok {
+		return &LeaseTaskResponse{Found: false}, nil
+	}
+
+	return &LeaseTaskResponse{
+		Found:          true,
+		JobId:          job.Id,
+		LeaseId:        job.LeaseId,
+		TaskId:         job.TaskId,
+		Kind:           job.Kind,
+		Payload:        job.Payload,
+		LeaseExpiresAt: job.LeaseExpiresAt,
+	}, nil
+}
+
+func (s *serverAPI) RenewLease(
+	ctx context.Context,
+	req *RenewLeaseRequest,
+) (*RenewLeaseResponse, error) {
+	expiresAt, err := s.lease_service.RenewLease(ctx, req.JobId, req.LeaseId)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "lease is lost or expired")
+	}
+
+	return &RenewLeaseResponse{LeaseExpiresAt: expiresAt}, nil
+}
+
+func (s *serverAPI) CompleteTask(
+	ctx context.Context,
+	req *CompleteTaskRequest,
+) (*Result, error) {
+	const op = "workerserver.CompleteTask"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("job_id", req.JobId),
+	)
+
+	log.Debug("Received CompleteTask", slog.Bool("success", req.Success))
+
+	err := s.lease_service.CompleteTask(ctx, req.JobId, req.LeaseId, req.Success, req.Result)
+	if err != nil {
+		log.Error("Failed to complete task", slog.String("error", err.Error()))
+		return &Result{Success: false}, nil
+	}
+
+	return &Result{Success: true}, nil
+}
+
+// ReportProgress is used by both push and pull workers. A pull worker
+// addresses the task by its lease like in CompleteTask, a push worker by
+// the task id, which is accepted only while the task is pushed and processing.
+func (s *serverAPI) ReportProgress(
+	ctx context.Context,
+	req *ReportProgressRequest,
+) (*Result, error) {
+	const op = "workerserver.ReportProgress"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("job_id", req.JobId),
+		slog.Int("task_id", int(req.TaskId)),
+	)
+
+	if req.Percent < 0 || req.Percent > 100 {
+		return nil, status.Error(codes.InvalidArgument, "percent must be between 0 and 100")
+	}
+
+	progress := rabbitmodels.TaskProgress{
+		Percent:    req.Percent,
+		EtaSeconds: req.EtaSeconds,
+		Stage:      req.Stage,
+		Message:    req.Message,
+	}
+
+	if req.JobId == 0 && req.LeaseId == "" {
+		if req.TaskId <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "task_id or job_id and lease_id are required")
+		}
+
+		err := s.audio_service.ReportPushProgress(ctx, req.TaskId, progress)
+		switch {
+		case errors.Is(err, storage.ErrTaskNotFound):
+			return nil, status.Error(codes.NotFound, "task not found")
+		case errors.Is(err, audioservice.ErrNotPushed):
+			log.Warn("Progress for a task that is not pushed", slog.String("error", err.Error()))
+			return nil, status.Error(codes.FailedPrecondition, "task is not processed by a push worker, report by lease")
+		case err != nil:
+			return &Result{Success: false}, nil
+		}
+
+		return &Result{Success: true}, nil
+	}
+
+	if req.JobId <= 0 || req.LeaseId == "" {
+		return nil, status.Error(codes.InvalidArgument, "job_id and lease_id are required together")
+	}
+
+	job, err := s.lease_service.LeasedJob(ctx, req.JobId, req.LeaseId)
+	if err != nil {
+		log.Warn("Progress without a lease", slog.String("error", err.Error()))
+		return nil, status.Error(codes.FailedPrecondition, "lease is lost or expired")
+	}
+	if req.TaskId != 0 && req.TaskId != job.TaskId {
+		log.Warn("Progress for another task", slog.Int("job_task_id", int(job.TaskId)))
+		return nil, status.Error(codes.PermissionDenied, "task_id does not match the leased job")
+	}
+
+	err = s.audio_service.ReportProgress(job.TaskId, progress)
+	if err != nil {
+		return &Result{Success: false}, nil
+	}
+
+	return &Result{Success: true}, nil
+}
+
+// workerServiceDesc is written by hand: the service is served with the json codec.
+var workerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "msu_logging.Worker",
+	HandlerType: (*WorkerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "LeaseTask",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				in := new(LeaseTaskRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(WorkerServer).LeaseTask(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/msu_logging.Worker/LeaseTask"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(WorkerServer).LeaseTask(ctx, req.(*LeaseTaskRequest))
+				})
+			},
+		},
+		{
+			MethodName: "RenewLease",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				in := new(RenewLeaseRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(WorkerServer).RenewLease(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/msu_logging.Worker/RenewLease"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(WorkerServer).RenewLease(ctx, req.(*RenewLeaseRequest))
+				})
+			},
+		},
+		{
+			MethodName: "CompleteTask",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				in := new(CompleteTaskRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(WorkerServer).CompleteTask(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/msu_logging.Worker/CompleteTask"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(WorkerServer).CompleteTask(ctx, req.(*CompleteTaskRequest))
+				})
+			},
+		},
+		{
+			MethodName: "ReportProgress",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				in := new(ReportProgressRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(WorkerServer).ReportProgress(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/msu_logging.Worker/ReportProgress"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(WorkerServer).ReportProgress(ctx, req.(*ReportProgressRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
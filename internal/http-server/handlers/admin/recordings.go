@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"log/slog"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/services/recordings"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type RecordingsResponse struct {
+	response.Response
+	Recordings []recordings.Info `json:"recordings"`
+}
+
+type RecordingsLister interface {
+	List() []recordings.Info
+}
+
+func NewActiveRecordingsHandler(log *slog.Logger, lister RecordingsLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.NewActiveRecordingsHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		active := lister.List()
+		log.Info("active recordings listed", slog.Int("count", len(active)))
+
+		render.JSON(w, r, RecordingsResponse{
+			Response:   response.OK(),
+			Recordings: active,
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/services/search"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type Reindexer interface {
+	StartReindex() error
+}
+
+// NewReindexHandler serves POST /admin/search/reindex. The index is rebuilt
+// in the background, progress is only in the logs.
+func NewReindexHandler(log *slog.Logger, reindexer Reindexer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.admin.NewReindexHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		err := reindexer.StartReindex()
+		if errors.Is(err, search.ErrReindexRunning) {
+			response.Fail(w, r, http.StatusConflict, response.CodeConflict, err.Error())
+			return
+		}
+		if err != nil {
+			log.Error("Failed to start reindex", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to start reindex")
+			return
+		}
+
+		log.Info("search reindex started")
+
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, response.OK())
+	}
+}
@@ -0,0 +1,216 @@
+package audiotask
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/links"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/services/taskevents"
+	"msu-logging-backend/internal/storage"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// heartbeatInterval - комментарий в потоке, чтобы прокси не закрывали простаивающее соединение
+	heartbeatInterval = 15 * time.Second
+	// reconnectDelay - через сколько браузер переподключается после обрыва
+	reconnectDelay = 3 * time.Second
+)
+
+type EventSource interface {
+	Subscribe(taskId int32) (<-chan taskevents.Event, func())
+	Since(taskId int32, lastId int64) ([]taskevents.Event, bool)
+	LastId() int64
+}
+
+// NewTaskEventsHandler streams the events of the token's task as Server-Sent
+// Events. A client that reconnects with Last-Event-ID gets the events it
+// missed, or a snapshot of the current state if they are no longer kept, so
+// MySQL is read at most once per connection.
+func NewTaskEventsHandler(log *slog.Logger, events EventSource, taskStatusGetter TaskStatusGetter, protocolGetter ProtocolGetter, progressGetter ProgressGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.audiotask.NewTaskEventsHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
+		if !ok {
+			log.Error("taskId claim not found or invalid")
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
+			return
+		}
+
+		// EventSource шлёт заголовок сам, полифиллы передают id в query
+		lastId, hasLastId := parseLastEventId(r)
+
+		// подписываемся до чтения истории и снимка, повторы отсекаются по id
+		stream, unsubscribe := events.Subscribe(taskId)
+		defer unsubscribe()
+
+		var missed []taskevents.Event
+		complete := false
+		if hasLastId {
+			missed, complete = events.Since(taskId, lastId)
+		}
+
+		var snapshot taskevents.Event
+		if !complete {
+			var err error
+			snapshot, err = taskSnapshot(r, log, events, taskId, taskStatusGetter, protocolGetter, progressGetter)
+			if errors.Is(err, storage.ErrTaskNotFound) {
+				response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "task not found")
+				return
+			}
+			if err != nil {
+				log.Error("Failed to get task state", slog.String("error", err.Error()))
+				response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to get task state")
+				return
+			}
+		}
+
+		controller := http.NewResponseController(w)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		// nginx иначе буферизует поток
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", reconnectDelay.Milliseconds())
+
+		// id неизвестный брокеру (например, из до рестарта) сбрасывается снимком
+		var sent int64
+		if complete {
+			sent = lastId
+		}
+		send := func(event taskevents.Event) error {
+			if event.Id <= sent && event.Type != taskevents.EventSnapshot {
+				return nil
+			}
+			if err := writeEvent(w, event); err != nil {
+				return err
+			}
+			sent = max(sent, event.Id)
+			return controller.Flush()
+		}
+
+		if !complete {
+			missed = []taskevents.Event{snapshot}
+		}
+		for _, event := range missed {
+			if err := send(event); err != nil {
+				log.Debug("Client is gone", slog.String("error", err.Error()))
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-stream:
+				if !ok {
+					// отстали от событий, клиент переподключится с Last-Event-ID
+					log.Warn("Event stream is lagging, closing", slog.Int64("last_event_id", sent))
+					return
+				}
+				if err := send(event); err != nil {
+					log.Debug("Client is gone", slog.String("error", err.Error()))
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+				if err := controller.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// taskSnapshot reads the current state of the task. Its id is the latest
+// event id taken before the read, so events published after it are still sent.
+func taskSnapshot(r *http.Request, log *slog.Logger, events EventSource, taskId int32, taskStatusGetter TaskStatusGetter, protocolGetter ProtocolGetter, progressGetter ProgressGetter) (taskevents.Event, error) {
+	snapshot := taskevents.Event{
+		Id:     events.LastId(),
+		Type:   taskevents.EventSnapshot,
+		TaskId: taskId,
+		Time:   time.Now(),
+	}
+
+	status, err := taskStatusGetter.GetTaskStatusByID(r.Context(), taskId)
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Status = status
+
+	if status != "finished" {
+		progress, found, err := progressGetter.GetTaskProgress(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get task progress", slog.String("error", err.Error()))
+		} else if found {
+			snapshot.Progress = &progress
+		}
+		return snapshot, nil
+	}
+
+	shortProtocol, fullProtocol, err := protocolGetter.GetProtocol(r.Context(), taskId)
+	if err != nil {
+		log.Error("Failed to get protocol", slog.String("error", err.Error()))
+		return snapshot, nil
+	}
+	if revision, err := protocolGetter.GetProtocolRevision(r.Context(), taskId, 0); err == nil {
+		shortProtocol = revision.Object
+	} else if !errors.Is(err, storage.ErrRevisionNotFound) {
+		log.Error("Failed to get protocol revision", slog.String("error", err.Error()))
+	}
+
+	if !shortProtocol.IsZero() {
+		snapshot.ShortProtocol = links.Protocol(taskId)
+	}
+	if !fullProtocol.IsZero() {
+		snapshot.FullProtocol = links.Transcript(taskId)
+	}
+
+	return snapshot, nil
+}
+
+func writeEvent(w http.ResponseWriter, event taskevents.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
+
+func parseLastEventId(r *http.Request) (int64, bool) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+
+	return id, true
+}
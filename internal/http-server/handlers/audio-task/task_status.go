@@ -2,14 +2,16 @@ package audiotask
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
 	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/links"
 	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/storage"
 	"net/http"
 
 	"github.com/go-chi/render"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type Request struct {
@@ -20,6 +22,12 @@ type Response struct {
 	TaskStatus    string `json:"task_status"`
 	FullProtocol  string `json:"full_protocol"`
 	ShortProtocol string `json:"short_protocol"`
+	// ProtocolRevision - ревизия short_protocol, её передают в If-Match при правке
+	ProtocolRevision int                                 `json:"protocol_revision,omitempty"`
+	Language         string                              `json:"language,omitempty"`
+	Segments         []rabbitmodels.TranscriptionSegment `json:"segments,omitempty"`
+	Progress         *rabbitmodels.TaskProgress          `json:"progress,omitempty"`
+	Metadata         *rabbitmodels.TaskMetadata          `json:"metadata,omitempty"`
 }
 
 type TaskStatusGetter interface {
@@ -27,10 +35,23 @@ type TaskStatusGetter interface {
 }
 
 type ProtocolGetter interface {
-	GetProtocol(ctx context.Context, id int32) (string, string, error)
+	GetProtocol(ctx context.Context, id int32) (rabbitmodels.ObjectRef, rabbitmodels.ObjectRef, error)
+	GetProtocolRevision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, error)
 }
 
-func NewTaskStatusHandler(log *slog.Logger, taskStatusGetter TaskStatusGetter, protocolGetter ProtocolGetter) http.HandlerFunc {
+type TranscriptGetter interface {
+	GetTranscription(ctx context.Context, taskId int32) (rabbitmodels.TranscriptionResult, error)
+}
+
+type ProgressGetter interface {
+	GetTaskProgress(ctx context.Context, taskId int32) (rabbitmodels.TaskProgress, bool, error)
+}
+
+type MetadataGetter interface {
+	GetTaskMetadata(ctx context.Context, taskId int32) (rabbitmodels.TaskMetadata, error)
+}
+
+func NewTaskStatusHandler(log *slog.Logger, taskStatusGetter TaskStatusGetter, protocolGetter ProtocolGetter, transcriptGetter TranscriptGetter, progressGetter ProgressGetter, metadataGetter MetadataGetter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.audiotask.NewTaskStatusHandler"
 
@@ -38,50 +59,84 @@ func NewTaskStatusHandler(log *slog.Logger, taskStatusGetter TaskStatusGetter, p
 			slog.String("op", op),
 		)
 
-		claims, ok := r.Context().Value(mymiddleware.TokenClaimsKey).(jwt.MapClaims)
-
-		if !ok {
-			log.Error("failed to get JWT claims")
-			render.JSON(w, r, response.Error("authentication failed"))
-			return
-		}
-
-		taskClaim, ok := claims["taskId"]
-
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
 		if !ok {
 			log.Error("taskId claim not found or invalid")
-			render.JSON(w, r, response.Error("invalid token"))
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
 			return
 		}
-
-		taskId := int32(taskClaim.(float64))
-		fmt.Println(taskId)
 		taskStatus, err := taskStatusGetter.GetTaskStatusByID(r.Context(), taskId)
 		if err != nil {
 			log.Error("No task with this TaskId")
-			render.JSON(w, r, response.Error("No task with this TaskId"))
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "No task with this TaskId")
 			return
 		}
 
-		shortProtocolText, fullProtocolText, err := protocolGetter.GetProtocol(context.Background(), taskId)
+		shortProtocol, fullProtocol, err := protocolGetter.GetProtocol(context.Background(), taskId)
 		if err != nil {
 			log.Error("No protocol with this TaskId")
 			log.Info(string(taskId))
-			render.JSON(w, r, response.Error("No protocol with this TaskId"))
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "No protocol with this TaskId")
 			return
 		}
 
+		// ссылка и номер ревизии берутся из одной записи, чтобы не разойтись с параллельной правкой
+		var protocolRevision int
+		revision, err := protocolGetter.GetProtocolRevision(r.Context(), taskId, 0)
+		if err == nil {
+			shortProtocol = revision.Object
+			protocolRevision = revision.Number
+		} else if !errors.Is(err, storage.ErrRevisionNotFound) {
+			log.Error("Failed to get protocol revision", slog.String("error", err.Error()))
+		}
+
+		// ссылки на API, а не на MinIO: файлы отдаются только с токеном задачи
+		var shortProtocolText, fullProtocolText string
+		if !shortProtocol.IsZero() {
+			shortProtocolText = links.Protocol(taskId)
+		}
+		if !fullProtocol.IsZero() {
+			fullProtocolText = links.Transcript(taskId)
+		}
+
+		var metadataPtr *rabbitmodels.TaskMetadata
+		metadata, err := metadataGetter.GetTaskMetadata(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get task metadata", slog.String("error", err.Error()))
+		} else {
+			metadataPtr = &metadata
+		}
+
 		if taskStatus == "finished" {
+			transcript, err := transcriptGetter.GetTranscription(r.Context(), taskId)
+			if err != nil {
+				log.Error("Failed to get transcript segments", slog.String("error", err.Error()))
+			}
+
 			render.JSON(w, r, Response{
-				Response:      response.OK(),
-				TaskStatus:    taskStatus,
-				FullProtocol:  fullProtocolText,
-				ShortProtocol: shortProtocolText,
+				Response:         response.OK(),
+				TaskStatus:       taskStatus,
+				FullProtocol:     fullProtocolText,
+				ShortProtocol:    shortProtocolText,
+				ProtocolRevision: protocolRevision,
+				Language:         transcript.Language,
+				Segments:         transcript.Segments,
+				Metadata:         metadataPtr,
 			})
 		} else {
+			var progressPtr *rabbitmodels.TaskProgress
+			progress, found, err := progressGetter.GetTaskProgress(r.Context(), taskId)
+			if err != nil {
+				log.Error("Failed to get task progress", slog.String("error", err.Error()))
+			} else if found {
+				progressPtr = &progress
+			}
+
 			render.JSON(w, r, Response{
 				Response:   response.OK(),
 				TaskStatus: taskStatus,
+				Progress:   progressPtr,
+				Metadata:   metadataPtr,
 			})
 		}
 	}
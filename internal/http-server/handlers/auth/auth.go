@@ -33,7 +33,7 @@ func NewTokenHandler(log *slog.Logger, taskStatusCreater TaskStatusCreater, toke
 		taskId, err := taskStatusCreater.CreateNewTaskStatus(context.Background())
 		if err != nil {
 			log.Error("Failed to save task_status in DB", slog.String("error", err.Error()))
-			render.JSON(w, r, response.Error("Failed to save task_status in DB"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to save task_status in DB")
 			return
 		}
 
@@ -42,14 +42,14 @@ func NewTokenHandler(log *slog.Logger, taskStatusCreater TaskStatusCreater, toke
 
 		if err != nil {
 			log.Error("Failed to generate token", slog.String("error", err.Error()))
-			render.JSON(w, r, response.Error("Failed to generate token"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to generate token")
 			return
 		}
 
 		err = taskStatusCreater.CreateNewProtocol(context.Background(), taskId)
 		if err != nil {
 			log.Error("Failed to save protocol placeholder in DB", slog.String("error", err.Error()))
-			render.JSON(w, r, response.Error("Failed to save protocol placeholder in DB"))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to save protocol placeholder in DB")
 			return
 		}
 
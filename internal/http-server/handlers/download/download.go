@@ -0,0 +1,168 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/etag"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/storage"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type ObjectOpener interface {
+	OpenObject(ctx context.Context, object rabbitmodels.ObjectRef) (io.ReadSeekCloser, minioapp.ObjectInfo, error)
+}
+
+type TrackGetter interface {
+	GetTracks(ctx context.Context, taskId int32) ([]rabbitmodels.Track, error)
+}
+
+type ProtocolGetter interface {
+	GetProtocol(ctx context.Context, id int32) (rabbitmodels.ObjectRef, rabbitmodels.ObjectRef, error)
+}
+
+type RevisionGetter interface {
+	GetProtocolRevision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, error)
+}
+
+// NewAudioHandler serves GET /tasks/{id}/audio?source=, without source the
+// first track of the task is returned.
+func NewAudioHandler(log *slog.Logger, trackGetter TrackGetter, opener ObjectOpener) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.download.NewAudioHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		tracks, err := trackGetter.GetTracks(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get tracks", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to get tracks")
+			return
+		}
+
+		source := r.URL.Query().Get("source")
+		var track *rabbitmodels.Track
+		for i := range tracks {
+			if tracks[i].State != rabbitmodels.TrackStateUploaded {
+				continue
+			}
+			if source == "" || tracks[i].Source == source {
+				track = &tracks[i]
+				break
+			}
+		}
+		if track == nil {
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "audio not found")
+			return
+		}
+
+		filename := fmt.Sprintf("task_%d_%s%s", taskId, track.Source, path.Ext(track.Object.Key))
+		serveObject(w, r, log, opener, track.Object, filename, "")
+	}
+}
+
+// NewTranscriptHandler serves GET /tasks/{id}/transcript.
+func NewTranscriptHandler(log *slog.Logger, protocolGetter ProtocolGetter, opener ObjectOpener) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.download.NewTranscriptHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		_, full, err := protocolGetter.GetProtocol(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get protocol", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "protocol not found")
+			return
+		}
+
+		serveObject(w, r, log, opener, full, fmt.Sprintf("transcript_%d.txt", taskId), "")
+	}
+}
+
+// NewProtocolHandler serves GET /tasks/{id}/protocol. The ETag is the
+// current revision, the one to send back in If-Match with an edit.
+func NewProtocolHandler(log *slog.Logger, revisionGetter RevisionGetter, opener ObjectOpener) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.download.NewProtocolHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		revision, err := revisionGetter.GetProtocolRevision(r.Context(), taskId, 0)
+		if errors.Is(err, storage.ErrRevisionNotFound) {
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "protocol not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to get protocol revision", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to get protocol")
+			return
+		}
+
+		serveObject(w, r, log, opener, revision.Object, fmt.Sprintf("protocol_%d.txt", taskId), etag.Revision(revision.Number))
+	}
+}
+
+// serveObject streams the object. http.ServeContent answers Range,
+// If-None-Match and If-Modified-Since requests using the ETag set here.
+// ?download=1 asks the browser to save the file instead of showing it.
+// An empty entityTag means the object's own ETag.
+func serveObject(w http.ResponseWriter, r *http.Request, log *slog.Logger, opener ObjectOpener, object rabbitmodels.ObjectRef, filename string, entityTag string) {
+	reader, info, err := opener.OpenObject(r.Context(), object)
+	if errors.Is(err, minioapp.ErrObjectNotFound) {
+		response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "file is not ready")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to open object", slog.String("object", object.Key), slog.String("error", err.Error()))
+		response.Fail(w, r, http.StatusBadGateway, response.CodeStorage, "Failed to read file from storage")
+		return
+	}
+	defer reader.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	} else if strings.HasPrefix(contentType, "text/plain") && !strings.Contains(contentType, "charset") {
+		contentType += "; charset=utf-8"
+	}
+
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	// ответ зависит от токена, общим кешам его хранить нельзя
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if entityTag == "" && info.ETag != "" {
+		entityTag = strconv.Quote(info.ETag)
+	}
+	if entityTag != "" {
+		w.Header().Set("ETag", entityTag)
+	}
+
+	http.ServeContent(w, r, filename, info.LastModified, reader)
+}
@@ -0,0 +1,144 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/export"
+	"net/http"
+)
+
+// maxProtocolSize ограничивает текст протокола, который читаем в память для экспорта.
+const maxProtocolSize = 10 << 20
+
+type TaskGetter interface {
+	GetTask(ctx context.Context, taskId int32) (rabbitmodels.TaskSummary, error)
+}
+
+type Exporter interface {
+	Render(w io.Writer, format export.Format, templateName string, doc export.Document) error
+}
+
+// NewExportHandler serves GET /tasks/{id}/protocol/export?format=&template=.
+// Without format the Accept header decides, DOCX if it accepts anything.
+func NewExportHandler(log *slog.Logger, taskGetter TaskGetter, protocolGetter ProtocolGetter, opener ObjectOpener, exporter Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.download.NewExportHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		w.Header().Add("Vary", "Accept")
+
+		format, ok := exportFormat(r)
+		if !ok {
+			response.Fail(w, r, http.StatusNotAcceptable, response.CodeNotAcceptable, fmt.Sprintf("unsupported format, use one of %v", export.Formats))
+			return
+		}
+
+		task, err := taskGetter.GetTask(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get task", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "task not found")
+			return
+		}
+
+		short, _, err := protocolGetter.GetProtocol(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get protocol", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "protocol not found")
+			return
+		}
+
+		protocol, err := readObject(r.Context(), opener, short)
+		if errors.Is(err, minioapp.ErrObjectNotFound) {
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "protocol is not ready")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to read protocol", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusBadGateway, response.CodeStorage, "Failed to read protocol from storage")
+			return
+		}
+
+		doc := export.Document{
+			TaskId:       taskId,
+			Title:        task.Metadata.Title,
+			Participants: task.Metadata.Participants,
+			Language:     task.Language,
+			Extra:        task.Metadata.Extra,
+			Protocol:     protocol,
+		}
+		if doc.Title == "" {
+			doc.Title = fmt.Sprintf("Протокол встречи №%d", taskId)
+		}
+		if task.CreatedAt != nil {
+			doc.Date = *task.CreatedAt
+		}
+
+		// рендерим в память, чтобы ошибка шаблона успела стать статусом ответа
+		var body bytes.Buffer
+		err = exporter.Render(&body, format, r.URL.Query().Get("template"), doc)
+		switch {
+		case errors.Is(err, export.ErrUnknownTemplate):
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		case errors.Is(err, export.ErrPDFNotAvailable):
+			response.Fail(w, r, http.StatusNotImplemented, response.CodeNotImplemented, "PDF export is not configured")
+			return
+		case err != nil:
+			log.Error("Failed to render protocol", slog.String("format", string(format)), slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to render protocol")
+			return
+		}
+
+		filename := fmt.Sprintf("protocol_%d.%s", taskId, format)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Write(body.Bytes())
+	}
+}
+
+func exportFormat(r *http.Request) (export.Format, bool) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		format, err := export.ParseFormat(name)
+		return format, err == nil
+	}
+
+	if format, ok := export.Negotiate(r.Header.Get("Accept")); ok {
+		return format, true
+	}
+
+	accept, _, _ := mime.ParseMediaType(r.Header.Get("Accept"))
+	if accept == "" || accept == "*/*" {
+		return export.FormatDOCX, true
+	}
+	return "", false
+}
+
+func readObject(ctx context.Context, opener ObjectOpener, object rabbitmodels.ObjectRef) (string, error) {
+	reader, _, err := opener.OpenObject(ctx, object)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxProtocolSize))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
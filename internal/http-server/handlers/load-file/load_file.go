@@ -1,83 +1,133 @@
 package loadfile
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
 	mymiddleware "msu-logging-backend/internal/http-server/middleware"
 	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/audio"
 	"msu-logging-backend/internal/services/audioservice"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/go-chi/render"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func NewLoadFileHandler(log *slog.Logger, audioService *audioservice.AudioService) http.HandlerFunc {
+// sniffSize - сколько байт нужно mimetype, чтобы узнать контейнер
+const sniffSize = 3072
+
+// NewLoadFileHandler stores the audioFile part as the default track. The
+// file is checked against limits by content, size and duration before it is
+// queued, a rejected file is aborted and never reaches processing.
+func NewLoadFileHandler(log *slog.Logger, audioService *audioservice.AudioService, limits audio.Limits) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.auth.NewLoadFileHandler"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 		)
 
-		claims, ok := r.Context().Value(mymiddleware.TokenClaimsKey).(jwt.MapClaims)
-		if !ok {
-			log.Error("failed to get JWT claims")
-			render.JSON(w, r, response.Error("authentication failed"))
-			return
-		}
-		taskClaim, ok := claims["taskId"]
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
 		if !ok {
 			log.Error("taskId claim not found or invalid")
-			render.JSON(w, r, response.Error("invalid token"))
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
 			return
 		}
-		taskId := int32(taskClaim.(float64))
-
-		// Ограничиваем размер файла (например, 10 МБ)
-		r.ParseMultipartForm(1 << 30)
 
-		// Получаем файл из запроса
-		file, handler, err := r.FormFile("audioFile")
+		// Читаем multipart по частям, файл целиком не попадает ни в память, ни на диск
+		reader, err := r.MultipartReader()
 		if err != nil {
-			log.Error("Error Retrieving the File")
+			log.Error("Request is not multipart", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "multipart/form-data is required")
 			return
 		}
-		defer file.Close()
 
-		log.Info(fmt.Sprintf("Uploaded File: %+v\n", handler.Filename))
-		log.Info(fmt.Sprintf("File Size: %+v\n", handler.Size))
-		log.Info(fmt.Sprintf("MIME Header: %+v\n", handler.Header))
+		var part *multipart.Part
+		for {
+			part, err = reader.NextPart()
+			if err != nil {
+				log.Error("Error Retrieving the File", slog.String("error", err.Error()))
+				response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "audioFile is required")
+				return
+			}
+			if part.FormName() == "audioFile" {
+				break
+			}
+			part.Close()
+		}
+		defer part.Close()
 
-		// Создаём новый файл на сервере
-		ext := filepath.Ext(handler.Filename)
-		nameWithoutExt := strings.TrimSuffix(handler.Filename, ext)
-		filename := fmt.Sprintf("%v_%v%v", nameWithoutExt, taskId, ext)
+		log.Info(fmt.Sprintf("Uploaded File: %+v\n", part.FileName()))
+		log.Info(fmt.Sprintf("MIME Header: %+v\n", part.Header))
 
-		dst, err := os.Create(filename)
+		// формат проверяем по содержимому до того, как что-то уйдёт в хранилище
+		head := make([]byte, sniffSize)
+		n, err := io.ReadFull(part, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			log.Error("Failed to read file", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "failed to read file")
+			return
+		}
+		head = head[:n]
+
+		contentType := audio.Sniff(head)
+		if err := limits.CheckType(contentType); err != nil {
+			log.Warn("File rejected", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, err.Error())
+			return
+		}
+
+		track, err := audioService.NewTrackWriter(taskId, rabbitmodels.DefaultTrackSource)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("Failed to start upload", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to store file")
 			return
 		}
-		defer dst.Close()
+		track.SetFormat(audio.Format{MimeType: contentType})
 
-		// Копируем содержимое загруженного файла в новый файл
-		if _, err := io.Copy(dst, file); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		var body io.Reader = io.MultiReader(bytes.NewReader(head), part)
+		if limits.MaxSize > 0 {
+			// байт сверх лимита нужен, чтобы отличить файл ровно по лимиту от большего
+			body = io.LimitReader(body, limits.MaxSize+1)
+		}
+
+		probe := &audio.Probe{}
+		size, err := io.Copy(io.MultiWriter(track, probe), body)
+		if err != nil {
+			track.Abort()
+			log.Error("Failed to store file", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to store file")
 			return
 		}
 
-		fmt.Fprintf(w, "Successfully Uploaded File\n")
+		log.Info(fmt.Sprintf("File Size: %+v\n", size))
 
-		err = audioService.StartFileProcessing(taskId, filename)
+		info := probe.Info()
+		if err := limits.Check(info); err != nil {
+			track.Abort()
+			log.Warn("File rejected", slog.String("error", err.Error()))
+			switch {
+			case errors.Is(err, audio.ErrMediaTooLarge):
+				response.Fail(w, r, http.StatusRequestEntityTooLarge, response.CodeTooLarge, err.Error())
+			case errors.Is(err, audio.ErrMediaTooLong):
+				response.Fail(w, r, http.StatusUnprocessableEntity, response.CodeMediaTooLong, err.Error())
+			default:
+				response.Fail(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, err.Error())
+			}
+			return
+		}
+
+		err = track.Finish(rabbitmodels.TrackMetadata{Label: audio.SanitizeFilename(part.FileName())})
 		if err != nil {
-			log.Error("Errpr in file processing")
+			log.Error("Error in file processing", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to process file")
+			return
 		}
 
-		render.JSON(w, r, response.Error("invalid token"))
+		render.JSON(w, r, response.OK())
 	}
 }
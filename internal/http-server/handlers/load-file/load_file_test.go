@@ -0,0 +1,351 @@
+package loadfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/services/audioservice"
+	"msu-logging-backend/internal/services/taskevents"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeS3 keeps objects in memory and understands the calls minioapp makes:
+// PutObject, the multipart upload and listing incomplete uploads.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	// parts - сколько частей было у последней составной загрузки
+	parts int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s := &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	t.Setenv("MINIO_ENDPOINT", strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("MINIO_USER", "user")
+	t.Setenv("MINIO_PASSWORD", "password")
+	t.Setenv("MINIO_BUCKET_NAME", "bucket")
+
+	return s
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = decodeChunked(body)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && query.Has("location"):
+		fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+	case r.Method == http.MethodGet && query.Has("uploads"):
+		fmt.Fprint(w, `<ListMultipartUploadsResult><Bucket>bucket</Bucket><IsTruncated>false</IsTruncated></ListMultipartUploadsResult>`)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadId := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[uploadId] = make(map[int][]byte)
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, key, uploadId)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		s.uploads[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts := s.uploads[query.Get("uploadId")]
+		var object []byte
+		for i, part := range complete.Parts {
+			// S3 требует части по возрастанию номеров
+			if part.PartNumber != i+1 {
+				http.Error(w, "InvalidPartOrder", http.StatusBadRequest)
+				return
+			}
+			object = append(object, parts[part.PartNumber]...)
+		}
+		s.objects[key] = object
+		s.parts = len(complete.Parts)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><ETag>"object"</ETag></CompleteMultipartUploadResult>`, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+		w.Header().Set("ETag", `"object"`)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+// decodeChunked strips the aws-chunked encoding of a streaming signature:
+// "<hex size>;chunk-signature=...\r\n<data>\r\n" up to a chunk of size 0.
+func decodeChunked(body []byte) []byte {
+	var data []byte
+	for {
+		line, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return data
+		}
+		sizeHex, _, _ := bytes.Cut(line, []byte(";"))
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			return data
+		}
+		data = append(data, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+}
+
+func (s *fakeS3) object(t *testing.T) []byte {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.objects) != 1 {
+		t.Fatalf("%d objects stored, want 1", len(s.objects))
+	}
+	for _, object := range s.objects {
+		return object
+	}
+	return nil
+}
+
+// fakeStorage records the saved track, the rest of audioservice.Storage is
+// not called before transcription.
+type fakeStorage struct {
+	audioservice.Storage
+
+	mu       sync.Mutex
+	track    rabbitmodels.Track
+	metadata rabbitmodels.TaskMetadata
+}
+
+func (f *fakeStorage) SaveAudioFile(ctx context.Context, object rabbitmodels.ObjectRef) (int64, error) {
+	return 1, nil
+}
+
+func (f *fakeStorage) SaveTrack(ctx context.Context, taskId int32, track rabbitmodels.Track) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.track = track
+	return nil
+}
+
+func (f *fakeStorage) GetTaskMetadata(ctx context.Context, taskId int32) (rabbitmodels.TaskMetadata, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.metadata, nil
+}
+
+func (f *fakeStorage) SaveTaskMetadata(ctx context.Context, taskId int32, metadata rabbitmodels.TaskMetadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metadata = metadata
+	return nil
+}
+
+// транскрипция уже идёт: startTranscription ничего не отправляет
+func (f *fakeStorage) GetTaskStatusByID(ctx context.Context, id int32) (string, error) {
+	return "transcribing", nil
+}
+
+const testRate = 8000
+
+var testVAD = audio.VAD{
+	Threshold:     -45,
+	FrameDuration: 25 * time.Millisecond,
+	Padding:       100 * time.Millisecond,
+}
+
+// tone is 16 bit mono PCM with a constant level, zero amplitude is silence.
+func tone(amplitude int16, seconds float64) []byte {
+	samples := int(seconds * testRate)
+	data := make([]byte, 2*samples)
+	for i := 0; i < samples; i++ {
+		sample := amplitude
+		if i%2 == 1 {
+			sample = -amplitude
+		}
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+	}
+	return data
+}
+
+// uploadedWAV has a LIST chunk before the data and an id3 chunk after it.
+func uploadedWAV(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var header bytes.Buffer
+	if err := audio.WriteWAVHeader(&header, testRate, 1, uint32(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	var file bytes.Buffer
+	file.Write(header.Bytes()[:36])
+	file.WriteString("LIST\x04\x00\x00\x00INFO")
+	file.Write(header.Bytes()[36:])
+	file.Write(data)
+	file.WriteString("id3 \x04\x00\x00\x00tags")
+	return file.Bytes()
+}
+
+func upload(t *testing.T, storage string, file []byte) (*fakeS3, *fakeStorage, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	s3 := newFakeS3(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	minio := minioapp.New(log)
+	if err := minio.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	vad := testVAD
+	db := &fakeStorage{}
+	service := audioservice.New(log, db, taskevents.New(), nil, minio, nil, nil, nil, audioservice.Config{
+		Storage: storage,
+		TempDir: t.TempDir(),
+		VAD:     &vad,
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("audioFile", "meeting.wav")
+	part.Write(file)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/loadaudio", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r = r.WithContext(context.WithValue(r.Context(), mymiddleware.TokenClaimsKey, jwt.MapClaims{"taskId": float64(7)}))
+
+	w := httptest.NewRecorder()
+	NewLoadFileHandler(log, service, audio.Limits{}).ServeHTTP(w, r)
+
+	return s3, db, w
+}
+
+func TestLoadFileStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		speech float64
+		parts  int
+	}{
+		{name: "one part", speech: 1, parts: 0},
+		// больше MinPartSize: первая часть с заголовком уходит последней
+		{name: "multipart", speech: 400, parts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			speech := tone(1000, tt.speech)
+			file := uploadedWAV(t, bytes.Join([][]byte{tone(0, 2), speech, tone(0, 2)}, nil))
+
+			s3, db, w := upload(t, audioservice.StorageStream, file)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+
+			// тишина обрезана до Padding, чанки кроме fmt и data отброшены
+			padding := tone(0, testVAD.Padding.Seconds())
+			want := canonicalWAV(t, bytes.Join([][]byte{padding, speech, padding}, nil))
+			got := s3.object(t)
+			if !bytes.Equal(got, want) {
+				t.Errorf("stored %d bytes, want %d, header %x", len(got), len(want), got[:min(len(got), 44)])
+			}
+			if s3.parts != tt.parts {
+				t.Errorf("%d parts, want %d", s3.parts, tt.parts)
+			}
+
+			if db.track.ContentType != "audio/wav" || db.track.Metadata.Label != "meeting.wav" {
+				t.Errorf("track = %+v", db.track)
+			}
+			if got := db.track.Metadata.SpeechDurationSeconds; got != tt.speech {
+				t.Errorf("track speech = %v, want %v", got, tt.speech)
+			}
+			if got := db.metadata.SpeechDurationSeconds; got != tt.speech {
+				t.Errorf("task speech = %v, want %v", got, tt.speech)
+			}
+		})
+	}
+}
+
+// Stream and disk storage store the same trimmed file.
+func TestLoadFileStreamMatchesDisk(t *testing.T) {
+	file := uploadedWAV(t, bytes.Join([][]byte{tone(0, 1), tone(1000, 0.5), tone(0, 0.3), tone(1000, 0.5), tone(0, 1)}, nil))
+
+	objects := make(map[string][]byte)
+	for _, storage := range []string{audioservice.StorageStream, audioservice.StorageDisk} {
+		s3, db, w := upload(t, storage, file)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", storage, w.Code, w.Body.String())
+		}
+		if got := db.track.Metadata.SpeechDurationSeconds; got != 1 {
+			t.Errorf("%s: speech = %v, want 1", storage, got)
+		}
+		objects[storage] = s3.object(t)
+	}
+
+	if !bytes.Equal(objects[audioservice.StorageStream], objects[audioservice.StorageDisk]) {
+		t.Errorf("stream stored %d bytes, disk %d", len(objects[audioservice.StorageStream]), len(objects[audioservice.StorageDisk]))
+	}
+}
+
+// Not PCM WAV is stored as uploaded.
+func TestLoadFileStreamNotPCM(t *testing.T) {
+	file := uploadedWAV(t, tone(0, 1))
+	binary.LittleEndian.PutUint16(file[20:], 3) // IEEE float
+
+	s3, db, w := upload(t, audioservice.StorageStream, file)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Equal(s3.object(t), file) {
+		t.Error("stored object differs from the upload")
+	}
+	if db.track.Metadata.SpeechDurationSeconds != 0 {
+		t.Errorf("speech = %v", db.track.Metadata.SpeechDurationSeconds)
+	}
+}
+
+func canonicalWAV(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var file bytes.Buffer
+	if err := audio.WriteWAVHeader(&file, testRate, 1, uint32(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	file.Write(data)
+	return file.Bytes()
+}
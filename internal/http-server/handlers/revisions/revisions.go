@@ -0,0 +1,267 @@
+package revisions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/etag"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/diff"
+	"msu-logging-backend/internal/storage"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type ListResponse struct {
+	response.Response
+	Revisions []rabbitmodels.ProtocolRevision `json:"revisions"`
+}
+
+type GetResponse struct {
+	response.Response
+	Revision rabbitmodels.ProtocolRevision `json:"revision"`
+	Text     string                        `json:"text"`
+}
+
+type DiffResponse struct {
+	response.Response
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	Lines []diff.Line `json:"lines"`
+}
+
+// ConflictResponse carries the current revision when a change was based on
+// an older one, so the client can merge and retry.
+type ConflictResponse struct {
+	response.Response
+	Revision rabbitmodels.ProtocolRevision `json:"revision"`
+	Text     string                        `json:"text"`
+}
+
+type RevertResponse struct {
+	response.Response
+	Revision rabbitmodels.ProtocolRevision `json:"revision"`
+}
+
+type RevisionLister interface {
+	Revisions(ctx context.Context, taskId int32) ([]rabbitmodels.ProtocolRevision, error)
+}
+
+type RevisionGetter interface {
+	Revision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, string, error)
+}
+
+type RevisionDiffer interface {
+	Diff(ctx context.Context, taskId int32, from int, to int) ([]diff.Line, error)
+}
+
+type RevisionReverter interface {
+	Revert(ctx context.Context, taskId int32, number int, author string, base int) (rabbitmodels.ProtocolRevision, error)
+}
+
+type RevisionService interface {
+	RevisionGetter
+	RevisionReverter
+}
+
+// NewListHandler serves GET /tasks/{id}/protocol/revisions.
+func NewListHandler(log *slog.Logger, lister RevisionLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revisions.NewListHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		revisions, err := lister.Revisions(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to list revisions", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to list revisions")
+			return
+		}
+		if revisions == nil {
+			revisions = []rabbitmodels.ProtocolRevision{}
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response:  response.OK(),
+			Revisions: revisions,
+		})
+	}
+}
+
+// NewGetHandler serves GET /tasks/{id}/protocol/revisions/{rev}.
+func NewGetHandler(log *slog.Logger, getter RevisionGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revisions.NewGetHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		number, err := parseRevision(chi.URLParam(r, "rev"))
+		if err != nil {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		}
+
+		revision, text, err := getter.Revision(r.Context(), taskId, number)
+		if err != nil {
+			renderError(w, r, log, "Failed to get revision", err)
+			return
+		}
+
+		w.Header().Set("ETag", etag.Revision(revision.Number))
+		render.JSON(w, r, GetResponse{
+			Response: response.OK(),
+			Revision: revision,
+			Text:     text,
+		})
+	}
+}
+
+// NewDiffHandler serves GET /tasks/{id}/protocol/diff?from=&to=. Without
+// "to" the current revision is compared.
+func NewDiffHandler(log *slog.Logger, differ RevisionDiffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revisions.NewDiffHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		query := r.URL.Query()
+		from, err := parseRevision(query.Get("from"))
+		if err != nil || from == 0 {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "from must be a revision number")
+			return
+		}
+		to := 0
+		if value := query.Get("to"); value != "" {
+			if to, err = parseRevision(value); err != nil {
+				response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+				return
+			}
+		}
+
+		lines, err := differ.Diff(r.Context(), taskId, from, to)
+		if errors.Is(err, diff.ErrTooLarge) {
+			log.Warn("Diff is too large", slog.Int("from", from), slog.Int("to", to))
+			response.Fail(w, r, http.StatusRequestEntityTooLarge, response.CodeTooLarge, err.Error())
+			return
+		}
+		if err != nil {
+			renderError(w, r, log, "Failed to diff revisions", err)
+			return
+		}
+		if lines == nil {
+			lines = []diff.Line{}
+		}
+
+		render.JSON(w, r, DiffResponse{
+			Response: response.OK(),
+			From:     from,
+			To:       to,
+			Lines:    lines,
+		})
+	}
+}
+
+// NewRevertHandler serves POST /tasks/{id}/protocol/revisions/{rev}/revert.
+// With If-Match the revert is rejected with 412 unless the tag is current.
+func NewRevertHandler(log *slog.Logger, service RevisionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.revisions.NewRevertHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		number, err := parseRevision(chi.URLParam(r, "rev"))
+		if err != nil || number == 0 {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "invalid revision")
+			return
+		}
+
+		base, err := etag.ParseIfMatch(r.Header.Get("If-Match"))
+		if err != nil {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		}
+
+		access, _ := mymiddleware.AccessFromContext(r.Context())
+
+		revision, err := service.Revert(r.Context(), taskId, number, access.Subject(), base)
+		if errors.Is(err, storage.ErrRevisionConflict) {
+			RenderConflict(w, r, log, service, taskId, http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			renderError(w, r, log, "Failed to revert protocol", err)
+			return
+		}
+
+		w.Header().Set("ETag", etag.Revision(revision.Number))
+		render.JSON(w, r, RevertResponse{
+			Response: response.OK(),
+			Revision: revision,
+		})
+	}
+}
+
+// RenderConflict answers a stale change with the current revision and its
+// text. The status is 412 for a failed If-Match and 409 for a stale
+// revision number in the body.
+func RenderConflict(w http.ResponseWriter, r *http.Request, log *slog.Logger, getter RevisionGetter, taskId int32, status int) {
+	revision, text, err := getter.Revision(r.Context(), taskId, 0)
+	if err != nil {
+		log.Error("Failed to get current revision", slog.String("error", err.Error()))
+	} else {
+		w.Header().Set("ETag", etag.Revision(revision.Number))
+	}
+
+	code := response.CodeConflict
+	if status == http.StatusPreconditionFailed {
+		code = response.CodePreconditionFailed
+	}
+
+	render.Status(r, status)
+	render.JSON(w, r, ConflictResponse{
+		Response: response.ErrorFor(r, code, "protocol was changed by someone else"),
+		Revision: revision,
+		Text:     text,
+	})
+}
+
+func parseRevision(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid revision %q", value)
+	}
+	return number, nil
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string, err error) {
+	if errors.Is(err, storage.ErrRevisionNotFound) || errors.Is(err, minioapp.ErrObjectNotFound) {
+		response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "revision not found")
+		return
+	}
+
+	log.Error(msg, slog.String("error", err.Error()))
+	response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, msg)
+}
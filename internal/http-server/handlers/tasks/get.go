@@ -0,0 +1,123 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/links"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/storage"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type Protocol struct {
+	ShortProtocol string `json:"short_protocol,omitempty"`
+	FullProtocol  string `json:"full_protocol,omitempty"`
+}
+
+type GetResponse struct {
+	response.Response
+	Task       rabbitmodels.TaskSummary       `json:"task"`
+	Tracks     []rabbitmodels.Track           `json:"tracks"`
+	Transcript rabbitmodels.TranscriptSummary `json:"transcript"`
+	Protocol   Protocol                       `json:"protocol"`
+	Progress   *rabbitmodels.TaskProgress     `json:"progress,omitempty"`
+}
+
+type TaskGetter interface {
+	GetTask(ctx context.Context, taskId int32) (rabbitmodels.TaskSummary, error)
+}
+
+type TrackGetter interface {
+	GetTracks(ctx context.Context, taskId int32) ([]rabbitmodels.Track, error)
+}
+
+type TranscriptSummaryGetter interface {
+	GetTranscriptSummary(ctx context.Context, taskId int32) (rabbitmodels.TranscriptSummary, error)
+}
+
+type ProtocolGetter interface {
+	GetProtocol(ctx context.Context, id int32) (rabbitmodels.ObjectRef, rabbitmodels.ObjectRef, error)
+}
+
+type ProgressGetter interface {
+	GetTaskProgress(ctx context.Context, taskId int32) (rabbitmodels.TaskProgress, bool, error)
+}
+
+// NewGetHandler serves GET /tasks/{id}.
+func NewGetHandler(
+	log *slog.Logger,
+	taskGetter TaskGetter,
+	trackGetter TrackGetter,
+	transcriptGetter TranscriptSummaryGetter,
+	protocolGetter ProtocolGetter,
+	progressGetter ProgressGetter,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.tasks.NewGetHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		task, err := taskGetter.GetTask(r.Context(), taskId)
+		if errors.Is(err, storage.ErrTaskNotFound) {
+			response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "task not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to get task", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to get task")
+			return
+		}
+
+		resp := GetResponse{
+			Response: response.OK(),
+			Task:     task,
+		}
+
+		resp.Tracks, err = trackGetter.GetTracks(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get tracks", slog.String("error", err.Error()))
+		}
+		// /tasks/{id}/audio отдаёт только загруженные треки
+		for i := range resp.Tracks {
+			if resp.Tracks[i].State == rabbitmodels.TrackStateUploaded {
+				resp.Tracks[i].AudioFileLink = links.Audio(taskId, resp.Tracks[i].Source)
+			}
+		}
+
+		resp.Transcript, err = transcriptGetter.GetTranscriptSummary(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get transcript summary", slog.String("error", err.Error()))
+		}
+
+		shortProtocol, fullProtocol, err := protocolGetter.GetProtocol(r.Context(), taskId)
+		if err != nil {
+			log.Error("Failed to get protocol", slog.String("error", err.Error()))
+		}
+		if !shortProtocol.IsZero() {
+			resp.Protocol.ShortProtocol = links.Protocol(taskId)
+		}
+		if !fullProtocol.IsZero() {
+			resp.Protocol.FullProtocol = links.Transcript(taskId)
+		}
+
+		if task.Status != "finished" {
+			progress, found, err := progressGetter.GetTaskProgress(r.Context(), taskId)
+			if err != nil {
+				log.Error("Failed to get task progress", slog.String("error", err.Error()))
+			} else if found {
+				resp.Progress = &progress
+			}
+		}
+
+		render.JSON(w, r, resp)
+	}
+}
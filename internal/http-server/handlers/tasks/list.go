@@ -0,0 +1,161 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/response"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type ListResponse struct {
+	response.Response
+	Tasks []rabbitmodels.TaskSummary `json:"tasks"`
+	// NextCursor передаётся в ?cursor= за следующей страницей, пустой на последней
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type TaskLister interface {
+	ListTasks(ctx context.Context, filter rabbitmodels.TaskFilter) ([]rabbitmodels.TaskSummary, error)
+}
+
+// NewListHandler serves GET /tasks?status=&source=&from=&to=&sort=&cursor=&limit=.
+// status можно повторять или перечислять через запятую, from/to - RFC 3339 или
+// YYYY-MM-DD (to включает весь день), sort - created_at или -created_at (по умолчанию).
+func NewListHandler(log *slog.Logger, lister TaskLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.tasks.NewListHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		access, ok := mymiddleware.AccessFromContext(r.Context())
+		if !ok {
+			log.Error("failed to get caller access")
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "authentication failed")
+			return
+		}
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		}
+		if !access.Admin {
+			filter.TaskId = access.TaskId
+		}
+
+		// на одну больше, чтобы понять, есть ли следующая страница
+		limit := filter.Limit
+		filter.Limit++
+
+		tasks, err := lister.ListTasks(r.Context(), filter)
+		if err != nil {
+			log.Error("Failed to list tasks", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to list tasks")
+			return
+		}
+
+		var nextCursor string
+		if len(tasks) > limit {
+			tasks = tasks[:limit]
+			nextCursor = strconv.Itoa(int(tasks[limit-1].Id))
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response:   response.OK(),
+			Tasks:      tasks,
+			NextCursor: nextCursor,
+		})
+	}
+}
+
+func parseFilter(query url.Values) (rabbitmodels.TaskFilter, error) {
+	filter := rabbitmodels.TaskFilter{Limit: defaultLimit}
+
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+
+	if source := query.Get("source"); source != "" {
+		if !rabbitmodels.ValidTrackSource(source) {
+			return filter, errors.New("invalid source")
+		}
+		filter.Source = source
+	}
+
+	var err error
+	if filter.From, _, err = parseTime(query.Get("from")); err != nil {
+		return filter, errors.New("invalid from, expected RFC 3339 or YYYY-MM-DD")
+	}
+
+	var dateOnly bool
+	if filter.To, dateOnly, err = parseTime(query.Get("to")); err != nil {
+		return filter, errors.New("invalid to, expected RFC 3339 or YYYY-MM-DD")
+	}
+	if dateOnly {
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	switch query.Get("sort") {
+	case "", "-created_at":
+	case "created_at":
+		filter.Ascending = true
+	default:
+		return filter, errors.New("invalid sort, expected created_at or -created_at")
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		afterId, err := strconv.ParseInt(cursor, 10, 32)
+		if err != nil || afterId <= 0 {
+			return filter, errors.New("invalid cursor")
+		}
+		filter.AfterId = int32(afterId)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, errors.New("invalid limit")
+		}
+		filter.Limit = min(n, maxLimit)
+	}
+
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	// в БД DATETIME хранится в локальном времени
+	return t.Local(), false, nil
+}
@@ -0,0 +1,147 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/fulltext"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+)
+
+type SearchResponse struct {
+	response.Response
+	Results []rabbitmodels.SearchHit `json:"results"`
+	// NextOffset передаётся в ?offset= за следующей страницей, пустой на последней
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+type Searcher interface {
+	Search(ctx context.Context, query string, filter rabbitmodels.SearchFilter) ([]rabbitmodels.SearchHit, error)
+}
+
+// NewSearchHandler serves GET /search?q=&kind=&status=&from=&to=&limit=&offset=.
+// Слова q ищутся по началу, "фраза в кавычках" - целиком, -слово исключает.
+// kind - transcript или protocol, status/from/to - как в списке задач.
+// С токеном задачи ищет только в ней.
+func NewSearchHandler(log *slog.Logger, searcher Searcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.tasks.NewSearchHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		access, ok := mymiddleware.AccessFromContext(r.Context())
+		if !ok {
+			log.Error("failed to get caller access")
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "authentication failed")
+			return
+		}
+
+		query := r.URL.Query()
+		q := strings.TrimSpace(query.Get("q"))
+		if q == "" {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "q is required")
+			return
+		}
+
+		filter, err := parseSearchFilter(query)
+		if err != nil {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		}
+		if !access.Admin {
+			filter.TaskId = access.TaskId
+		}
+
+		// на одну больше, чтобы понять, есть ли следующая страница
+		limit := filter.Limit
+		filter.Limit++
+
+		results, err := searcher.Search(r.Context(), q, filter)
+		if errors.Is(err, fulltext.ErrEmptyQuery) {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, fulltext.ErrEmptyQuery.Error())
+			return
+		}
+		if err != nil {
+			log.Error("Failed to search", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to search")
+			return
+		}
+
+		var nextOffset int
+		if len(results) > limit {
+			results = results[:limit]
+			nextOffset = filter.Offset + limit
+		}
+
+		render.JSON(w, r, SearchResponse{
+			Response:   response.OK(),
+			Results:    results,
+			NextOffset: nextOffset,
+		})
+	}
+}
+
+func parseSearchFilter(query url.Values) (rabbitmodels.SearchFilter, error) {
+	filter := rabbitmodels.SearchFilter{Limit: defaultLimit}
+
+	for _, value := range query["kind"] {
+		for _, kind := range strings.Split(value, ",") {
+			if kind = strings.TrimSpace(kind); kind == "" {
+				continue
+			}
+			if !rabbitmodels.ValidSearchKind(kind) {
+				return filter, errors.New("invalid kind, expected transcript or protocol")
+			}
+			filter.Kinds = append(filter.Kinds, kind)
+		}
+	}
+
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+
+	var err error
+	if filter.From, _, err = parseTime(query.Get("from")); err != nil {
+		return filter, errors.New("invalid from, expected RFC 3339 or YYYY-MM-DD")
+	}
+
+	var dateOnly bool
+	if filter.To, dateOnly, err = parseTime(query.Get("to")); err != nil {
+		return filter, errors.New("invalid to, expected RFC 3339 or YYYY-MM-DD")
+	}
+	if dateOnly {
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, errors.New("invalid limit")
+		}
+		filter.Limit = min(n, maxLimit)
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return filter, errors.New("invalid offset")
+		}
+		filter.Offset = n
+	}
+
+	return filter, nil
+}
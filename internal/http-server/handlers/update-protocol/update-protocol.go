@@ -3,81 +3,101 @@ package updateprotocol
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log/slog"
-	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/http-server/handlers/revisions"
 	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/etag"
 	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/storage"
 	"net/http"
-	"os"
 
 	"github.com/go-chi/render"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type RequestData struct {
 	NewProtocol string `json:"new_protocol"`
+	// BaseRevision - ревизия, которую правили; вместо него можно прислать If-Match
+	BaseRevision *int `json:"base_revision"`
 }
 
-type ProtocolUpdater interface {
-	UpdateProtocolShortText(ctx context.Context, taskId int32, protocol string) (int64, error)
-	UpdateProtocolFullText(ctx context.Context, taskId int32, full_text string) (int64, error)
+type Response struct {
+	response.Response
+	Revision rabbitmodels.ProtocolRevision `json:"revision"`
 }
 
-func NewUpdateProtocolHandler(log *slog.Logger, protocolUpdater ProtocolUpdater, minioService *minioapp.App) http.HandlerFunc {
+type ProtocolEditor interface {
+	Edit(ctx context.Context, taskId int32, text string, author string, base int) (rabbitmodels.ProtocolRevision, error)
+	Revision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, string, error)
+}
+
+// NewUpdateProtocolHandler saves the edited protocol as a new revision.
+// The edit names the revision it was made on, by If-Match or by
+// base_revision; a stale edit is rejected with 412 or 409 and the current
+// revision. Without either it is rejected with 428, unless requireRevision
+// is off and the edit is saved unconditionally.
+func NewUpdateProtocolHandler(log *slog.Logger, protocolEditor ProtocolEditor, requireRevision bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "handlers.auth.NewLoadFileHandler"
+		const op = "handlers.updateprotocol.NewUpdateProtocolHandler"
 
-		log = log.With(
+		log := log.With(
 			slog.String("op", op),
 		)
 
-		claims, ok := r.Context().Value(mymiddleware.TokenClaimsKey).(jwt.MapClaims)
-		if !ok {
-			log.Error("failed to get JWT claims")
-			render.JSON(w, r, response.Error("authentication failed"))
-			return
-		}
-		taskClaim, ok := claims["taskId"]
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
 		if !ok {
 			log.Error("taskId claim not found or invalid")
-			render.JSON(w, r, response.Error("invalid token"))
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
 			return
 		}
-		taskId := int32(taskClaim.(float64))
 
 		var data RequestData
 		err := json.NewDecoder(r.Body).Decode(&data)
 		if err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidJSON, "Invalid JSON")
 			return
 		}
 		defer r.Body.Close()
 
-		filename := fmt.Sprintf("protocol_%v.txt", taskId)
-		file, err := os.Create(filename)
+		base, err := etag.ParseIfMatch(r.Header.Get("If-Match"))
 		if err != nil {
-			log.Error("File creation error:", slog.String("error", err.Error()))
-			http.Error(w, "Error in creating file", http.StatusBadRequest)
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
 			return
 		}
-		_, err = file.Write([]byte(data.NewProtocol))
-		if err != nil {
-			log.Error("File writing error:", slog.String("error", err.Error()))
-			http.Error(w, "Error in writing file", http.StatusBadRequest)
+		conflictStatus := http.StatusPreconditionFailed
+		if base == rabbitmodels.AnyRevision && data.BaseRevision != nil {
+			if *data.BaseRevision < 0 {
+				response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "invalid base_revision")
+				return
+			}
+			base = *data.BaseRevision
+			conflictStatus = http.StatusConflict
+		}
+		if base == rabbitmodels.AnyRevision && requireRevision {
+			response.Fail(w, r, http.StatusPreconditionRequired, response.CodePreconditionRequired,
+				"If-Match or base_revision is required")
 			return
 		}
 
-		link, err := minioService.UploadFile(filename, filename)
+		// автор - тот, на кого выдан токен, телу не доверяем
+		author := mymiddleware.Access{TaskId: taskId}.Subject()
+
+		revision, err := protocolEditor.Edit(r.Context(), taskId, data.NewProtocol, author, base)
+		if errors.Is(err, storage.ErrRevisionConflict) {
+			revisions.RenderConflict(w, r, log, protocolEditor, taskId, conflictStatus)
+			return
+		}
 		if err != nil {
-			log.Error("Minio upload error", slog.String("error", err.Error()))
-			render.JSON(w, r, response.Error("Failed to save in MinIO"))
+			log.Error("Failed to save protocol", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "Failed to save protocol")
 			return
 		}
 
-		log.Info("Audiofile uploaded to minio succesfully")
-
-		protocolUpdater.UpdateProtocolShortText(context.Background(), taskId, link)
-
+		w.Header().Set("ETag", etag.Revision(revision.Number))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Revision: revision,
+		})
 	}
 }
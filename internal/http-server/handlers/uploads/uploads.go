@@ -0,0 +1,268 @@
+package uploads
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/services/uploads"
+	"msu-logging-backend/internal/storage"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// Обработчики реализуют ядро tus 1.0 с расширениями creation и termination:
+// POST создаёт загрузку, HEAD возвращает смещение, PATCH дописывает данные.
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,termination"
+
+	offsetContentType = "application/offset+octet-stream"
+)
+
+type CreateResponse struct {
+	response.Response
+	Upload rabbitmodels.Upload `json:"upload"`
+}
+
+type UploadService interface {
+	Create(ctx context.Context, taskId int32, source string, filename string, contentType string, length int64) (rabbitmodels.Upload, error)
+	Get(ctx context.Context, taskId int32, id string) (rabbitmodels.Upload, error)
+	Append(ctx context.Context, taskId int32, id string, offset int64, data io.Reader) (rabbitmodels.Upload, error)
+	Terminate(ctx context.Context, taskId int32, id string) error
+	MaxSize() int64
+}
+
+// TusResumable checks the protocol version of every request and announces
+// the supported one in the responses.
+func TusResumable(service UploadService) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Tus-Resumable", TusVersion)
+			w.Header().Set("Tus-Version", TusVersion)
+			w.Header().Set("Tus-Extension", TusExtensions)
+			if service.MaxSize() > 0 {
+				w.Header().Set("Tus-Max-Size", strconv.FormatInt(service.MaxSize(), 10))
+			}
+
+			if r.Header.Get("Tus-Resumable") != TusVersion {
+				response.Fail(w, r, http.StatusPreconditionFailed, response.CodePreconditionFailed, "Tus-Resumable: "+TusVersion+" is required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewCreateHandler serves POST /uploads. Upload-Length is required,
+// Upload-Metadata may carry filename, filetype and source.
+func NewCreateHandler(log *slog.Logger, service UploadService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.uploads.NewCreateHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
+		if !ok {
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
+			return
+		}
+
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "Upload-Length is required")
+			return
+		}
+
+		metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "invalid Upload-Metadata")
+			return
+		}
+
+		upload, err := service.Create(r.Context(), taskId, metadata["source"], metadata["filename"], metadata["filetype"], length)
+		switch {
+		case errors.Is(err, uploads.ErrTooLarge):
+			response.Fail(w, r, http.StatusRequestEntityTooLarge, response.CodeTooLarge, err.Error())
+			return
+		case errors.Is(err, audio.ErrUnsupportedMedia):
+			response.Fail(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, err.Error())
+			return
+		case errors.Is(err, uploads.ErrInvalidSource), errors.Is(err, uploads.ErrInvalidLength):
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		case err != nil:
+			log.Error("Failed to create upload", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to create upload")
+			return
+		}
+
+		w.Header().Set("Location", "/uploads/"+upload.Id)
+		w.Header().Set("Upload-Offset", "0")
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, CreateResponse{
+			Response: response.OK(),
+			Upload:   upload,
+		})
+	}
+}
+
+// NewHeadHandler serves HEAD /uploads/{uploadId}: the offset to resume from.
+func NewHeadHandler(log *slog.Logger, service UploadService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.uploads.NewHeadHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
+		if !ok {
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
+			return
+		}
+
+		upload, err := service.Get(r.Context(), taskId, chi.URLParam(r, "uploadId"))
+		if err != nil {
+			renderError(w, r, log, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// NewPatchHandler serves PATCH /uploads/{uploadId}. The chunk that completes
+// the upload sends the file to processing.
+func NewPatchHandler(log *slog.Logger, service UploadService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.uploads.NewPatchHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
+		if !ok {
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
+			return
+		}
+
+		if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType != offsetContentType {
+			response.Fail(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, "Content-Type must be "+offsetContentType)
+			return
+		}
+
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "Upload-Offset is required")
+			return
+		}
+
+		upload, err := service.Append(r.Context(), taskId, chi.URLParam(r, "uploadId"), offset, r.Body)
+		if upload.Id != "" {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		}
+		if err != nil {
+			renderError(w, r, log, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewDeleteHandler serves DELETE /uploads/{uploadId} for unfinished uploads.
+func NewDeleteHandler(log *slog.Logger, service UploadService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.uploads.NewDeleteHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		taskId, ok := mymiddleware.TaskIdFromClaims(r.Context())
+		if !ok {
+			response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
+			return
+		}
+
+		if err := service.Terminate(r.Context(), taskId, chi.URLParam(r, "uploadId")); err != nil {
+			renderError(w, r, log, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, storage.ErrUploadNotFound):
+		response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "upload not found")
+	case errors.Is(err, uploads.ErrOffsetMismatch):
+		response.Fail(w, r, http.StatusConflict, response.CodeConflict, uploads.ErrOffsetMismatch.Error())
+	case errors.Is(err, uploads.ErrNotUploading):
+		response.Fail(w, r, http.StatusConflict, response.CodeConflict, uploads.ErrNotUploading.Error())
+	case errors.Is(err, storage.ErrUploadConflict):
+		response.Fail(w, r, http.StatusConflict, response.CodeConflict, storage.ErrUploadConflict.Error())
+	case errors.Is(err, audio.ErrUnsupportedMedia):
+		response.Fail(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, reason(err, audio.ErrUnsupportedMedia))
+	case errors.Is(err, audio.ErrMediaTooLarge):
+		response.Fail(w, r, http.StatusRequestEntityTooLarge, response.CodeTooLarge, reason(err, audio.ErrMediaTooLarge))
+	case errors.Is(err, audio.ErrMediaTooLong):
+		response.Fail(w, r, http.StatusUnprocessableEntity, response.CodeMediaTooLong, reason(err, audio.ErrMediaTooLong))
+	case errors.Is(err, uploads.ErrExceedsLength):
+		response.Fail(w, r, http.StatusRequestEntityTooLarge, response.CodeTooLarge, uploads.ErrExceedsLength.Error())
+	default:
+		log.Error("Upload failed", slog.String("error", err.Error()))
+		response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "upload failed")
+	}
+}
+
+// reason cuts the service op prefixes off err, keeping the sentinel and its details.
+func reason(err error, target error) string {
+	msg := err.Error()
+	if i := strings.Index(msg, target.Error()); i >= 0 {
+		return msg[i:]
+	}
+	return target.Error()
+}
+
+// parseMetadata decodes "key base64value,key2 base64value2", a value may be omitted.
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
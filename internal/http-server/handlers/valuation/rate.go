@@ -40,7 +40,7 @@ func NewRateHandler(log *slog.Logger, valuationSaver ValuationSaver) http.Handle
 		if err != nil {
 			log.Error("failed to decode request body", slog.String("error", err.Error()))
 
-			render.JSON(w, r, response.Error("failed to decode request"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidJSON, "failed to decode request")
 			return
 		}
 
@@ -49,7 +49,7 @@ func NewRateHandler(log *slog.Logger, valuationSaver ValuationSaver) http.Handle
 		if err := validator.New().Struct(req); err != nil {
 			log.Error("invalid request", slog.String("error", err.Error()))
 
-			render.JSON(w, r, response.Error("ivalid request"))
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "invalid request")
 
 			return
 		}
@@ -57,6 +57,7 @@ func NewRateHandler(log *slog.Logger, valuationSaver ValuationSaver) http.Handle
 		_, err = valuationSaver.SaveValuation(context.Background(), req.Usability, req.ProcessingSpeed, req.ProcessingQuality, req.ReuseService, req.Comment)
 		if err != nil {
 			log.Error("error in saveing valudation", slog.String("error", err.Error()))
+			response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "failed to save valuation")
 			return
 		}
 
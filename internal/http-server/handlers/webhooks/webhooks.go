@@ -0,0 +1,265 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	mymiddleware "msu-logging-backend/internal/http-server/middleware"
+	"msu-logging-backend/internal/lib/api/response"
+	"msu-logging-backend/internal/services/webhooks"
+	"msu-logging-backend/internal/storage"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultDeliveries = 50
+	maxDeliveries     = 200
+)
+
+type CreateRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookResponse struct {
+	response.Response
+	Webhook rabbitmodels.Webhook `json:"webhook"`
+}
+
+type ListResponse struct {
+	response.Response
+	Webhooks []rabbitmodels.Webhook `json:"webhooks"`
+}
+
+type DeliveriesResponse struct {
+	response.Response
+	Deliveries []rabbitmodels.WebhookDelivery `json:"deliveries"`
+}
+
+type DeliveryResponse struct {
+	response.Response
+	Delivery rabbitmodels.WebhookDelivery `json:"delivery"`
+}
+
+type WebhookService interface {
+	Create(ctx context.Context, taskId int32, url string, events []string) (rabbitmodels.Webhook, error)
+	List(ctx context.Context, taskId int32) ([]rabbitmodels.Webhook, error)
+	Get(ctx context.Context, taskId int32, id int64) (rabbitmodels.Webhook, error)
+	Delete(ctx context.Context, taskId int32, id int64) error
+	Deliveries(ctx context.Context, taskId int32, webhookId int64, limit int) ([]rabbitmodels.WebhookDelivery, error)
+	Redeliver(ctx context.Context, taskId int32, webhookId int64, deliveryId int64) (rabbitmodels.WebhookDelivery, error)
+}
+
+// Обработчики общие для /tasks/{id}/webhooks и /admin/webhooks: без TaskScope
+// id задачи в контексте 0, это глобальные вебхуки.
+
+// NewCreateHandler serves POST .../webhooks. The secret for signatures is
+// only in this response.
+func NewCreateHandler(log *slog.Logger, service WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.webhooks.NewCreateHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		var req CreateRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			if errors.Is(err, io.EOF) {
+				response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidJSON, "empty request")
+				return
+			}
+			response.Fail(w, r, http.StatusBadRequest, response.CodeInvalidJSON, "failed to decode request")
+			return
+		}
+
+		taskId := mymiddleware.TaskIdFromContext(r.Context())
+
+		webhook, err := service.Create(r.Context(), taskId, req.URL, req.Events)
+		if errors.Is(err, webhooks.ErrInvalidURL) || errors.Is(err, webhooks.ErrForbiddenAddress) ||
+			errors.Is(err, webhooks.ErrUnknownEvent) {
+			response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			renderError(w, r, log, "failed to create webhook", err)
+			return
+		}
+
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, WebhookResponse{
+			Response: response.OK(),
+			Webhook:  webhook,
+		})
+	}
+}
+
+// NewListHandler serves GET .../webhooks.
+func NewListHandler(log *slog.Logger, service WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.webhooks.NewListHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		list, err := service.List(r.Context(), mymiddleware.TaskIdFromContext(r.Context()))
+		if err != nil {
+			renderError(w, r, log, "failed to list webhooks", err)
+			return
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response: response.OK(),
+			Webhooks: list,
+		})
+	}
+}
+
+// NewGetHandler serves GET .../webhooks/{webhookId}.
+func NewGetHandler(log *slog.Logger, service WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.webhooks.NewGetHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		webhookId, ok := parseId(w, r, "webhookId")
+		if !ok {
+			return
+		}
+
+		webhook, err := service.Get(r.Context(), mymiddleware.TaskIdFromContext(r.Context()), webhookId)
+		if err != nil {
+			renderError(w, r, log, "failed to get webhook", err)
+			return
+		}
+
+		render.JSON(w, r, WebhookResponse{
+			Response: response.OK(),
+			Webhook:  webhook,
+		})
+	}
+}
+
+// NewDeleteHandler serves DELETE .../webhooks/{webhookId}, the delivery log goes with it.
+func NewDeleteHandler(log *slog.Logger, service WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.webhooks.NewDeleteHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		webhookId, ok := parseId(w, r, "webhookId")
+		if !ok {
+			return
+		}
+
+		if err := service.Delete(r.Context(), mymiddleware.TaskIdFromContext(r.Context()), webhookId); err != nil {
+			renderError(w, r, log, "failed to delete webhook", err)
+			return
+		}
+
+		render.JSON(w, r, response.OK())
+	}
+}
+
+// NewDeliveriesHandler serves GET .../webhooks/{webhookId}/deliveries?limit=N,
+// newest first.
+func NewDeliveriesHandler(log *slog.Logger, service WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.webhooks.NewDeliveriesHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		webhookId, ok := parseId(w, r, "webhookId")
+		if !ok {
+			return
+		}
+
+		limit := defaultDeliveries
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "invalid limit")
+				return
+			}
+			limit = min(parsed, maxDeliveries)
+		}
+
+		deliveries, err := service.Deliveries(r.Context(), mymiddleware.TaskIdFromContext(r.Context()), webhookId, limit)
+		if err != nil {
+			renderError(w, r, log, "failed to list deliveries", err)
+			return
+		}
+
+		render.JSON(w, r, DeliveriesResponse{
+			Response:   response.OK(),
+			Deliveries: deliveries,
+		})
+	}
+}
+
+// NewRedeliverHandler serves POST .../webhooks/{webhookId}/deliveries/{deliveryId}/redeliver.
+// The payload is queued again as a new delivery.
+func NewRedeliverHandler(log *slog.Logger, service WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.webhooks.NewRedeliverHandler"
+
+		log := log.With(
+			slog.String("op", op),
+		)
+
+		webhookId, ok := parseId(w, r, "webhookId")
+		if !ok {
+			return
+		}
+		deliveryId, ok := parseId(w, r, "deliveryId")
+		if !ok {
+			return
+		}
+
+		delivery, err := service.Redeliver(r.Context(), mymiddleware.TaskIdFromContext(r.Context()), webhookId, deliveryId)
+		if err != nil {
+			renderError(w, r, log, "failed to redeliver", err)
+			return
+		}
+
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, DeliveryResponse{
+			Response: response.OK(),
+			Delivery: delivery,
+		})
+	}
+}
+
+func parseId(w http.ResponseWriter, r *http.Request, param string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil || id <= 0 {
+		response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "invalid "+param)
+		return 0, false
+	}
+	return id, true
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrWebhookNotFound):
+		response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "webhook not found")
+	case errors.Is(err, storage.ErrDeliveryNotFound):
+		response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "delivery not found")
+	default:
+		log.Error(msg, slog.String("error", err.Error()))
+		response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, msg)
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"msu-logging-backend/internal/lib/api/response"
+	"net/http"
+	"strings"
+)
+
+// AdminVerifier checks "Authorization: Bearer <ADMIN_TOKEN>".
+// With an empty token the admin API is disabled.
+func AdminVerifier(log *slog.Logger, adminToken string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminToken == "" {
+				response.Fail(w, r, http.StatusForbidden, response.CodeForbidden, "Admin API is disabled")
+				return
+			}
+
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				log.Warn("Invalid admin token", slog.String("path", r.URL.Path))
+				response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid admin token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Forwarded takes the client address, host and scheme from the
+// X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto headers.
+// Use it only behind a proxy that sets them, otherwise clients can spoof them.
+func Forwarded(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			// первый адрес - клиент, дальше прокси
+			client := strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+			if net.ParseIP(client) != nil {
+				r.RemoteAddr = net.JoinHostPort(client, "0")
+			}
+		} else if realIP := r.Header.Get("X-Real-IP"); net.ParseIP(realIP) != nil {
+			r.RemoteAddr = net.JoinHostPort(realIP, "0")
+		}
+
+		if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+			r.Host = strings.TrimSpace(strings.Split(host, ",")[0])
+		}
+
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			r.URL.Scheme = strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
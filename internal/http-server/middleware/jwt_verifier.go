@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"msu-logging-backend/internal/lib/api/response"
 	"net/http"
 	"os"
 	"strings"
@@ -24,6 +25,7 @@ func JWTVerifier(log *slog.Logger, secret string) func(next http.Handler) http.H
 			claims, ok := ParseTokenFromCookie(w, r)
 			if !ok {
 				log.Error("Error in token parsing")
+				response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid or missing token")
 				return
 			}
 
@@ -34,10 +36,22 @@ func JWTVerifier(log *slog.Logger, secret string) func(next http.Handler) http.H
 	}
 }
 
+// TaskIdFromClaims returns the taskId claim of the token checked by JWTVerifier.
+func TaskIdFromClaims(ctx context.Context) (int32, bool) {
+	claims, ok := ctx.Value(TokenClaimsKey).(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	taskClaim, ok := claims["taskId"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int32(taskClaim), true
+}
+
 func ParseTokenFromCookie(w http.ResponseWriter, r *http.Request) (jwt.MapClaims, bool) {
 	cookie, err := r.Cookie(JWTCookieName)
 	if err != nil {
-		http.Error(w, "Authorization cookie is required", http.StatusUnauthorized)
 		return nil, false
 	}
 
@@ -69,13 +83,13 @@ func ParseTokenString(tokenString string) (jwt.MapClaims, bool) {
 func ParseTokenFromRequest(w http.ResponseWriter, r *http.Request) (jwt.MapClaims, bool) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+		response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Authorization header is required")
 		return nil, false
 	}
 
 	tokenParts := strings.Split(authHeader, " ")
 	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-		http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+		response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid Authorization header format")
 		return nil, false
 	}
 
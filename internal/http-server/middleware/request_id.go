@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"log/slog"
+	"msu-logging-backend/internal/lib/api/response"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader returns the id set by chi's RequestID in X-Request-Id, so a
+// client can quote it when reporting an error. Must run after RequestID.
+func RequestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestId := middleware.GetReqID(r.Context()); requestId != "" {
+			w.Header().Set(middleware.RequestIDHeader, requestId)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Recoverer answers a panicking handler with a JSON 500 instead of an empty
+// response and logs the stack with the request id.
+func Recoverer(log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rvr := recover()
+				if rvr == nil {
+					return
+				}
+				if rvr == http.ErrAbortHandler {
+					panic(rvr)
+				}
+
+				log.Error("Handler panic",
+					slog.Any("panic", rvr),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+					slog.String("stack", string(debug.Stack())),
+				)
+				response.Fail(w, r, http.StatusInternalServerError, response.CodeInternal, "internal error")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
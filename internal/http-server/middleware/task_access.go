@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"msu-logging-backend/internal/lib/api/response"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	AccessKey contextKey = "task_access"
+	TaskIdKey contextKey = "task_id"
+)
+
+// Access is what the caller may read: every task with the admin token,
+// otherwise only the task of its JWT.
+type Access struct {
+	Admin  bool
+	TaskId int32
+}
+
+func (a Access) CanAccess(taskId int32) bool {
+	return a.Admin || a.TaskId == taskId
+}
+
+// Subject names the caller in audit fields such as a revision author.
+func (a Access) Subject() string {
+	if a.Admin {
+		return "admin"
+	}
+	return "task:" + strconv.Itoa(int(a.TaskId))
+}
+
+// TaskAccess accepts "Authorization: Bearer <ADMIN_TOKEN>", a task JWT as a
+// bearer token or the jwt_token cookie.
+func TaskAccess(log *slog.Logger, adminToken string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				cookie, err := r.Cookie(JWTCookieName)
+				if err != nil {
+					response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Authorization is required")
+					return
+				}
+				tokenString = cookie.Value
+			}
+
+			var access Access
+			if adminToken != "" && subtle.ConstantTimeCompare([]byte(tokenString), []byte(adminToken)) == 1 {
+				access.Admin = true
+			} else {
+				claims, ok := ParseTokenString(tokenString)
+				taskClaim, found := claims["taskId"].(float64)
+				if !ok || !found {
+					log.Warn("Invalid token", slog.String("path", r.URL.Path))
+					response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid token")
+					return
+				}
+				access.TaskId = int32(taskClaim)
+			}
+
+			ctx := context.WithValue(r.Context(), AccessKey, access)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func AccessFromContext(ctx context.Context) (Access, bool) {
+	access, ok := ctx.Value(AccessKey).(Access)
+	return access, ok
+}
+
+// TaskScope checks the {id} route parameter against the caller's access and
+// stores the task id for the handlers. Someone else's task looks the same as
+// a missing one. Must run after TaskAccess.
+func TaskScope(log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			access, ok := AccessFromContext(r.Context())
+			if !ok {
+				log.Error("failed to get caller access")
+				response.Fail(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "authentication failed")
+				return
+			}
+
+			id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+			if err != nil || id <= 0 {
+				response.Fail(w, r, http.StatusBadRequest, response.CodeBadRequest, "invalid task id")
+				return
+			}
+
+			if !access.CanAccess(int32(id)) {
+				response.Fail(w, r, http.StatusNotFound, response.CodeNotFound, "task not found")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), TaskIdKey, int32(id))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// TaskIdFromContext returns the task id checked by TaskScope.
+func TaskIdFromContext(ctx context.Context) int32 {
+	taskId, _ := ctx.Value(TaskIdKey).(int32)
+	return taskId
+}
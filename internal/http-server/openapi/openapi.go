@@ -0,0 +1,110 @@
+// Package openapi serves the OpenAPI document of the HTTP API and checks
+// that every registered route is described in it. The document is written
+// by hand, the httpapp tests keep it in sync with the router both ways and
+// check the responses against it.
+package openapi
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed openapi.yaml
+var document []byte
+
+// Handler serves the document.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.Write(document)
+}
+
+// Undocumented returns "METHOD /path" of the routes that are missing from
+// the document. Paths are compared without the trailing slash and the
+// file extension that middleware.URLFormat strips before routing.
+func Undocumented(routes chi.Routes) ([]string, error) {
+	documented := operations()
+
+	var missing []string
+	err := chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if method == http.MethodOptions || method == http.MethodHead {
+			return nil
+		}
+		key := method + " " + normalize(route)
+		if !documented[key] {
+			missing = append(missing, key)
+		}
+		return nil
+	})
+	sort.Strings(missing)
+
+	return missing, err
+}
+
+// Unrouted is the reverse of Undocumented: "METHOD /path" of the documented
+// operations that no route serves.
+func Unrouted(routes chi.Routes) ([]string, error) {
+	routed := make(map[string]bool)
+	err := chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routed[method+" "+normalize(route)] = true
+		return nil
+	})
+
+	var missing []string
+	for operation := range operations() {
+		if !routed[operation] {
+			missing = append(missing, operation)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing, err
+}
+
+// operations reads "METHOD /path" pairs from the paths section. The document
+// is written by hand in a fixed layout: paths at two spaces of indentation,
+// methods at four.
+func operations() map[string]bool {
+	result := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(document))
+	inPaths := false
+	current := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "paths:":
+			inPaths = true
+		case !inPaths:
+		case !strings.HasPrefix(line, " ") && strings.TrimSpace(line) != "":
+			inPaths = false
+		case strings.HasPrefix(line, "  /") && strings.HasSuffix(line, ":"):
+			current = normalize(strings.TrimSuffix(strings.TrimSpace(line), ":"))
+		case strings.HasPrefix(line, "    ") && !strings.HasPrefix(line, "     ") && current != "":
+			method := strings.TrimSuffix(strings.TrimSpace(line), ":")
+			switch method {
+			case "get", "post", "put", "patch", "delete":
+				result[strings.ToUpper(method)+" "+current] = true
+			}
+		}
+	}
+
+	return result
+}
+
+func normalize(route string) string {
+	route = strings.TrimSuffix(route, "/")
+	if ext := path.Ext(route); ext != "" && !strings.Contains(ext, "}") {
+		route = strings.TrimSuffix(route, ext)
+	}
+	if route == "" {
+		return "/"
+	}
+	return route
+}
@@ -0,0 +1,180 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+)
+
+func parseDocument(t *testing.T) map[string]any {
+	t.Helper()
+
+	var doc map[string]any
+	if err := yaml.Unmarshal(document, &doc); err != nil {
+		t.Fatalf("openapi.yaml is not valid YAML: %v", err)
+	}
+	return doc
+}
+
+// operations reads the document line by line, so it must agree with a real
+// YAML parser: a path or method at another indentation would be skipped.
+func TestOperationsMatchDocument(t *testing.T) {
+	doc := parseDocument(t)
+
+	paths, ok := doc["paths"].(map[string]any)
+	if !ok || len(paths) == 0 {
+		t.Fatal("no paths in the document")
+	}
+
+	want := make(map[string]bool)
+	for route, item := range paths {
+		for method := range item.(map[string]any) {
+			switch method {
+			case "get", "post", "put", "patch", "delete":
+				want[strings.ToUpper(method)+" "+normalize(route)] = true
+			}
+		}
+	}
+
+	if got := operations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("operations() = %v\nwant %v", keys(got), keys(want))
+	}
+}
+
+// Every $ref must point at an existing component.
+func TestReferences(t *testing.T) {
+	doc := parseDocument(t)
+
+	var walk func(node any, at string)
+	walk = func(node any, at string) {
+		switch node := node.(type) {
+		case map[string]any:
+			for key, value := range node {
+				if ref, ok := value.(string); ok && key == "$ref" {
+					if resolve(doc, ref) == nil {
+						t.Errorf("%s: unresolved $ref %q", at, ref)
+					}
+					continue
+				}
+				walk(value, at+"/"+key)
+			}
+		case []any:
+			for _, value := range node {
+				walk(value, at)
+			}
+		}
+	}
+	walk(doc, "")
+}
+
+func resolve(doc map[string]any, ref string) any {
+	var node any = doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	return node
+}
+
+func TestUndocumented(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := chi.NewRouter()
+	router.Get("/openapi", handler)
+	router.Get("/tasks/{id}/", handler)
+	router.Head("/uploads/{uploadId}", handler)
+	router.Options("/tasks", handler)
+	router.Route("/tasks/{id}/webhooks", func(r chi.Router) {
+		r.Get("/", handler)
+		r.Put("/{webhookId}", handler)
+	})
+	router.Post("/nowhere", handler)
+
+	got, err := Undocumented(router)
+	if err != nil {
+		t.Fatalf("Undocumented: %v", err)
+	}
+	want := []string{"POST /nowhere", "PUT /tasks/{id}/webhooks/{webhookId}"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Undocumented = %v, want %v", got, want)
+	}
+}
+
+func TestUnrouted(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := chi.NewRouter()
+	for route := range operations() {
+		method, path, _ := strings.Cut(route, " ")
+		if route == "GET /tasks" || route == "POST /valuation" {
+			continue
+		}
+		router.MethodFunc(method, path, handler)
+	}
+
+	got, err := Unrouted(router)
+	if err != nil {
+		t.Fatalf("Unrouted: %v", err)
+	}
+	want := []string{"GET /tasks", "POST /valuation"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unrouted = %v, want %v", got, want)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		route string
+		want  string
+	}{
+		{route: "/", want: "/"},
+		{route: "", want: "/"},
+		{route: "/tasks/", want: "/tasks"},
+		{route: "/openapi.yaml", want: "/openapi"},
+		{route: "/tasks/{id}", want: "/tasks/{id}"},
+		{route: "/tasks/{id}/protocol/revisions/{rev}/", want: "/tasks/{id}/protocol/revisions/{rev}"},
+		// точка внутри параметра - не расширение
+		{route: "/files/{name.ext}", want: "/files/{name.ext}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			if got := normalize(tt.route); got != tt.want {
+				t.Errorf("normalize(%q) = %q, want %q", tt.route, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/yaml") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if w.Body.String() != string(document) {
+		t.Error("body is not the document")
+	}
+}
+
+func keys(m map[string]bool) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,39 @@
+// Package etag maps protocol revision numbers to HTTP entity tags.
+package etag
+
+import (
+	"errors"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid If-Match header")
+
+// Revision is the entity tag of a protocol revision, e.g. "r3".
+func Revision(number int) string {
+	return strconv.Quote("r" + strconv.Itoa(number))
+}
+
+// ParseIfMatch returns the revision the client expects to be current. An
+// empty header and "*" give rabbitmodels.AnyRevision. Only one tag is
+// accepted: a write is based on exactly one version.
+func ParseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return rabbitmodels.AnyRevision, nil
+	}
+
+	// слабый тег тоже принимаем: прокси могут ослабить его при сжатии
+	header = strings.TrimPrefix(header, "W/")
+	value, err := strconv.Unquote(header)
+	if err != nil {
+		return rabbitmodels.AnyRevision, ErrInvalid
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(value, "r"))
+	if err != nil || !strings.HasPrefix(value, "r") || number < 0 {
+		return rabbitmodels.AnyRevision, ErrInvalid
+	}
+
+	return number, nil
+}
@@ -0,0 +1,32 @@
+// Package links builds the API links to task files. The links are paths on
+// the HTTP API and need the same token as the rest of /tasks/{id}, unlike
+// presigned MinIO URLs, which give the file to anyone until they expire.
+package links
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Audio - трек задачи, пустой source - первый загруженный.
+func Audio(taskId int32, source string) string {
+	link := task(taskId) + "/audio"
+	if source != "" {
+		link += "?" + url.Values{"source": {source}}.Encode()
+	}
+	return link
+}
+
+// Transcript - полный протокол (текст расшифровки).
+func Transcript(taskId int32) string {
+	return task(taskId) + "/transcript"
+}
+
+// Protocol - текущая ревизия краткого протокола.
+func Protocol(taskId int32) string {
+	return task(taskId) + "/protocol"
+}
+
+func task(taskId int32) string {
+	return "/tasks/" + strconv.Itoa(int(taskId))
+}
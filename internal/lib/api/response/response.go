@@ -1,8 +1,17 @@
 package response
 
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
 type Response struct {
-	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	RequestId string `json:"request_id,omitempty"`
 }
 
 const (
@@ -10,6 +19,27 @@ const (
 	StatusError = "Error"
 )
 
+// Коды ошибок для клиентов: текст ошибки может меняться, код - нет.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeTooLarge             = "payload_too_large"
+	CodeUnsupportedMedia     = "unsupported_media_type"
+	CodeMediaTooLong         = "media_too_long"
+	CodeUnavailable          = "unavailable"
+	CodeNotImplemented       = "not_implemented"
+	CodeStorage              = "storage_error"
+	CodeInternal             = "internal_error"
+)
+
 func OK() Response {
 	return Response{
 		Status: StatusOK,
@@ -22,3 +52,20 @@ func Error(msg string) Response {
 		Error:  msg,
 	}
 }
+
+// ErrorFor is Error with a code and the id of the request, for responses
+// that embed Response next to other fields.
+func ErrorFor(r *http.Request, code string, msg string) Response {
+	return Response{
+		Status:    StatusError,
+		Error:     msg,
+		Code:      code,
+		RequestId: middleware.GetReqID(r.Context()),
+	}
+}
+
+// Fail writes an error response with the HTTP status.
+func Fail(w http.ResponseWriter, r *http.Request, status int, code string, msg string) {
+	render.Status(r, status)
+	render.JSON(w, r, ErrorFor(r, code, msg))
+}
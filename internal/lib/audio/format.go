@@ -0,0 +1,146 @@
+package audio
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	EncodingPCM16 = "pcm_s16le"
+
+	DefaultContentType = "application/octet-stream"
+)
+
+// Format is what a client declares about the stream it sends.
+// Raw PCM has no container, so it must be declared with sample rate and channels.
+type Format struct {
+	MimeType   string `json:"mime_type,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+}
+
+func (f Format) IsPCM() bool {
+	if f.Encoding == EncodingPCM16 {
+		return true
+	}
+
+	mediaType := baseMediaType(f.MimeType)
+	return mediaType == "audio/l16" || mediaType == "audio/pcm"
+}
+
+func (f Format) Validate() error {
+	if !f.IsPCM() {
+		return nil
+	}
+
+	if f.SampleRate < 8000 || f.SampleRate > 192000 {
+		return fmt.Errorf("sample_rate must be between 8000 and 192000, got %d", f.SampleRate)
+	}
+	if f.Channels < 1 || f.Channels > 8 {
+		return fmt.Errorf("channels must be between 1 and 8, got %d", f.Channels)
+	}
+
+	return nil
+}
+
+// браузеры и mimetype называют одни и те же контейнеры по-разному,
+// для записи голоса нам нужны audio/*
+var audioAliases = map[string]string{
+	"video/webm":      "audio/webm",
+	"video/mp4":       "audio/mp4",
+	"application/ogg": "audio/ogg",
+	"audio/x-wav":     "audio/wav",
+	"audio/wave":      "audio/wav",
+	"audio/vnd.wave":  "audio/wav",
+	"audio/x-m4a":     "audio/mp4",
+}
+
+var audioExtensions = map[string]string{
+	"audio/webm": ".webm",
+	"audio/mp4":  ".m4a",
+	"audio/ogg":  ".ogg",
+	"audio/wav":  ".wav",
+	"audio/mpeg": ".mp3",
+	"audio/flac": ".flac",
+	"audio/aac":  ".aac",
+}
+
+// DetectFile sniffs the container of the file. If the content is not
+// recognised, the declared MIME type or the file extension is used.
+func DetectFile(path string, declared string) (contentType string, ext string) {
+	detected, err := mimetype.DetectFile(path)
+	if err != nil {
+		detected = nil
+	}
+
+	return resolve(detected, declared, mime.TypeByExtension(filepath.Ext(path)))
+}
+
+// Detect is DetectFile for the first bytes of a stream.
+func Detect(head []byte, declared string) (contentType string, ext string) {
+	return resolve(mimetype.Detect(head), declared, "")
+}
+
+func resolve(detected *mimetype.MIME, declared string, byExt string) (contentType string, ext string) {
+	contentType = DefaultContentType
+
+	if detected != nil && !detected.Is(DefaultContentType) {
+		contentType = detected.String()
+	} else if declared != "" {
+		contentType = declared
+	} else if byExt != "" {
+		contentType = byExt
+	}
+
+	contentType = normalize(contentType)
+
+	if ext, ok := audioExtensions[contentType]; ok {
+		return contentType, ext
+	}
+	if known := mimetype.Lookup(contentType); known != nil && known.Extension() != "" {
+		return contentType, known.Extension()
+	}
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		return contentType, exts[0]
+	}
+
+	return contentType, ".bin"
+}
+
+// RenameWithExtension replaces the extension of path and moves the file.
+func RenameWithExtension(path, ext string) (string, error) {
+	newPath := strings.TrimSuffix(path, filepath.Ext(path)) + ext
+	if newPath == path {
+		return path, nil
+	}
+
+	if err := os.Rename(path, newPath); err != nil {
+		return path, fmt.Errorf("rename error: %w", err)
+	}
+
+	return newPath, nil
+}
+
+func normalize(contentType string) string {
+	mediaType := baseMediaType(contentType)
+	if alias, ok := audioAliases[mediaType]; ok {
+		return alias
+	}
+
+	return mediaType
+}
+
+func baseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	return mediaType
+}
@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp3Header - MPEG-1 Layer III, 128 кбит/с, 44.1 кГц, стерео: кадр 417 байт
+var mp3Header = []byte{0xFF, 0xFB, 0x90, 0x00}
+
+const mp3FrameSize = 417
+
+func mp3Frames(count int) []byte {
+	frame := make([]byte, mp3FrameSize)
+	copy(frame, mp3Header)
+	return bytes.Repeat(frame, count)
+}
+
+func id3Tag(size int) []byte {
+	tag := make([]byte, 10+size)
+	copy(tag, "ID3\x04\x00\x00")
+	tag[6] = byte(size >> 21 & 0x7F)
+	tag[7] = byte(size >> 14 & 0x7F)
+	tag[8] = byte(size >> 7 & 0x7F)
+	tag[9] = byte(size & 0x7F)
+	return tag
+}
+
+func oggPage(headerType byte, granule uint64, packet []byte) []byte {
+	page := []byte("OggS\x00")
+	page = append(page, headerType)
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = append(page, make([]byte, 12)...)
+	page = append(page, 1, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func opusHead(preSkip uint16) []byte {
+	packet := []byte("OpusHead\x01\x01")
+	packet = binary.LittleEndian.AppendUint16(packet, preSkip)
+	packet = binary.LittleEndian.AppendUint32(packet, 48000)
+	return append(packet, 0, 0, 0)
+}
+
+func vorbisHead(sampleRate uint32) []byte {
+	packet := []byte("\x01vorbis\x00\x00\x00\x00\x02")
+	packet = binary.LittleEndian.AppendUint32(packet, sampleRate)
+	return append(packet, make([]byte, 14)...)
+}
+
+func flacHeader(sampleRate int, samples int64) []byte {
+	info := make([]byte, 34)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	// 2 канала, 16 бит
+	info[12] = byte(sampleRate&0x0F)<<4 | 1<<1
+	info[13] = 15<<4 | byte(samples>>32&0x0F)
+	binary.BigEndian.PutUint32(info[14:18], uint32(samples))
+
+	// mimetype узнаёт FLAC только по STREAMINFO без флага последнего блока
+	return append([]byte("fLaC\x00\x00\x00\x22"), info...)
+}
+
+func TestFormatValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		pcm     bool
+		wantErr bool
+	}{
+		{name: "container", format: Format{MimeType: "audio/webm;codecs=opus"}},
+		{name: "empty", format: Format{}},
+		{name: "pcm encoding", format: Format{Encoding: EncodingPCM16, SampleRate: 16000, Channels: 1}, pcm: true},
+		{name: "l16 mime", format: Format{MimeType: "audio/L16; rate=16000", SampleRate: 16000, Channels: 2}, pcm: true},
+		{name: "pcm mime", format: Format{MimeType: "audio/pcm", SampleRate: 192000, Channels: 8}, pcm: true},
+		{name: "pcm without rate", format: Format{Encoding: EncodingPCM16, Channels: 1}, pcm: true, wantErr: true},
+		{name: "pcm rate too low", format: Format{Encoding: EncodingPCM16, SampleRate: 4000, Channels: 1}, pcm: true, wantErr: true},
+		{name: "pcm rate too high", format: Format{Encoding: EncodingPCM16, SampleRate: 384000, Channels: 1}, pcm: true, wantErr: true},
+		{name: "pcm no channels", format: Format{Encoding: EncodingPCM16, SampleRate: 16000}, pcm: true, wantErr: true},
+		{name: "pcm too many channels", format: Format{MimeType: "audio/pcm", SampleRate: 16000, Channels: 9}, pcm: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.IsPCM(); got != tt.pcm {
+				t.Errorf("IsPCM = %v, want %v", got, tt.pcm)
+			}
+			if err := tt.format.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	// не похоже ни на один формат, mimetype вернёт application/octet-stream
+	garbage := []byte{0x00, 0x01, 0x02, 0x03, 0xFE, 0xFF, 0x00, 0x01}
+
+	tests := []struct {
+		name        string
+		head        []byte
+		declared    string
+		contentType string
+		ext         string
+	}{
+		{name: "wav", head: wavBytes(t, 16000, 1, make([]byte, 100)), contentType: "audio/wav", ext: ".wav"},
+		{name: "mp3", head: mp3Frames(3), contentType: "audio/mpeg", ext: ".mp3"},
+		{name: "mp3 with id3", head: append(id3Tag(20), mp3Frames(3)...), contentType: "audio/mpeg", ext: ".mp3"},
+		{name: "ogg", head: oggPage(2, 0, opusHead(312)), contentType: "audio/ogg", ext: ".ogg"},
+		{name: "flac", head: flacHeader(44100, 88200), contentType: "audio/flac", ext: ".flac"},
+		// содержимое важнее заявленного типа
+		{name: "wav declared as webm", head: wavBytes(t, 16000, 1, nil), declared: "audio/webm", contentType: "audio/wav", ext: ".wav"},
+		{name: "declared webm", head: garbage, declared: "audio/webm;codecs=opus", contentType: "audio/webm", ext: ".webm"},
+		{name: "declared video webm", head: garbage, declared: "video/webm", contentType: "audio/webm", ext: ".webm"},
+		{name: "declared x-wav", head: garbage, declared: "audio/x-wav", contentType: "audio/wav", ext: ".wav"},
+		{name: "declared m4a", head: garbage, declared: "audio/x-m4a", contentType: "audio/mp4", ext: ".m4a"},
+		{name: "declared in upper case", head: garbage, declared: " AUDIO/OGG ", contentType: "audio/ogg", ext: ".ogg"},
+		{name: "unknown", head: garbage, contentType: DefaultContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, ext := Detect(tt.head, tt.declared)
+			if contentType != tt.contentType {
+				t.Errorf("content type = %q, want %q", contentType, tt.contentType)
+			}
+			// расширение для octet-stream зависит от mime.types системы
+			if tt.ext != "" && ext != tt.ext {
+				t.Errorf("ext = %q, want %q", ext, tt.ext)
+			}
+			if ext == "" {
+				t.Error("ext is empty")
+			}
+		})
+	}
+}
+
+func TestDetectFile(t *testing.T) {
+	path := writeTemp(t, "upload.bin", mp3Frames(3))
+
+	contentType, ext := DetectFile(path, "audio/webm")
+	if contentType != "audio/mpeg" || ext != ".mp3" {
+		t.Errorf("DetectFile = %q, %q, want audio/mpeg, .mp3", contentType, ext)
+	}
+
+	contentType, _ = DetectFile(filepath.Join(t.TempDir(), "missing"), "audio/ogg")
+	if contentType != "audio/ogg" {
+		t.Errorf("DetectFile of a missing file = %q, want the declared type", contentType)
+	}
+}
+
+func TestRenameWithExtension(t *testing.T) {
+	path := writeTemp(t, "upload.bin", []byte("data"))
+
+	renamed, err := RenameWithExtension(path, ".wav")
+	if err != nil {
+		t.Fatalf("RenameWithExtension: %v", err)
+	}
+	if want := filepath.Join(filepath.Dir(path), "upload.wav"); renamed != want {
+		t.Errorf("path = %q, want %q", renamed, want)
+	}
+	if _, err := os.Stat(renamed); err != nil {
+		t.Errorf("renamed file: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("old file still exists: %v", err)
+	}
+
+	same, err := RenameWithExtension(renamed, ".wav")
+	if err != nil || same != renamed {
+		t.Errorf("same extension = %q, %v, want %q", same, err, renamed)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.bin")
+	if got, err := RenameWithExtension(missing, ".ogg"); err == nil || got != missing {
+		t.Errorf("missing file = %q, %v, want the old path and an error", got, err)
+	}
+}
@@ -0,0 +1,115 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	ErrMediaTooLarge    = errors.New("file is too large")
+	ErrMediaTooLong     = errors.New("recording is too long")
+)
+
+// DefaultAllowedTypes - контейнеры, которые умеет разбирать обработчик
+var DefaultAllowedTypes = []string{
+	"audio/wav",
+	"audio/mpeg",
+	"audio/ogg",
+	"audio/webm",
+	"audio/mp4",
+	"audio/flac",
+	"audio/aac",
+	"audio/aiff",
+	"audio/amr",
+	"audio/3gpp",
+	"video/ogg",
+	"video/quicktime",
+	"video/x-matroska",
+	"video/3gpp",
+	"video/mpeg",
+	"video/x-msvideo",
+}
+
+// Limits is what an uploaded file must satisfy before it is queued.
+// Zero MaxSize or MaxDuration means no limit.
+type Limits struct {
+	// AllowedTypes - MIME-типы или маски вида audio/*, пусто - DefaultAllowedTypes
+	AllowedTypes []string
+	MaxSize      int64
+	MaxDuration  time.Duration
+}
+
+// CheckType checks a sniffed or declared content type against the allowlist.
+func (l Limits) CheckType(contentType string) error {
+	allowed := l.AllowedTypes
+	if len(allowed) == 0 {
+		allowed = DefaultAllowedTypes
+	}
+
+	mediaType := normalize(contentType)
+	for _, pattern := range allowed {
+		pattern = normalize(pattern)
+		if pattern == mediaType {
+			return nil
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasSuffix(prefix, "/") && strings.HasPrefix(mediaType, prefix) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnsupportedMedia, mediaType)
+}
+
+// CheckSize is used before the whole file is seen, e.g. for a declared length.
+func (l Limits) CheckSize(size int64) error {
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrMediaTooLarge, size, l.MaxSize)
+	}
+	return nil
+}
+
+// Check checks a probed file. Duration is only checked when the headers
+// give it.
+func (l Limits) Check(info MediaInfo) error {
+	if err := l.CheckType(info.ContentType); err != nil {
+		return err
+	}
+	if err := l.CheckSize(info.Size); err != nil {
+		return err
+	}
+	if l.MaxDuration > 0 && info.Duration > l.MaxDuration {
+		return fmt.Errorf("%w: %s, limit is %s", ErrMediaTooLong, info.Duration.Round(time.Second), l.MaxDuration)
+	}
+	return nil
+}
+
+const maxFilenameLength = 255
+
+// SanitizeFilename keeps the base name of a client supplied file name
+// without path separators and control characters. Returns "" if nothing
+// is left.
+func SanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
@@ -0,0 +1,382 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	probeHeadSize = 64 << 10
+	probeTailSize = 64 << 10
+)
+
+// MediaInfo is what an upload is checked against.
+type MediaInfo struct {
+	ContentType string
+	Size        int64
+	// Duration - 0, если по заголовкам длительность не определить (webm, mp4, ...)
+	Duration time.Duration
+}
+
+// Probe collects what is needed to check a file while it streams: the first
+// bytes for sniffing and headers, the last bytes for the end position of
+// OGG, and the total size.
+type Probe struct {
+	head []byte
+	tail []byte
+	size int64
+}
+
+func (p *Probe) Write(b []byte) (int, error) {
+	p.size += int64(len(b))
+
+	if room := probeHeadSize - len(p.head); room > 0 {
+		p.head = append(p.head, b[:min(room, len(b))]...)
+	}
+
+	p.tail = append(p.tail, b...)
+	if len(p.tail) > 2*probeTailSize {
+		p.tail = append(p.tail[:0:0], p.tail[len(p.tail)-probeTailSize:]...)
+	}
+
+	return len(b), nil
+}
+
+func (p *Probe) Info() MediaInfo {
+	tail := p.tail
+	if len(tail) > probeTailSize {
+		tail = tail[len(tail)-probeTailSize:]
+	}
+
+	return inspect(p.head, 0, tail, p.size)
+}
+
+// ProbeFile is Probe for a file on disk.
+func ProbeFile(path string) (MediaInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return MediaInfo{}, fmt.Errorf("file open error: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return MediaInfo{}, fmt.Errorf("file stat error: %w", err)
+	}
+	size := stat.Size()
+
+	head, err := readAt(file, 0, probeHeadSize, size)
+	if err != nil {
+		return MediaInfo{}, err
+	}
+	tail, err := readAt(file, max(size-probeTailSize, 0), probeTailSize, size)
+	if err != nil {
+		return MediaInfo{}, err
+	}
+
+	info := inspect(head, 0, tail, size)
+
+	// обложка в ID3 может не поместиться в head, тогда кадры читаем за тегом
+	if info.ContentType == "audio/mpeg" && info.Duration == 0 {
+		if tagEnd := id3Size(head); tagEnd > 0 && tagEnd < size {
+			frames, err := readAt(file, tagEnd, probeHeadSize, size)
+			if err != nil {
+				return info, err
+			}
+			info.Duration = durationMP3(frames, tagEnd, tail, size)
+		}
+	}
+
+	return info, nil
+}
+
+// Sniff names the container by content only, a declared type is not trusted.
+func Sniff(head []byte) string {
+	return normalize(mimetype.Detect(head).String())
+}
+
+func inspect(head []byte, offset int64, tail []byte, size int64) MediaInfo {
+	info := MediaInfo{
+		ContentType: Sniff(head),
+		Size:        size,
+	}
+
+	switch info.ContentType {
+	case "audio/wav":
+		info.Duration = durationWAV(head, size)
+	case "audio/mpeg":
+		info.Duration = durationMP3(head, offset, tail, size)
+	case "audio/ogg":
+		info.Duration = durationOgg(head, tail)
+	case "audio/flac":
+		info.Duration = durationFLAC(head)
+	}
+
+	return info
+}
+
+func readAt(file *os.File, offset int64, length int64, size int64) ([]byte, error) {
+	buf := make([]byte, min(length, size-offset))
+	if _, err := file.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("file read error: %w", err)
+	}
+	return buf, nil
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+// durationWAV делит размер data-чанка на byte rate из fmt.
+func durationWAV(head []byte, size int64) time.Duration {
+	if len(head) < 12 || string(head[0:4]) != "RIFF" || string(head[8:12]) != "WAVE" {
+		return 0
+	}
+
+	var byteRate int64
+	offset := int64(12)
+	for offset+8 <= int64(len(head)) {
+		id := string(head[offset : offset+4])
+		chunkSize := int64(binary.LittleEndian.Uint32(head[offset+4 : offset+8]))
+		offset += 8
+
+		switch id {
+		case "fmt ":
+			if offset+16 > int64(len(head)) {
+				return 0
+			}
+			byteRate = int64(binary.LittleEndian.Uint32(head[offset+8 : offset+12]))
+		case "data":
+			if byteRate == 0 {
+				return 0
+			}
+			// потоковые WAV пишут 0 или 0xFFFFFFFF вместо размера
+			dataSize := size - offset
+			if chunkSize > 0 && chunkSize < dataSize {
+				dataSize = chunkSize
+			}
+			return seconds(float64(dataSize) / float64(byteRate))
+		}
+
+		offset += chunkSize + chunkSize%2
+	}
+
+	return 0
+}
+
+var mp3Bitrates = map[[2]int][16]int{
+	{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mp3SampleRates = map[int][3]int{
+	1:  {44100, 48000, 32000},
+	2:  {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+type mp3Frame struct {
+	version    int // 1, 2 или 25 (MPEG 2.5)
+	layer      int
+	bitrate    int // кбит/с
+	sampleRate int
+	mono       bool
+	size       int
+	samples    int
+}
+
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	var frame mp3Frame
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return frame, false
+	}
+
+	switch (b[1] >> 3) & 3 {
+	case 0:
+		frame.version = 25
+	case 2:
+		frame.version = 2
+	case 3:
+		frame.version = 1
+	default:
+		return frame, false
+	}
+
+	frame.layer = 4 - int((b[1]>>1)&3)
+	bitrateIndex := int(b[2] >> 4)
+	sampleRateIndex := int((b[2] >> 2) & 3)
+	if frame.layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return frame, false
+	}
+
+	tableVersion := min(frame.version, 2)
+	frame.bitrate = mp3Bitrates[[2]int{tableVersion, frame.layer}][bitrateIndex]
+	frame.sampleRate = mp3SampleRates[frame.version][sampleRateIndex]
+	frame.mono = b[3]>>6 == 3
+	padding := int((b[2] >> 1) & 1)
+
+	switch {
+	case frame.layer == 1:
+		frame.samples = 384
+		frame.size = (12*frame.bitrate*1000/frame.sampleRate + padding) * 4
+	case frame.layer == 3 && frame.version != 1:
+		frame.samples = 576
+		frame.size = 72*frame.bitrate*1000/frame.sampleRate + padding
+	default:
+		frame.samples = 1152
+		frame.size = 144*frame.bitrate*1000/frame.sampleRate + padding
+	}
+
+	return frame, true
+}
+
+// id3Size returns the length of the ID3v2 tag at the start of the file.
+func id3Size(head []byte) int64 {
+	if len(head) < 10 || string(head[0:3]) != "ID3" {
+		return 0
+	}
+
+	size := int64(head[6])<<21 | int64(head[7])<<14 | int64(head[8])<<7 | int64(head[9])
+	size += 10
+	if head[5]&0x10 != 0 {
+		size += 10
+	}
+
+	return size
+}
+
+// durationMP3 берёт число кадров из заголовка Xing/Info или VBRI, а без него
+// считает файл CBR и делит размер на битрейт первого кадра. data starts at
+// offset bytes into the file.
+func durationMP3(data []byte, offset int64, tail []byte, size int64) time.Duration {
+	start := int64(0)
+	if offset == 0 {
+		start = id3Size(data)
+	}
+
+	// первый кадр подтверждаем следующим, чтобы не принять мусор за синхрослово
+	var frame mp3Frame
+	found := false
+	for i := start; i+4 <= int64(len(data)) && !found; i++ {
+		candidate, ok := parseMP3Frame(data[i:])
+		if !ok {
+			continue
+		}
+		next := i + int64(candidate.size)
+		if next+4 <= int64(len(data)) {
+			if _, ok := parseMP3Frame(data[next:]); !ok {
+				continue
+			}
+		}
+		frame, start, found = candidate, i, true
+	}
+	if !found {
+		return 0
+	}
+
+	sideInfo := 32
+	switch {
+	case frame.version == 1 && frame.mono:
+		sideInfo = 17
+	case frame.version != 1 && frame.mono:
+		sideInfo = 9
+	case frame.version != 1:
+		sideInfo = 17
+	}
+
+	frames := int64(0)
+	if xing := start + 4 + int64(sideInfo); frame.layer == 3 && xing+12 <= int64(len(data)) {
+		tag := string(data[xing : xing+4])
+		flags := binary.BigEndian.Uint32(data[xing+4 : xing+8])
+		if (tag == "Xing" || tag == "Info") && flags&1 != 0 {
+			frames = int64(binary.BigEndian.Uint32(data[xing+8 : xing+12]))
+		}
+	}
+	if vbri := start + 36; frames == 0 && vbri+18 <= int64(len(data)) && string(data[vbri:vbri+4]) == "VBRI" {
+		frames = int64(binary.BigEndian.Uint32(data[vbri+14 : vbri+18]))
+	}
+	if frames > 0 {
+		return seconds(float64(frames) * float64(frame.samples) / float64(frame.sampleRate))
+	}
+
+	audioSize := size - offset - start
+	if len(tail) >= 128 && string(tail[len(tail)-128:len(tail)-125]) == "TAG" {
+		audioSize -= 128
+	}
+	if audioSize <= 0 {
+		return 0
+	}
+
+	return seconds(float64(audioSize) * 8 / float64(frame.bitrate*1000))
+}
+
+// durationOgg делит granule position последней страницы на частоту из
+// заголовка Vorbis или Opus (у Opus она всегда 48 кГц).
+func durationOgg(head []byte, tail []byte) time.Duration {
+	if len(head) < 28 || string(head[0:4]) != "OggS" {
+		return 0
+	}
+
+	packetStart := 27 + int(head[26])
+	if packetStart >= len(head) {
+		return 0
+	}
+	packet := head[packetStart:]
+
+	var sampleRate, preSkip int64
+	switch {
+	case len(packet) >= 16 && packet[0] == 1 && string(packet[1:7]) == "vorbis":
+		sampleRate = int64(binary.LittleEndian.Uint32(packet[12:16]))
+	case len(packet) >= 12 && string(packet[0:8]) == "OpusHead":
+		sampleRate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+	default:
+		return 0
+	}
+	if sampleRate == 0 {
+		return 0
+	}
+
+	for end := len(tail); end > 0; {
+		i := bytes.LastIndex(tail[:end], []byte("OggS"))
+		if i < 0 {
+			break
+		}
+		end = i
+		if i+14 > len(tail) || tail[i+4] != 0 {
+			continue
+		}
+		granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14]))
+		if granule > preSkip {
+			return seconds(float64(granule-preSkip) / float64(sampleRate))
+		}
+	}
+
+	return 0
+}
+
+// durationFLAC читает число сэмплов и частоту из STREAMINFO.
+func durationFLAC(head []byte) time.Duration {
+	if len(head) < 26 || string(head[0:4]) != "fLaC" || head[4]&0x7F != 0 {
+		return 0
+	}
+
+	info := head[8:]
+	sampleRate := int64(info[10])<<12 | int64(info[11])<<4 | int64(info[12])>>4
+	samples := int64(info[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(info[14:18]))
+	if sampleRate == 0 || samples == 0 {
+		return 0
+	}
+
+	return seconds(float64(samples) / float64(sampleRate))
+}
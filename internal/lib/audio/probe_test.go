@@ -0,0 +1,209 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mp3Xing is a stream whose first frame carries an Info tag with the frame count.
+func mp3Xing(frames uint32, count int) []byte {
+	data := mp3Frames(count)
+	// тег после 4 байт заголовка и 32 байт side info
+	copy(data[36:], "Info")
+	binary.BigEndian.PutUint32(data[40:], 1)
+	binary.BigEndian.PutUint32(data[44:], frames)
+	return data
+}
+
+func TestProbeFile(t *testing.T) {
+	var streaming bytes.Buffer
+	WriteWAVHeader(&streaming, 16000, 1, WAVUnknownSize)
+	streaming.Write(make([]byte, 16000))
+
+	id3v1 := append(mp3Frames(100), append([]byte("TAG"), make([]byte, 125)...)...)
+
+	// обложка больше head: кадры читаются за тегом
+	withCover := append(id3Tag(100000), mp3Frames(100)...)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		duration    time.Duration
+	}{
+		{name: "wav", data: wavBytes(t, 16000, 1, make([]byte, 32000)), contentType: "audio/wav", duration: time.Second},
+		{name: "wav stereo", data: wavBytes(t, 8000, 2, make([]byte, 16000)), contentType: "audio/wav", duration: 500 * time.Millisecond},
+		{name: "streaming wav", data: streaming.Bytes(), contentType: "audio/wav", duration: 500 * time.Millisecond},
+		{name: "mp3 cbr", data: mp3Frames(100), contentType: "audio/mpeg", duration: 2606250 * time.Microsecond},
+		{name: "mp3 id3v2", data: append(id3Tag(1000), mp3Frames(100)...), contentType: "audio/mpeg", duration: 2606250 * time.Microsecond},
+		{name: "mp3 id3v1", data: id3v1, contentType: "audio/mpeg", duration: 2606250 * time.Microsecond},
+		{name: "mp3 large id3v2", data: withCover, contentType: "audio/mpeg", duration: 2606250 * time.Microsecond},
+		// 441 кадр по 1152 сэмпла - ровно 11.52 с
+		{name: "mp3 xing", data: mp3Xing(441, 10), contentType: "audio/mpeg", duration: 11520 * time.Millisecond},
+		{
+			name:        "ogg opus",
+			data:        append(oggPage(2, 0, opusHead(312)), oggPage(4, 48000+312, []byte{0})...),
+			contentType: "audio/ogg",
+			duration:    time.Second,
+		},
+		{
+			name:        "ogg vorbis",
+			data:        append(oggPage(2, 0, vorbisHead(44100)), oggPage(4, 88200, []byte{0})...),
+			contentType: "audio/ogg",
+			duration:    2 * time.Second,
+		},
+		{name: "flac", data: flacHeader(44100, 88200), contentType: "audio/flac", duration: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ProbeFile(writeTemp(t, "in", tt.data))
+			if err != nil {
+				t.Fatalf("ProbeFile: %v", err)
+			}
+			if info.ContentType != tt.contentType {
+				t.Errorf("ContentType = %q, want %q", info.ContentType, tt.contentType)
+			}
+			if info.Size != int64(len(tt.data)) {
+				t.Errorf("Size = %d, want %d", info.Size, len(tt.data))
+			}
+			if info.Duration != tt.duration {
+				t.Errorf("Duration = %v, want %v", info.Duration, tt.duration)
+			}
+		})
+	}
+}
+
+func TestProbeFileMalformed(t *testing.T) {
+	noFmt := wavBytes(t, 8000, 1, make([]byte, 100))
+	copy(noFmt[12:16], "junk")
+
+	zeroRate := wavBytes(t, 8000, 1, make([]byte, 100))
+	binary.LittleEndian.PutUint32(zeroRate[28:32], 0)
+
+	// второй "кадр" не начинается с синхрослова
+	lonelyFrame := append(append([]byte{}, mp3Header...), make([]byte, 1000)...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "riff only", data: []byte("RIFF\x00\x00\x00\x00WAVE")},
+		{name: "wav without fmt", data: noFmt},
+		{name: "wav zero byte rate", data: zeroRate},
+		{name: "truncated fmt", data: wavBytes(t, 8000, 1, nil)[:30]},
+		{name: "mp3 unconfirmed frame", data: lonelyFrame},
+		{name: "id3 only", data: id3Tag(50)},
+		{name: "ogg head only", data: oggPage(2, 0, opusHead(312))},
+		{name: "ogg unknown codec", data: append(oggPage(2, 0, []byte("Speex   ")), oggPage(4, 1000, []byte{0})...)},
+		{name: "ogg truncated", data: oggPage(2, 0, opusHead(312))[:30]},
+		{name: "ogg vorbis zero rate", data: append(oggPage(2, 0, vorbisHead(0)), oggPage(4, 88200, []byte{0})...)},
+		{name: "ogg granule within pre-skip", data: append(oggPage(2, 0, opusHead(312)), oggPage(4, 100, []byte{0})...)},
+		{name: "flac truncated", data: flacHeader(44100, 88200)[:20]},
+		{name: "flac zero samples", data: flacHeader(44100, 0)},
+		{name: "flac zero rate", data: flacHeader(0, 88200)},
+		{name: "binary", data: []byte{0x00, 0x01, 0x02, 0x03, 0xFE, 0xFF}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ProbeFile(writeTemp(t, "in", tt.data))
+			if err != nil {
+				t.Fatalf("ProbeFile: %v", err)
+			}
+			if info.Duration != 0 {
+				t.Errorf("Duration = %v, want 0", info.Duration)
+			}
+		})
+	}
+}
+
+func TestProbeFileMissing(t *testing.T) {
+	if _, err := ProbeFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("no error")
+	}
+}
+
+// Probe over chunked writes must agree with ProbeFile, including files larger
+// than the head and tail windows.
+func TestProbeWrites(t *testing.T) {
+	// страница с данными больше хвостового окна между заголовком и последней страницей
+	bigOgg := append(oggPage(2, 0, opusHead(312)), oggPage(0, 0, make([]byte, 255))...)
+	bigOgg = append(bigOgg, make([]byte, 3*probeTailSize)...)
+	bigOgg = append(bigOgg, oggPage(4, 10*48000+312, []byte{0})...)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		chunk int
+	}{
+		{name: "wav", data: wavBytes(t, 16000, 1, make([]byte, 320000)), chunk: 4096},
+		{name: "mp3", data: mp3Frames(1000), chunk: 1000},
+		{name: "mp3 single bytes", data: mp3Frames(10), chunk: 1},
+		{name: "ogg", data: bigOgg, chunk: 7000},
+		{name: "flac", data: flacHeader(48000, 480000), chunk: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := ProbeFile(writeTemp(t, "in", tt.data))
+			if err != nil {
+				t.Fatalf("ProbeFile: %v", err)
+			}
+			if want.Duration == 0 {
+				t.Fatalf("ProbeFile found no duration")
+			}
+
+			var probe Probe
+			for data := tt.data; len(data) > 0; {
+				n := min(tt.chunk, len(data))
+				probe.Write(data[:n])
+				data = data[n:]
+			}
+
+			if got := probe.Info(); got != want {
+				t.Errorf("Info = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseMP3Frame(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		ok     bool
+		size   int
+		rate   int
+	}{
+		{name: "mpeg1 layer3 128k", header: mp3Header, ok: true, size: 417, rate: 44100},
+		{name: "mpeg1 layer3 padded", header: []byte{0xFF, 0xFB, 0x92, 0x00}, ok: true, size: 418, rate: 44100},
+		// MPEG-2 Layer III, 64 кбит/с, 22.05 кГц
+		{name: "mpeg2 layer3", header: []byte{0xFF, 0xF3, 0x80, 0xC0}, ok: true, size: 208, rate: 22050},
+		// MPEG-1 Layer I, 128 кбит/с, 48 кГц
+		{name: "mpeg1 layer1", header: []byte{0xFF, 0xFF, 0x44, 0x00}, ok: true, size: 128, rate: 48000},
+		{name: "no sync", header: []byte{0xFF, 0x0B, 0x90, 0x00}},
+		{name: "reserved version", header: []byte{0xFF, 0xEB, 0x90, 0x00}},
+		{name: "reserved layer", header: []byte{0xFF, 0xF9, 0x90, 0x00}},
+		{name: "free bitrate", header: []byte{0xFF, 0xFB, 0x00, 0x00}},
+		{name: "bad bitrate", header: []byte{0xFF, 0xFB, 0xF0, 0x00}},
+		{name: "bad sample rate", header: []byte{0xFF, 0xFB, 0x9C, 0x00}},
+		{name: "short", header: []byte{0xFF, 0xFB}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, ok := parseMP3Frame(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (frame.size != tt.size || frame.sampleRate != tt.rate) {
+				t.Errorf("size %d rate %d, want size %d rate %d", frame.size, frame.sampleRate, tt.size, tt.rate)
+			}
+		})
+	}
+}
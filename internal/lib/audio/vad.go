@@ -0,0 +1,383 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+var ErrUnsupportedWAV = errors.New("only 16 bit PCM WAV is supported")
+
+// VAD is an energy based voice activity detector for 16 bit PCM.
+// A frame is speech when its RMS level is above Threshold.
+type VAD struct {
+	// Threshold - уровень в dBFS, например -45
+	Threshold     float64
+	FrameDuration time.Duration
+	// Padding - сколько тишины оставить вокруг речи при обрезке
+	Padding time.Duration
+	// AutoStopSilence - после стольких секунд тишины после речи поток останавливается, 0 - никогда
+	AutoStopSilence time.Duration
+}
+
+func (v VAD) frameSize(sampleRate, channels int) int {
+	blockAlign := channels * pcmBitsPerSample / 8
+	samples := int(int64(sampleRate) * int64(v.FrameDuration) / int64(time.Second))
+	if samples < 1 {
+		samples = 1
+	}
+	return samples * blockAlign
+}
+
+func (v VAD) isSpeech(frame []byte) bool {
+	samples := len(frame) / 2
+	if samples == 0 {
+		return false
+	}
+
+	var sum float64
+	for i := 0; i+1 < len(frame); i += 2 {
+		sample := float64(int16(binary.LittleEndian.Uint16(frame[i:])))
+		sum += sample * sample
+	}
+	rms := math.Sqrt(sum / float64(samples))
+	if rms == 0 {
+		return false
+	}
+
+	return 20*math.Log10(rms/math.MaxInt16) > v.Threshold
+}
+
+// Detector follows a PCM stream and counts speech and trailing silence.
+type Detector struct {
+	vad           VAD
+	frameSize     int
+	frameDuration time.Duration
+	buf           []byte
+
+	speech          time.Duration
+	trailingSilence time.Duration
+}
+
+func (v VAD) NewDetector(sampleRate, channels int) *Detector {
+	frameSize := v.frameSize(sampleRate, channels)
+	blockAlign := channels * pcmBitsPerSample / 8
+
+	return &Detector{
+		vad:           v,
+		frameSize:     frameSize,
+		frameDuration: time.Duration(int64(frameSize/blockAlign) * int64(time.Second) / int64(sampleRate)),
+	}
+}
+
+// Write takes PCM data of any length, incomplete frames wait for the next call.
+func (d *Detector) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+
+	offset := 0
+	for ; offset+d.frameSize <= len(d.buf); offset += d.frameSize {
+		if d.vad.isSpeech(d.buf[offset : offset+d.frameSize]) {
+			d.speech += d.frameDuration
+			d.trailingSilence = 0
+		} else {
+			d.trailingSilence += d.frameDuration
+		}
+	}
+	d.buf = append(d.buf[:0], d.buf[offset:]...)
+
+	return len(p), nil
+}
+
+func (d *Detector) SpeechDuration() time.Duration {
+	return d.speech
+}
+
+// Silent reports that there was speech and then AutoStopSilence of silence.
+func (d *Detector) Silent() bool {
+	return d.vad.AutoStopSilence > 0 && d.speech > 0 && d.trailingSilence >= d.vad.AutoStopSilence
+}
+
+// maxHeldSilence - сколько тишины Trimmer держит в памяти, более длинная
+// тишина в начале обрезается с начала, в середине записывается как есть
+const maxHeldSilence = 30 * time.Second
+
+// Trimmer cuts leading and trailing silence of a PCM stream on the fly, like
+// TrimWAV does for a file. Silence is held back until speech follows it, so
+// trailing silence is dropped by Flush. A stream without speech is written
+// as is, but no more than maxHeldSilence of it.
+type Trimmer struct {
+	vad           VAD
+	w             io.Writer
+	frameSize     int
+	frameDuration time.Duration
+	padding       int
+	maxHeld       int
+	buf           []byte
+
+	held     []byte
+	speech   bool
+	duration time.Duration
+}
+
+func (v VAD) NewTrimmer(w io.Writer, sampleRate, channels int) *Trimmer {
+	blockAlign := channels * pcmBitsPerSample / 8
+	bytesFor := func(d time.Duration) int {
+		return int(int64(d)*int64(sampleRate)/int64(time.Second)) * blockAlign
+	}
+
+	detector := v.NewDetector(sampleRate, channels)
+
+	return &Trimmer{
+		vad:           v,
+		w:             w,
+		frameSize:     detector.frameSize,
+		frameDuration: detector.frameDuration,
+		padding:       bytesFor(v.Padding),
+		maxHeld:       max(bytesFor(maxHeldSilence), bytesFor(v.Padding)),
+	}
+}
+
+func (t *Trimmer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+
+	offset := 0
+	for ; offset+t.frameSize <= len(t.buf); offset += t.frameSize {
+		if err := t.frame(t.buf[offset : offset+t.frameSize]); err != nil {
+			return len(p), err
+		}
+	}
+	t.buf = append(t.buf[:0], t.buf[offset:]...)
+
+	return len(p), nil
+}
+
+func (t *Trimmer) frame(frame []byte) error {
+	if !t.vad.isSpeech(frame) {
+		t.held = append(t.held, frame...)
+		if len(t.held) <= t.maxHeld {
+			return nil
+		}
+		if !t.speech {
+			// до речи старое уже не понадобится
+			t.held = append(t.held[:0], t.held[len(t.held)-t.maxHeld:]...)
+			return nil
+		}
+		// пауза в середине, дальше может быть речь
+		return t.write(t.held)
+	}
+
+	t.duration += t.frameDuration
+
+	held := t.held
+	if !t.speech && len(held) > t.padding {
+		held = held[len(held)-t.padding:]
+	}
+	t.speech = true
+	if err := t.write(held); err != nil {
+		return err
+	}
+
+	_, err := t.w.Write(frame)
+	return err
+}
+
+func (t *Trimmer) write(data []byte) error {
+	_, err := t.w.Write(data)
+	t.held = t.held[:0]
+	return err
+}
+
+// SpeechDuration is the speech seen so far, like Detector.SpeechDuration.
+func (t *Trimmer) SpeechDuration() time.Duration {
+	return t.duration
+}
+
+// Flush writes the padding after the last speech and drops the rest.
+func (t *Trimmer) Flush() error {
+	t.held = append(t.held, t.buf...)
+	t.buf = t.buf[:0]
+
+	if t.speech && len(t.held) > t.padding {
+		t.held = t.held[:t.padding]
+	}
+
+	return t.write(t.held)
+}
+
+// WAVInfo describes the PCM data of a WAV file.
+type WAVInfo struct {
+	AudioFormat   int
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	DataOffset    int64
+	DataSize      int64
+}
+
+// ReadWAVInfo walks the RIFF chunks up to the data chunk.
+func ReadWAVInfo(file *os.File) (WAVInfo, error) {
+	info, size, err := readWAVChunks(file)
+	if err != nil {
+		return info, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return info, fmt.Errorf("file stat error: %w", err)
+	}
+	// потоковые WAV пишут 0 или 0xFFFFFFFF вместо размера
+	info.DataSize = stat.Size() - info.DataOffset
+	if size > 0 && size < info.DataSize {
+		info.DataSize = size
+	}
+
+	return info, nil
+}
+
+// ParseWAVHeader reads the chunks before the data of a WAV that is still
+// arriving. DataSize is the size from the header, -1 if the header does not
+// know it. io.ErrUnexpectedEOF means head ends before the data chunk.
+func ParseWAVHeader(head []byte) (WAVInfo, error) {
+	info, size, err := readWAVChunks(bytes.NewReader(head))
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return info, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return info, err
+	}
+
+	info.DataSize = size
+	if size == 0 || size == WAVUnknownSize {
+		info.DataSize = -1
+	}
+
+	return info, nil
+}
+
+// readWAVChunks returns the format and the data offset with the data size
+// written in the header.
+func readWAVChunks(r io.ReaderAt) (WAVInfo, int64, error) {
+	var info WAVInfo
+
+	riff := make([]byte, 12)
+	if _, err := r.ReadAt(riff, 0); err != nil {
+		return info, 0, fmt.Errorf("riff header read error: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return info, 0, ErrUnsupportedWAV
+	}
+
+	offset := int64(12)
+	chunk := make([]byte, 8)
+	for {
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			return info, 0, fmt.Errorf("chunk read error: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		offset += 8
+
+		switch id {
+		case "fmt ":
+			fmtChunk := make([]byte, 16)
+			if _, err := r.ReadAt(fmtChunk, offset); err != nil {
+				return info, 0, fmt.Errorf("fmt chunk read error: %w", err)
+			}
+			info.AudioFormat = int(binary.LittleEndian.Uint16(fmtChunk[0:2]))
+			info.Channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			info.BitsPerSample = int(binary.LittleEndian.Uint16(fmtChunk[14:16]))
+		case "data":
+			info.DataOffset = offset
+			return info, size, nil
+		}
+
+		// чанки выравнены по двум байтам
+		offset += size + size%2
+	}
+}
+
+// IsPCM16 tells whether VAD can read the data.
+func (i WAVInfo) IsPCM16() bool {
+	return i.AudioFormat == 1 && i.BitsPerSample == pcmBitsPerSample && i.Channels >= 1 && i.SampleRate >= 1
+}
+
+// TrimWAV cuts leading and trailing silence of a 16 bit PCM WAV file in place
+// and returns the speech duration. A file without speech is left as is.
+func (v VAD) TrimWAV(path string) (time.Duration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("file open error: %w", err)
+	}
+	defer file.Close()
+
+	info, err := ReadWAVInfo(file)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsPCM16() {
+		return 0, ErrUnsupportedWAV
+	}
+
+	detector := v.NewDetector(info.SampleRate, info.Channels)
+	frame := make([]byte, detector.frameSize)
+	data := io.NewSectionReader(file, info.DataOffset, info.DataSize)
+
+	first, last := int64(-1), int64(-1)
+	for position := int64(0); ; position += int64(detector.frameSize) {
+		n, err := io.ReadFull(data, frame)
+		if n > 0 && v.isSpeech(frame[:n]) {
+			if first < 0 {
+				first = position
+			}
+			last = position + int64(n)
+			detector.speech += detector.frameDuration
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if first < 0 {
+		return 0, nil
+	}
+
+	blockAlign := int64(info.Channels * pcmBitsPerSample / 8)
+	padding := int64(v.Padding) * int64(info.SampleRate) / int64(time.Second) * blockAlign
+	start := max(first-padding, 0)
+	end := min(last+padding, info.DataSize)
+	end -= end % blockAlign
+	if start == 0 && end == info.DataSize {
+		return detector.speech, nil
+	}
+
+	tmpPath := path + ".trim"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("file creation error: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err := WriteWAVHeader(tmp, info.SampleRate, info.Channels, uint32(end-start)); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("file write error: %w", err)
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(file, info.DataOffset+start, end-start)); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("file write error: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("file close error: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("file rename error: %w", err)
+	}
+
+	return detector.speech, nil
+}
@@ -0,0 +1,290 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// tone returns samples of 16 bit mono PCM with a constant level, its RMS is
+// the amplitude.
+func tone(amplitude int16, samples int) []byte {
+	data := make([]byte, 2*samples)
+	for i := 0; i < samples; i++ {
+		sample := amplitude
+		if i%2 == 1 {
+			sample = -amplitude
+		}
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+	}
+	return data
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// testVAD: кадр 25 мс при 8 кГц - 200 сэмплов, секунда - ровно 40 кадров
+var testVAD = VAD{
+	Threshold:     -45,
+	FrameDuration: 25 * time.Millisecond,
+	Padding:       100 * time.Millisecond,
+}
+
+const testRate = 8000
+
+func TestIsSpeech(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		want  bool
+	}{
+		{name: "digital silence", frame: tone(0, 200), want: false},
+		// 100/32767 - около -50 dBFS
+		{name: "noise below threshold", frame: tone(100, 200), want: false},
+		// 300/32767 - около -41 dBFS
+		{name: "quiet speech", frame: tone(300, 200), want: true},
+		{name: "full scale", frame: tone(32767, 200), want: true},
+		{name: "negative full scale", frame: tone(-32768, 200), want: true},
+		{name: "empty", frame: nil, want: false},
+		{name: "single byte", frame: []byte{0xFF}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testVAD.isSpeech(tt.frame); got != tt.want {
+				t.Errorf("isSpeech = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetector(t *testing.T) {
+	vad := testVAD
+	vad.AutoStopSilence = 500 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		vad      VAD
+		writes   [][]byte
+		speech   time.Duration
+		stopping bool
+	}{
+		{
+			name:     "silence after speech",
+			vad:      vad,
+			writes:   [][]byte{tone(0, 4000), tone(1000, 8000), tone(0, 4000)},
+			speech:   time.Second,
+			stopping: true,
+		},
+		{
+			name:   "short pause",
+			vad:    vad,
+			writes: [][]byte{tone(1000, 8000), tone(0, 3200)},
+			speech: time.Second,
+		},
+		{
+			name:   "silence only",
+			vad:    vad,
+			writes: [][]byte{tone(0, 16000)},
+		},
+		{
+			name:   "auto stop off",
+			vad:    testVAD,
+			writes: [][]byte{tone(1000, 8000), tone(0, 80000)},
+			speech: time.Second,
+		},
+		{
+			// кадры собираются из кусков разной длины
+			name:     "split frames",
+			vad:      vad,
+			writes:   [][]byte{tone(1000, 8000)[:3], tone(1000, 8000)[3:], tone(0, 4000)[:1001], tone(0, 4000)[1001:]},
+			speech:   time.Second,
+			stopping: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := tt.vad.NewDetector(testRate, 1)
+			for _, data := range tt.writes {
+				detector.Write(data)
+			}
+			if got := detector.SpeechDuration(); got != tt.speech {
+				t.Errorf("SpeechDuration = %v, want %v", got, tt.speech)
+			}
+			if got := detector.Silent(); got != tt.stopping {
+				t.Errorf("Silent = %v, want %v", got, tt.stopping)
+			}
+		})
+	}
+}
+
+func TestTrimWAV(t *testing.T) {
+	tests := []struct {
+		name     string
+		pcm      []byte
+		speech   time.Duration
+		wantData []byte
+	}{
+		{
+			name: "silence around speech",
+			pcm:  concat(tone(0, 8000), tone(1000, 4000), tone(0, 8000)),
+			// по 100 мс тишины вокруг речи
+			speech:   500 * time.Millisecond,
+			wantData: concat(tone(0, 800), tone(1000, 4000), tone(0, 800)),
+		},
+		{
+			name:     "speech from the start",
+			pcm:      concat(tone(1000, 4000), tone(0, 8000)),
+			speech:   500 * time.Millisecond,
+			wantData: concat(tone(1000, 4000), tone(0, 800)),
+		},
+		{
+			name:     "nothing to trim",
+			pcm:      tone(1000, 4000),
+			speech:   500 * time.Millisecond,
+			wantData: tone(1000, 4000),
+		},
+		{
+			name:     "no speech",
+			pcm:      tone(0, 8000),
+			wantData: tone(0, 8000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTemp(t, "in.wav", wavBytes(t, testRate, 1, tt.pcm))
+
+			speech, err := testVAD.TrimWAV(path)
+			if err != nil {
+				t.Fatalf("TrimWAV: %v", err)
+			}
+			if speech != tt.speech {
+				t.Errorf("speech = %v, want %v", speech, tt.speech)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := wavBytes(t, testRate, 1, tt.wantData); !bytes.Equal(got, want) {
+				t.Errorf("file is %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestTrimWAVUnsupported(t *testing.T) {
+	eightBit := wavBytes(t, testRate, 1, make([]byte, 100))
+	binary.LittleEndian.PutUint16(eightBit[34:36], 8)
+
+	float := wavBytes(t, testRate, 1, make([]byte, 100))
+	binary.LittleEndian.PutUint16(float[20:22], 3)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "8 bit", data: eightBit},
+		{name: "float", data: float},
+		{name: "not riff", data: []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testVAD.TrimWAV(writeTemp(t, "in.wav", tt.data))
+			if !errors.Is(err, ErrUnsupportedWAV) {
+				t.Errorf("err = %v, want ErrUnsupportedWAV", err)
+			}
+		})
+	}
+
+	if _, err := testVAD.TrimWAV(writeTemp(t, "short.wav", []byte("RIFF"))); err == nil {
+		t.Error("truncated file: no error")
+	}
+}
+
+func TestTrimmer(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes [][]byte
+		want   []byte
+		speech time.Duration
+	}{
+		{
+			name:   "silence around speech",
+			writes: [][]byte{tone(0, 8000), tone(1000, 4000), tone(0, 8000)},
+			want:   concat(tone(0, 800), tone(1000, 4000), tone(0, 800)),
+			speech: 500 * time.Millisecond,
+		},
+		{
+			// паузы внутри речи не обрезаются
+			name:   "pause between speech",
+			writes: [][]byte{tone(1000, 2000), tone(0, 4000), tone(1000, 2000)},
+			want:   concat(tone(1000, 2000), tone(0, 4000), tone(1000, 2000)),
+			speech: 500 * time.Millisecond,
+		},
+		{
+			name:   "split writes",
+			writes: [][]byte{tone(0, 8000)[:7], tone(0, 8000)[7:], tone(1000, 4000)[:301], tone(1000, 4000)[301:], tone(0, 1000)},
+			want:   concat(tone(0, 800), tone(1000, 4000), tone(0, 800)),
+			speech: 500 * time.Millisecond,
+		},
+		{
+			name:   "no speech",
+			writes: [][]byte{tone(0, 4000)},
+			want:   tone(0, 4000),
+		},
+		{
+			// без речи в памяти держится не больше maxHeldSilence
+			name:   "long silence without speech",
+			writes: [][]byte{tone(0, 8000*35)},
+			want:   tone(0, 8000*30),
+		},
+		{
+			name:   "empty",
+			writes: nil,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			trimmer := testVAD.NewTrimmer(&out, testRate, 1)
+			for _, data := range tt.writes {
+				if n, err := trimmer.Write(data); err != nil || n != len(data) {
+					t.Fatalf("Write = %d, %v", n, err)
+				}
+			}
+			if err := trimmer.Flush(); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+
+			if !bytes.Equal(out.Bytes(), tt.want) {
+				t.Errorf("got %d bytes, want %d", out.Len(), len(tt.want))
+			}
+			if got := trimmer.SpeechDuration(); got != tt.speech {
+				t.Errorf("SpeechDuration = %v, want %v", got, tt.speech)
+			}
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestTrimmerWriteError(t *testing.T) {
+	trimmer := testVAD.NewTrimmer(failingWriter{}, testRate, 1)
+	if _, err := trimmer.Write(tone(1000, 400)); err == nil {
+		t.Error("Write: no error from the writer")
+	}
+}
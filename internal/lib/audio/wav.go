@@ -0,0 +1,90 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	WAVHeaderSize = 44
+	// WAVUnknownSize пишется в заголовок потокового WAV, длина которого неизвестна
+	WAVUnknownSize = 0xFFFFFFFF
+
+	pcmBitsPerSample = 16
+)
+
+// WriteWAVHeader writes a canonical 44 byte PCM WAV header.
+// dataSize may be WAVUnknownSize and fixed later with FinalizeWAV.
+func WriteWAVHeader(w io.Writer, sampleRate, channels int, dataSize uint32) error {
+	blockAlign := channels * pcmBitsPerSample / 8
+	byteRate := sampleRate * blockAlign
+
+	riffSize := uint32(WAVUnknownSize)
+	if dataSize != WAVUnknownSize {
+		riffSize = 36 + dataSize
+	}
+
+	header := make([]byte, WAVHeaderSize)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], riffSize)
+	copy(header[8:12], "WAVE")
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:24], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(byteRate))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:36], pcmBitsPerSample)
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], dataSize)
+
+	_, err := w.Write(header)
+	return err
+}
+
+// FinalizeWAV fixes the RIFF and data chunk sizes after the PCM data is written.
+func FinalizeWAV(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("file open error: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("file stat error: %w", err)
+	}
+	if info.Size() < WAVHeaderSize {
+		return fmt.Errorf("file is shorter than WAV header: %d bytes", info.Size())
+	}
+
+	dataSize := uint32(info.Size() - WAVHeaderSize)
+
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, 36+dataSize)
+	if _, err := file.WriteAt(size, 4); err != nil {
+		return fmt.Errorf("file write error: %w", err)
+	}
+
+	binary.LittleEndian.PutUint32(size, dataSize)
+	if _, err := file.WriteAt(size, 40); err != nil {
+		return fmt.Errorf("file write error: %w", err)
+	}
+
+	return nil
+}
+
+// PatchWAVHeader is FinalizeWAV for a header that is still in memory: it puts
+// the sizes of a size byte long file into a header written with WAVUnknownSize.
+func PatchWAVHeader(header []byte, size int64) {
+	if len(header) < WAVHeaderSize || size < WAVHeaderSize {
+		return
+	}
+
+	dataSize := uint32(size - WAVHeaderSize)
+	binary.LittleEndian.PutUint32(header[4:8], 36+dataSize)
+	binary.LittleEndian.PutUint32(header[40:44], dataSize)
+}
@@ -0,0 +1,252 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// wavBytes builds a 16 bit PCM WAV with the given data.
+func wavBytes(t *testing.T, sampleRate, channels int, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteWAVHeader(&buf, sampleRate, channels, uint32(len(data))); err != nil {
+		t.Fatalf("WriteWAVHeader: %v", err)
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func writeTemp(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func readWAVInfo(t *testing.T, path string) (WAVInfo, error) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+
+	return ReadWAVInfo(file)
+}
+
+func TestWriteWAVHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataSize uint32
+		riffSize uint32
+	}{
+		{name: "known size", dataSize: 16000, riffSize: 36 + 16000},
+		{name: "streaming", dataSize: WAVUnknownSize, riffSize: WAVUnknownSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteWAVHeader(&buf, 48000, 2, tt.dataSize); err != nil {
+				t.Fatalf("WriteWAVHeader: %v", err)
+			}
+
+			header := buf.Bytes()
+			if len(header) != WAVHeaderSize {
+				t.Fatalf("header is %d bytes, want %d", len(header), WAVHeaderSize)
+			}
+			if got := binary.LittleEndian.Uint32(header[4:8]); got != tt.riffSize {
+				t.Errorf("RIFF size = %d, want %d", got, tt.riffSize)
+			}
+			if got := binary.LittleEndian.Uint32(header[28:32]); got != 48000*4 {
+				t.Errorf("byte rate = %d, want %d", got, 48000*4)
+			}
+			if got := binary.LittleEndian.Uint16(header[32:34]); got != 4 {
+				t.Errorf("block align = %d, want 4", got)
+			}
+			if got := binary.LittleEndian.Uint32(header[40:44]); got != tt.dataSize {
+				t.Errorf("data size = %d, want %d", got, tt.dataSize)
+			}
+		})
+	}
+}
+
+func TestFinalizeWAV(t *testing.T) {
+	var buf bytes.Buffer
+	WriteWAVHeader(&buf, 16000, 1, WAVUnknownSize)
+	buf.Write(make([]byte, 1000))
+	path := writeTemp(t, "stream.wav", buf.Bytes())
+
+	if err := FinalizeWAV(path); err != nil {
+		t.Fatalf("FinalizeWAV: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.LittleEndian.Uint32(data[4:8]); got != 36+1000 {
+		t.Errorf("RIFF size = %d, want %d", got, 36+1000)
+	}
+	if got := binary.LittleEndian.Uint32(data[40:44]); got != 1000 {
+		t.Errorf("data size = %d, want 1000", got)
+	}
+}
+
+func TestFinalizeWAVErrors(t *testing.T) {
+	if err := FinalizeWAV(writeTemp(t, "short.wav", []byte("RIFF"))); err == nil {
+		t.Error("FinalizeWAV of a file shorter than the header: no error")
+	}
+	if err := FinalizeWAV(filepath.Join(t.TempDir(), "missing.wav")); err == nil {
+		t.Error("FinalizeWAV of a missing file: no error")
+	}
+}
+
+func TestReadWAVInfo(t *testing.T) {
+	// LIST нечётной длины перед data: чанки выравниваются по двум байтам
+	withList := []byte("RIFF\x00\x00\x00\x00WAVE")
+	withList = append(withList, wavBytes(t, 8000, 1, nil)[12:36]...)
+	withList = append(withList, "LIST\x03\x00\x00\x00abc\x00"...)
+	withList = append(withList, "data\x08\x00\x00\x00"...)
+	withList = append(withList, make([]byte, 8)...)
+
+	// data-чанк короче файла: дальше идут другие чанки
+	trailing := append(wavBytes(t, 8000, 1, make([]byte, 10)), "id3 \x04\x00\x00\x00tags"...)
+
+	// потоковый заголовок: размер неизвестен, данные до конца файла
+	var streaming bytes.Buffer
+	WriteWAVHeader(&streaming, 8000, 2, WAVUnknownSize)
+	streaming.Write(make([]byte, 400))
+
+	tests := []struct {
+		name       string
+		data       []byte
+		dataOffset int64
+		dataSize   int64
+		channels   int
+	}{
+		{name: "canonical", data: wavBytes(t, 8000, 1, make([]byte, 100)), dataOffset: 44, dataSize: 100, channels: 1},
+		{name: "odd chunk", data: withList, dataOffset: 56, dataSize: 8, channels: 1},
+		{name: "trailing chunk", data: trailing, dataOffset: 44, dataSize: 10, channels: 1},
+		{name: "streaming", data: streaming.Bytes(), dataOffset: 44, dataSize: 400, channels: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := readWAVInfo(t, writeTemp(t, "in.wav", tt.data))
+			if err != nil {
+				t.Fatalf("ReadWAVInfo: %v", err)
+			}
+			if info.AudioFormat != 1 || info.BitsPerSample != 16 || info.SampleRate != 8000 || info.Channels != tt.channels {
+				t.Errorf("format = %+v", info)
+			}
+			if info.DataOffset != tt.dataOffset || info.DataSize != tt.dataSize {
+				t.Errorf("data at %d size %d, want at %d size %d", info.DataOffset, info.DataSize, tt.dataOffset, tt.dataSize)
+			}
+		})
+	}
+}
+
+func TestReadWAVInfoMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "truncated riff", data: []byte("RIFF\x00\x00")},
+		{name: "not wave", data: []byte("RIFF\x00\x00\x00\x00AVI LIST\x00\x00\x00\x00")},
+		{name: "no data chunk", data: wavBytes(t, 8000, 1, nil)[:36]},
+		{name: "truncated fmt", data: []byte("RIFF\x00\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readWAVInfo(t, writeTemp(t, "in.wav", tt.data)); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+func TestParseWAVHeader(t *testing.T) {
+	canonical := wavBytes(t, 8000, 1, make([]byte, 100))
+
+	withList := []byte("RIFF\x00\x00\x00\x00WAVE")
+	withList = append(withList, canonical[12:36]...)
+	withList = append(withList, "LIST\x03\x00\x00\x00abc\x00"...)
+	withList = append(withList, "data\x08\x00\x00\x00"...)
+
+	var streaming bytes.Buffer
+	WriteWAVHeader(&streaming, 8000, 2, WAVUnknownSize)
+
+	tests := []struct {
+		name       string
+		head       []byte
+		dataOffset int64
+		dataSize   int64
+		wantErr    error
+	}{
+		// данных в head может ещё не быть, размер берётся из заголовка
+		{name: "canonical", head: canonical[:44], dataOffset: 44, dataSize: 100},
+		{name: "odd chunk", head: withList, dataOffset: 56, dataSize: 8},
+		{name: "streaming", head: streaming.Bytes(), dataOffset: 44, dataSize: -1},
+		{name: "header not complete", head: withList[:50], wantErr: io.ErrUnexpectedEOF},
+		{name: "empty", head: nil, wantErr: io.ErrUnexpectedEOF},
+		{name: "not wave", head: []byte("RIFF\x00\x00\x00\x00AVI LIST"), wantErr: ErrUnsupportedWAV},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseWAVHeader(tt.head)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWAVHeader: %v", err)
+			}
+			if !info.IsPCM16() {
+				t.Errorf("format = %+v", info)
+			}
+			if info.DataOffset != tt.dataOffset || info.DataSize != tt.dataSize {
+				t.Errorf("data at %d size %d, want at %d size %d", info.DataOffset, info.DataSize, tt.dataOffset, tt.dataSize)
+			}
+		})
+	}
+}
+
+func TestPatchWAVHeader(t *testing.T) {
+	var header bytes.Buffer
+	WriteWAVHeader(&header, 8000, 1, WAVUnknownSize)
+
+	patched := header.Bytes()
+	PatchWAVHeader(patched, WAVHeaderSize+1000)
+	if want := wavBytes(t, 8000, 1, nil); !bytes.Equal(patched[:4], want[:4]) || !bytes.Equal(patched[8:40], want[8:40]) {
+		t.Errorf("header changed besides sizes: %x", patched)
+	}
+	if got := binary.LittleEndian.Uint32(patched[4:8]); got != 36+1000 {
+		t.Errorf("riff size = %d, want %d", got, 36+1000)
+	}
+	if got := binary.LittleEndian.Uint32(patched[40:44]); got != 1000 {
+		t.Errorf("data size = %d, want 1000", got)
+	}
+
+	// короче заголовка - не трогаем
+	short := []byte("RIFF")
+	PatchWAVHeader(short, 1000)
+	if string(short) != "RIFF" {
+		t.Errorf("short header = %q", short)
+	}
+}
@@ -0,0 +1,103 @@
+// Package diff compares texts line by line.
+package diff
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxPairs limits the LCS table: the changed parts of the texts, without
+// the common beginning and end, may have up to MaxPairs pairs of lines,
+// e.g. 2000 by 2000. The table takes 4 bytes a pair.
+const MaxPairs = 4 << 20
+
+var ErrTooLarge = errors.New("changed parts of the texts are too large to compare")
+
+const (
+	OpEqual  = " "
+	OpDelete = "-"
+	OpInsert = "+"
+)
+
+// Line is a line of the diff. Old and New are 1-based line numbers in the
+// old and new text, 0 when the line is absent there.
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+	Old  int    `json:"old,omitempty"`
+	New  int    `json:"new,omitempty"`
+}
+
+// Lines returns the shortest edit of a into b by the longest common subsequence
+// of lines. ErrTooLarge is returned when the changed parts exceed MaxPairs.
+func Lines(a, b string) ([]Line, error) {
+	oldLines, newLines := split(a), split(b)
+
+	// общие начало и конец не участвуют в LCS, обычно правка затрагивает пару строк
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	x := oldLines[prefix : len(oldLines)-suffix]
+	y := newLines[prefix : len(newLines)-suffix]
+	if int64(len(x)+1)*int64(len(y)+1) > MaxPairs {
+		return nil, ErrTooLarge
+	}
+
+	var result []Line
+	for i := 0; i < prefix; i++ {
+		result = append(result, Line{Op: OpEqual, Text: oldLines[i], Old: i + 1, New: i + 1})
+	}
+
+	// lcs(i, j) - длина LCS x[i:] и y[j:], таблица одним куском
+	width := len(y) + 1
+	table := make([]int32, (len(x)+1)*width)
+	lcs := func(i, j int) int32 { return table[i*width+j] }
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				table[i*width+j] = lcs(i+1, j+1) + 1
+			} else {
+				table[i*width+j] = max(lcs(i+1, j), lcs(i, j+1))
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			result = append(result, Line{Op: OpEqual, Text: x[i], Old: prefix + i + 1, New: prefix + j + 1})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs(i+1, j) >= lcs(i, j+1)):
+			// удаления раньше вставок, как в diff -u
+			result = append(result, Line{Op: OpDelete, Text: x[i], Old: prefix + i + 1})
+			i++
+		default:
+			result = append(result, Line{Op: OpInsert, Text: y[j], New: prefix + j + 1})
+			j++
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		oldIndex, newIndex := len(oldLines)-suffix+k, len(newLines)-suffix+k
+		result = append(result, Line{Op: OpEqual, Text: oldLines[oldIndex], Old: oldIndex + 1, New: newIndex + 1})
+	}
+
+	return result, nil
+}
+
+func split(text string) []string {
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
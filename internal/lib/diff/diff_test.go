@@ -0,0 +1,129 @@
+package diff
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{name: "empty", a: "", b: "", want: nil},
+		{
+			name: "equal",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo",
+			want: []Line{
+				{Op: OpEqual, Text: "one", Old: 1, New: 1},
+				{Op: OpEqual, Text: "two", Old: 2, New: 2},
+			},
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "one\ntwo",
+			want: []Line{
+				{Op: OpInsert, Text: "one", New: 1},
+				{Op: OpInsert, Text: "two", New: 2},
+			},
+		},
+		{
+			name: "insert in the middle",
+			a:    "one\nthree",
+			b:    "one\ntwo\nthree",
+			want: []Line{
+				{Op: OpEqual, Text: "one", Old: 1, New: 1},
+				{Op: OpInsert, Text: "two", New: 2},
+				{Op: OpEqual, Text: "three", Old: 2, New: 3},
+			},
+		},
+		{
+			name: "delete",
+			a:    "one\ntwo\nthree",
+			b:    "one\nthree",
+			want: []Line{
+				{Op: OpEqual, Text: "one", Old: 1, New: 1},
+				{Op: OpDelete, Text: "two", Old: 2},
+				{Op: OpEqual, Text: "three", Old: 3, New: 2},
+			},
+		},
+		{
+			// удаление идёт раньше вставки
+			name: "replace",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: []Line{
+				{Op: OpEqual, Text: "one", Old: 1, New: 1},
+				{Op: OpDelete, Text: "two", Old: 2},
+				{Op: OpInsert, Text: "2", New: 2},
+				{Op: OpEqual, Text: "three", Old: 3, New: 3},
+			},
+		},
+		{
+			// общая строка внутри изменённой части находится через LCS
+			name: "common line inside the change",
+			a:    "a\nx\nb",
+			b:    "c\nx\nd",
+			want: []Line{
+				{Op: OpDelete, Text: "a", Old: 1},
+				{Op: OpInsert, Text: "c", New: 1},
+				{Op: OpEqual, Text: "x", Old: 2, New: 2},
+				{Op: OpDelete, Text: "b", Old: 3},
+				{Op: OpInsert, Text: "d", New: 3},
+			},
+		},
+		{
+			name: "crlf",
+			a:    "one\r\ntwo\r\n",
+			b:    "one\ntwo\n",
+			want: []Line{
+				{Op: OpEqual, Text: "one", Old: 1, New: 1},
+				{Op: OpEqual, Text: "two", Old: 2, New: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lines(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Lines() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesTooLarge(t *testing.T) {
+	lines := func(prefix string, n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString(prefix)
+			b.WriteString(strings.Repeat("x", i%7))
+			b.WriteByte('\n')
+		}
+		return b.String()
+	}
+
+	// 3000 на 3000 изменённых строк больше MaxPairs
+	if _, err := Lines(lines("a", 3000), lines("b", 3000)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Lines() error = %v, want ErrTooLarge", err)
+	}
+
+	// одинаковые длинные тексты не упираются в предел: общая часть не входит в таблицу
+	same := lines("a", 100000)
+	got, err := Lines(same, same+"tail\n")
+	if err != nil {
+		t.Fatalf("Lines() error = %v", err)
+	}
+	if len(got) != 100001 || got[100000] != (Line{Op: OpInsert, Text: "tail", New: 100001}) {
+		t.Errorf("Lines() last = %+v, len %d", got[len(got)-1], len(got))
+	}
+}
@@ -0,0 +1,268 @@
+package export
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Format is an export file format. Markdown, DOCX and PDF are produced from
+// the Markdown template, HTML has its own template.
+type Format string
+
+const (
+	FormatMarkdown Format = "md"
+	FormatHTML     Format = "html"
+	FormatDOCX     Format = "docx"
+	FormatPDF      Format = "pdf"
+)
+
+const DefaultTemplate = "default"
+
+var (
+	ErrUnknownFormat   = errors.New("unknown export format")
+	ErrUnknownTemplate = errors.New("unknown export template")
+	ErrPDFNotAvailable = errors.New("PDF export requires a font, set export.pdf_font")
+)
+
+var contentTypes = map[Format]string{
+	FormatMarkdown: "text/markdown; charset=utf-8",
+	FormatHTML:     "text/html; charset=utf-8",
+	FormatDOCX:     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	FormatPDF:      "application/pdf",
+}
+
+// Formats in the order they are preferred when Accept allows several.
+var Formats = []Format{FormatPDF, FormatDOCX, FormatHTML, FormatMarkdown}
+
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// ParseFormat accepts a format name or a file extension with a dot.
+func ParseFormat(name string) (Format, error) {
+	format := Format(strings.TrimPrefix(strings.ToLower(name), "."))
+	if format == "markdown" {
+		format = FormatMarkdown
+	}
+	if _, ok := contentTypes[format]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+	}
+	return format, nil
+}
+
+// Negotiate picks the format from an Accept header. q-values are only used
+// to skip refused types (q=0), then Formats order decides.
+func Negotiate(accept string) (Format, bool) {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		accepted[mediaType] = params["q"] != "0" && params["q"] != "0.0"
+	}
+
+	for _, format := range Formats {
+		mediaType, _, _ := mime.ParseMediaType(format.ContentType())
+		if accepted[mediaType] {
+			return format, true
+		}
+	}
+	// text/x-markdown встречается у старых клиентов
+	if accepted["text/x-markdown"] {
+		return FormatMarkdown, true
+	}
+
+	return "", false
+}
+
+// Document is what templates see.
+type Document struct {
+	TaskId       int32
+	Title        string
+	Date         time.Time
+	Participants []string
+	Language     string
+	Extra        map[string]string
+	Protocol     string
+}
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+type template struct {
+	markdown *texttemplate.Template
+	html     *htmltemplate.Template
+}
+
+// Renderer renders protocols with named templates: built-in ones and
+// <name>.md.tmpl / <name>.html.tmpl from the deployment's templates
+// directory, which override built-in ones with the same name.
+type Renderer struct {
+	templates map[string]*template
+	font      *ttfFont
+}
+
+func New(templatesDir string, pdfFont string) (*Renderer, error) {
+	const op = "export.New"
+
+	r := &Renderer{templates: make(map[string]*template)}
+
+	if err := r.load(builtinTemplates, "templates"); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if templatesDir != "" {
+		if err := r.load(os.DirFS(templatesDir), "."); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if pdfFont != "" {
+		font, err := loadTTF(pdfFont)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.font = font
+	}
+
+	return r, nil
+}
+
+func (r *Renderer) load(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("read templates: %w", err)
+	}
+
+	for _, entry := range entries {
+		name, kind, ok := templateName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("read template %s: %w", entry.Name(), err)
+		}
+
+		t := r.templates[name]
+		if t == nil {
+			t = &template{}
+			r.templates[name] = t
+		}
+
+		switch kind {
+		case "md":
+			if t.markdown, err = texttemplate.New(entry.Name()).Funcs(funcs).Parse(string(data)); err != nil {
+				return fmt.Errorf("parse template %s: %w", entry.Name(), err)
+			}
+		case "html":
+			if t.html, err = htmltemplate.New(entry.Name()).Funcs(funcs).Parse(string(data)); err != nil {
+				return fmt.Errorf("parse template %s: %w", entry.Name(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// templateName splits "minutes.md.tmpl" into "minutes" and "md".
+func templateName(filename string) (string, string, bool) {
+	base, ok := strings.CutSuffix(filename, ".tmpl")
+	if !ok {
+		return "", "", false
+	}
+	ext := path.Ext(base)
+	if ext != ".md" && ext != ".html" {
+		return "", "", false
+	}
+	return strings.TrimSuffix(base, ext), ext[1:], true
+}
+
+var funcs = map[string]any{
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("02.01.2006")
+	},
+	"lines": func(text string) []string {
+		return strings.Split(strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n"), "\n")
+	},
+	"join": strings.Join,
+}
+
+// Templates returns the names of the available templates.
+func (r *Renderer) Templates() []string {
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render writes the document in the format using the named template,
+// empty name is DefaultTemplate.
+func (r *Renderer) Render(w io.Writer, format Format, templateName string, doc Document) error {
+	const op = "export.Render"
+
+	if templateName == "" {
+		templateName = DefaultTemplate
+	}
+	t, ok := r.templates[templateName]
+	if !ok {
+		return fmt.Errorf("%s: %w: %s", op, ErrUnknownTemplate, templateName)
+	}
+
+	if format == FormatHTML {
+		if t.html == nil {
+			return fmt.Errorf("%s: %w: %s has no HTML version", op, ErrUnknownTemplate, templateName)
+		}
+		if err := t.html.Execute(w, doc); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	if t.markdown == nil {
+		return fmt.Errorf("%s: %w: %s has no Markdown version", op, ErrUnknownTemplate, templateName)
+	}
+	if format == FormatPDF && r.font == nil {
+		return fmt.Errorf("%s: %w", op, ErrPDFNotAvailable)
+	}
+
+	var markdown bytes.Buffer
+	if err := t.markdown.Execute(&markdown, doc); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var err error
+	switch format {
+	case FormatMarkdown:
+		_, err = w.Write(markdown.Bytes())
+	case FormatDOCX:
+		err = writeDOCX(w, markdown.String())
+	case FormatPDF:
+		err = writePDF(w, markdown.String(), r.font)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// golden compares got with testdata/name, -update rewrites the file.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v (run go test -update)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, got:\n%s", name, got)
+	}
+}
+
+var testDocument = Document{
+	TaskId:       42,
+	Title:        "Заседание кафедры <№ 7>",
+	Date:         time.Date(2024, 3, 15, 14, 30, 0, 0, time.UTC),
+	Participants: []string{"Иванов И. И.", "Петрова А. С."},
+	Language:     "ru",
+	Extra:        map[string]string{"Место": "ауд. 612", "Кафедра": "ВМК & ММП"},
+	Protocol: "### Повестка\r\n" +
+		"- отчёт о практике\n" +
+		"* план на семестр\n" +
+		"\n\n\n" +
+		"Слушали: Иванов И. И. рассказал о результатах летней практики студентов и о том, что отчёты сданы не всеми группами.\n" +
+		"  Постановили: принять к сведению. Цена вопроса 100 €.   \n",
+}
+
+func testRenderer(t *testing.T) *Renderer {
+	t.Helper()
+
+	fontPath := filepath.Join(t.TempDir(), "font.ttf")
+	if err := os.WriteFile(fontPath, newTestFont().build(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New("", fontPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+func render(t *testing.T, r *Renderer, format Format, doc Document) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := r.Render(&out, format, "", doc); err != nil {
+		t.Fatalf("Render %s: %v", format, err)
+	}
+	return out.Bytes()
+}
+
+func TestRenderGolden(t *testing.T) {
+	r := testRenderer(t)
+
+	t.Run("markdown", func(t *testing.T) {
+		golden(t, "default.md", render(t, r, FormatMarkdown, testDocument))
+	})
+	t.Run("html", func(t *testing.T) {
+		golden(t, "default.html", render(t, r, FormatHTML, testDocument))
+	})
+	t.Run("docx", func(t *testing.T) {
+		data := render(t, r, FormatDOCX, testDocument)
+		golden(t, "default.docx.xml", docxPart(t, data, "word/document.xml"))
+	})
+	t.Run("pdf", func(t *testing.T) {
+		data := render(t, r, FormatPDF, testDocument)
+		golden(t, "default.pdf.txt", pdfText(t, data))
+	})
+}
+
+// docxPart returns a part of the archive and checks that all parts the
+// package relationships refer to are there.
+func docxPart(t *testing.T, data []byte, name string) []byte {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("DOCX is not a zip: %v", err)
+	}
+
+	parts := make(map[string][]byte)
+	for _, file := range archive.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[file.Name] = content
+	}
+
+	for _, required := range []string{"[Content_Types].xml", "_rels/.rels", "word/_rels/document.xml.rels", "word/styles.xml", "word/document.xml"} {
+		if _, ok := parts[required]; !ok {
+			t.Errorf("DOCX has no %s", required)
+		}
+	}
+
+	return parts[name]
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{name: "md", want: FormatMarkdown},
+		{name: "markdown", want: FormatMarkdown},
+		{name: ".MD", want: FormatMarkdown},
+		{name: "html", want: FormatHTML},
+		{name: ".docx", want: FormatDOCX},
+		{name: "PDF", want: FormatPDF},
+		{name: "doc", wantErr: true},
+		{name: "", wantErr: true},
+		{name: "..pdf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormat(tt.name)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownFormat) {
+					t.Errorf("err = %v, want ErrUnknownFormat", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseFormat = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Format
+		ok     bool
+	}{
+		{accept: "application/pdf", want: FormatPDF, ok: true},
+		{accept: "text/markdown", want: FormatMarkdown, ok: true},
+		{accept: "text/x-markdown", want: FormatMarkdown, ok: true},
+		{accept: "text/html;charset=utf-8", want: FormatHTML, ok: true},
+		// порядок Formats важнее порядка и q в заголовке
+		{accept: "text/html, application/pdf;q=0.1", want: FormatPDF, ok: true},
+		{accept: "application/pdf;q=0, application/vnd.openxmlformats-officedocument.wordprocessingml.document", want: FormatDOCX, ok: true},
+		{accept: "application/pdf;q=0.0, text/markdown", want: FormatMarkdown, ok: true},
+		{accept: "application/pdf;q=0"},
+		{accept: "*/*"},
+		{accept: "application/json"},
+		{accept: ""},
+		{accept: ";;;, text/markdown", want: FormatMarkdown, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, ok := Negotiate(tt.accept)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Negotiate = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// переопределяет встроенный шаблон
+		"default.md.tmpl": "# {{.Title}} ({{.TaskId}})\n\n{{.Protocol}}\n",
+		// только HTML: в Markdown, DOCX и PDF его не отрендерить
+		"brief.html.tmpl": "<p>{{.Title}}</p>",
+		"notes.txt":       "не шаблон",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := New(dir, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if got, want := r.Templates(), []string{"brief", "default"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Templates = %v, want %v", got, want)
+	}
+
+	var out bytes.Buffer
+	if err := r.Render(&out, FormatMarkdown, "default", Document{TaskId: 7, Title: "T", Protocol: "text"}); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if got, want := out.String(), "# T (7)\n\ntext\n"; got != want {
+		t.Errorf("overridden template = %q, want %q", got, want)
+	}
+
+	errorsTests := []struct {
+		name     string
+		format   Format
+		template string
+		want     error
+	}{
+		{name: "unknown template", format: FormatMarkdown, template: "missing", want: ErrUnknownTemplate},
+		{name: "no markdown version", format: FormatDOCX, template: "brief", want: ErrUnknownTemplate},
+		{name: "pdf without font", format: FormatPDF, want: ErrPDFNotAvailable},
+		{name: "unknown format", format: Format("odt"), want: ErrUnknownFormat},
+	}
+	for _, tt := range errorsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Render(io.Discard, tt.format, tt.template, Document{})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.md.tmpl"), []byte("{{.Title"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(dir, ""); err == nil {
+		t.Error("broken template: no error")
+	}
+	if _, err := New(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Error("missing templates dir: no error")
+	}
+	if _, err := New("", filepath.Join(dir, "missing.ttf")); err == nil {
+		t.Error("missing font: no error")
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	got := parseMarkdown("\n# A\n## B \n###  C\n\t- d\n* e\n-f\n\n\n\ntext  \n\n")
+	want := []block{
+		{kind: blockHeading1, text: "A"},
+		{kind: blockHeading2, text: "B"},
+		{kind: blockHeading3, text: "C"},
+		{kind: blockBullet, text: "d"},
+		{kind: blockBullet, text: "e"},
+		{kind: blockParagraph, text: "-f"},
+		{kind: blockBlank},
+		{kind: blockParagraph, text: "text"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMarkdown = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package export
+
+import "strings"
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading1
+	blockHeading2
+	blockHeading3
+	blockBullet
+	blockBlank
+)
+
+type block struct {
+	kind blockKind
+	text string
+}
+
+// parseMarkdown reads the subset the templates use for DOCX and PDF:
+// "#"-"###" headings, "-"/"*" list items and lines of text. Every line is
+// its own paragraph, so line breaks of the protocol are kept.
+func parseMarkdown(text string) []block {
+	var blocks []block
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimLeft(line, " \t")
+
+		switch {
+		case trimmed == "":
+			// подряд идущие пустые строки схлопываем
+			if len(blocks) > 0 && blocks[len(blocks)-1].kind != blockBlank {
+				blocks = append(blocks, block{kind: blockBlank})
+			}
+		case strings.HasPrefix(trimmed, "### "):
+			blocks = append(blocks, block{kind: blockHeading3, text: strings.TrimSpace(trimmed[4:])})
+		case strings.HasPrefix(trimmed, "## "):
+			blocks = append(blocks, block{kind: blockHeading2, text: strings.TrimSpace(trimmed[3:])})
+		case strings.HasPrefix(trimmed, "# "):
+			blocks = append(blocks, block{kind: blockHeading1, text: strings.TrimSpace(trimmed[2:])})
+		case strings.HasPrefix(trimmed, "- "), strings.HasPrefix(trimmed, "* "):
+			blocks = append(blocks, block{kind: blockBullet, text: strings.TrimSpace(trimmed[2:])})
+		default:
+			blocks = append(blocks, block{kind: blockParagraph, text: trimmed})
+		}
+	}
+
+	for len(blocks) > 0 && blocks[len(blocks)-1].kind == blockBlank {
+		blocks = blocks[:len(blocks)-1]
+	}
+
+	return blocks
+}
@@ -0,0 +1,289 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// A4 в пунктах
+const (
+	pdfPageWidth    = 595.28
+	pdfPageHeight   = 841.89
+	pdfMarginLeft   = 70.0
+	pdfMarginRight  = 50.0
+	pdfMarginTop    = 60.0
+	pdfMarginBottom = 60.0
+	pdfBulletIndent = 14.0
+)
+
+type pdfStyle struct {
+	size        float64
+	spaceBefore float64
+	spaceAfter  float64
+}
+
+var pdfStyles = map[blockKind]pdfStyle{
+	blockParagraph: {size: 11, spaceAfter: 4},
+	blockBullet:    {size: 11, spaceAfter: 2},
+	blockHeading1:  {size: 18, spaceBefore: 6, spaceAfter: 10},
+	blockHeading2:  {size: 14, spaceBefore: 10, spaceAfter: 6},
+	blockHeading3:  {size: 12, spaceBefore: 8, spaceAfter: 4},
+	blockBlank:     {size: 11, spaceAfter: 4},
+}
+
+// pdfWriter lays out markdown blocks on A4 pages with one embedded TrueType
+// font. Text is written as glyph ids (Identity-H), so any script the font
+// covers is printed, ToUnicode keeps the text searchable and copyable.
+type pdfWriter struct {
+	font  *ttfFont
+	used  map[uint16]rune
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func writePDF(w io.Writer, markdown string, font *ttfFont) error {
+	const op = "export.writePDF"
+
+	p := &pdfWriter{
+		font: font,
+		used: make(map[uint16]rune),
+	}
+	p.newPage()
+
+	for _, b := range parseMarkdown(markdown) {
+		p.writeBlock(b)
+	}
+
+	if err := p.output(w); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (p *pdfWriter) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	p.y = pdfPageHeight - pdfMarginTop
+}
+
+func (p *pdfWriter) writeBlock(b block) {
+	style := pdfStyles[b.kind]
+	leading := style.size * 1.35
+
+	if b.kind == blockBlank {
+		p.y -= style.spaceAfter
+		return
+	}
+
+	// в начале страницы отступ сверху не нужен
+	if p.y < pdfPageHeight-pdfMarginTop {
+		p.y -= style.spaceBefore
+	}
+
+	left := pdfMarginLeft
+	if b.kind == blockBullet {
+		left += pdfBulletIndent
+	}
+	width := pdfPageWidth - pdfMarginRight - left
+
+	lines := p.wrap(b.text, style.size, width)
+	for i, line := range lines {
+		if p.y-leading < pdfMarginBottom {
+			p.newPage()
+		}
+		p.y -= leading
+
+		if i == 0 && b.kind == blockBullet {
+			p.text(pdfMarginLeft+2, p.y, style.size, "•")
+		}
+		p.text(left, p.y, style.size, line)
+	}
+
+	p.y -= style.spaceAfter
+}
+
+func (p *pdfWriter) text(x, y, size float64, s string) {
+	var hex strings.Builder
+	for _, r := range s {
+		gid := p.font.glyph(r)
+		if _, ok := p.used[gid]; !ok {
+			p.used[gid] = r
+		}
+		fmt.Fprintf(&hex, "%04X", gid)
+	}
+
+	fmt.Fprintf(p.page, "BT /F1 %.2f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, y, hex.String())
+}
+
+func (p *pdfWriter) measure(s string, size float64) float64 {
+	var width int
+	for _, r := range s {
+		width += p.font.width(p.font.glyph(r))
+	}
+	return float64(width) * size / 1000
+}
+
+// wrap splits text into lines by words, a word longer than the line is cut.
+func (p *pdfWriter) wrap(text string, size, width float64) []string {
+	var lines []string
+	var line string
+
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if p.measure(candidate, size) <= width {
+			line = candidate
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+		for p.measure(word, size) > width {
+			runes := []rune(word)
+			cut := 1
+			for cut < len(runes) && p.measure(string(runes[:cut+1]), size) <= width {
+				cut++
+			}
+			lines = append(lines, string(runes[:cut]))
+			word = string(runes[cut:])
+		}
+		line = word
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (p *pdfWriter) output(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+
+	// объекты нумеруются по порядку: 1 каталог, 2 страницы, 3-7 шрифт, дальше пары страница/контент
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, data []byte) error {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Filter /FlateDecode /Length %d >>\nstream\n", len(offsets), dict, compressed.Len())
+		out.Write(compressed.Bytes())
+		out.WriteString("\nendstream\nendobj\n")
+		return nil
+	}
+
+	const firstPage = 8
+	var kids strings.Builder
+	for i := range p.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", firstPage+i*2)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /ExportFont /Encoding /Identity-H /DescendantFonts [4 0 R] /ToUnicode 7 0 R >>")
+	object(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /ExportFont "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+		"/FontDescriptor 5 0 R /CIDToGIDMap /Identity /W [%s] >>", p.widths()))
+	f := p.font
+	object(fmt.Sprintf("<< /Type /FontDescriptor /FontName /ExportFont /Flags 32 /FontBBox [%d %d %d %d] "+
+		"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 6 0 R >>",
+		f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+		f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent)))
+	if err := stream(fmt.Sprintf("/Length1 %d", len(f.data)), f.data); err != nil {
+		return err
+	}
+	if err := stream("", p.toUnicode()); err != nil {
+		return err
+	}
+
+	for i, page := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPage+i*2+1))
+		if err := stream("", page.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func (p *pdfWriter) sortedGlyphs() []uint16 {
+	gids := make([]uint16, 0, len(p.used))
+	for gid := range p.used {
+		gids = append(gids, gid)
+	}
+	sort.Slice(gids, func(i, j int) bool { return gids[i] < gids[j] })
+	return gids
+}
+
+func (p *pdfWriter) widths() string {
+	var w strings.Builder
+	for _, gid := range p.sortedGlyphs() {
+		fmt.Fprintf(&w, "%d [%d] ", gid, p.font.width(gid))
+	}
+	return w.String()
+}
+
+func (p *pdfWriter) toUnicode() []byte {
+	var cmap bytes.Buffer
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	var gids []uint16
+	for _, gid := range p.sortedGlyphs() {
+		// .notdef - любой символ, которого нет в шрифте
+		if gid != 0 {
+			gids = append(gids, gid)
+		}
+	}
+	// в одном блоке bfchar не больше 100 записей
+	for start := 0; start < len(gids); start += 100 {
+		chunk := gids[start:min(start+100, len(gids))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, gid := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <", gid)
+			for _, unit := range utf16.Encode([]rune{p.used[gid]}) {
+				fmt.Fprintf(&cmap, "%04X", unit)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return cmap.Bytes()
+}
@@ -0,0 +1,188 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	pdfStartXref = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	pdfLength    = regexp.MustCompile(`/Length (\d+)`)
+)
+
+// pdfObjects checks the xref table and the trailer and returns the objects
+// by number, stream data is inflated.
+func pdfObjects(t *testing.T, data []byte) map[int]string {
+	t.Helper()
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) {
+		t.Fatalf("no PDF header")
+	}
+	match := pdfStartXref.FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("no startxref at the end")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	var count int
+	if _, err := fmt.Sscanf(string(data[xref:]), "xref\n0 %d\n", &count); err != nil {
+		t.Fatalf("xref header: %v", err)
+	}
+	entries := strings.Split(string(data[xref:]), "\n")[2:]
+	if entries[0] != "0000000000 65535 f " {
+		t.Errorf("xref entry 0 = %q", entries[0])
+	}
+	if trailer := fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>", count); !bytes.Contains(data, []byte(trailer)) {
+		t.Errorf("no %q", trailer)
+	}
+
+	objects := make(map[int]string)
+	for n := 1; n < count; n++ {
+		var offset int
+		if _, err := fmt.Sscanf(entries[n], "%010d 00000 n ", &offset); err != nil {
+			t.Fatalf("xref entry %d %q: %v", n, entries[n], err)
+		}
+
+		prefix := fmt.Sprintf("%d 0 obj\n", n)
+		if !bytes.HasPrefix(data[offset:], []byte(prefix)) {
+			t.Fatalf("xref entry %d points at %q", n, data[offset:min(offset+20, len(data))])
+		}
+		body := data[offset+len(prefix):]
+		body = body[:bytes.Index(body, []byte("\nendobj\n"))]
+
+		dict, stream, isStream := bytes.Cut(body, []byte("\nstream\n"))
+		if !isStream {
+			objects[n] = string(body)
+			continue
+		}
+
+		length := pdfLength.FindSubmatch(dict)
+		if length == nil {
+			t.Fatalf("object %d: stream without /Length", n)
+		}
+		size, _ := strconv.Atoi(string(length[1]))
+		if !bytes.Equal(stream[size:], []byte("\nendstream")) {
+			t.Fatalf("object %d: /Length %d does not match the stream", n, size)
+		}
+
+		zr, err := zlib.NewReader(bytes.NewReader(stream[:size]))
+		if err != nil {
+			t.Fatalf("object %d: %v", n, err)
+		}
+		inflated, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("object %d: %v", n, err)
+		}
+		objects[n] = string(dict) + "\n" + string(inflated)
+	}
+
+	return objects
+}
+
+// pdfText is the golden form of a PDF: inflated objects without the embedded
+// font. Compressed lengths depend on the zlib version and are left out.
+func pdfText(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	objects := pdfObjects(t, data)
+
+	var out bytes.Buffer
+	for n := 1; n <= len(objects); n++ {
+		body := objects[n]
+		if n == 6 {
+			body, _, _ = strings.Cut(body, "\n")
+		}
+		body = pdfLength.ReplaceAllString(body, "/Length _")
+		fmt.Fprintf(&out, "%d 0 obj\n%s\n\n", n, body)
+	}
+	return out.Bytes()
+}
+
+func TestWritePDF(t *testing.T) {
+	fontData := newTestFont().build()
+	font, err := parseTTF(fontData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// абзац занимает 18.85 пт, на страницу помещается 38: 150 абзацев - четыре страницы
+	var long strings.Builder
+	for i := 0; i < 150; i++ {
+		fmt.Fprintf(&long, "Абзац %d\n", i)
+	}
+
+	tests := []struct {
+		name     string
+		markdown string
+		pages    int
+	}{
+		{name: "empty", markdown: "", pages: 1},
+		{name: "one line", markdown: "# Протокол", pages: 1},
+		{name: "page breaks", markdown: long.String(), pages: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writePDF(&out, tt.markdown, font); err != nil {
+				t.Fatalf("writePDF: %v", err)
+			}
+
+			objects := pdfObjects(t, out.Bytes())
+			if want := 7 + 2*tt.pages; len(objects) != want {
+				t.Fatalf("%d objects, want %d", len(objects), want)
+			}
+			if !strings.Contains(objects[2], fmt.Sprintf("/Count %d", tt.pages)) {
+				t.Errorf("pages = %q, want %d", objects[2], tt.pages)
+			}
+			// шрифт встроен без изменений
+			if _, embedded, _ := strings.Cut(objects[6], "\n"); embedded != string(fontData) {
+				t.Errorf("embedded font differs from the file")
+			}
+			if !strings.Contains(objects[6], fmt.Sprintf("/Length1 %d", len(fontData))) {
+				t.Errorf("font stream: %q", objects[6][:60])
+			}
+		})
+	}
+}
+
+func TestPDFWrap(t *testing.T) {
+	font, err := parseTTF(newTestFont().build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &pdfWriter{font: font}
+
+	// при размере 10 буква - 6 пт, пробел - 2.5 пт
+	tests := []struct {
+		name  string
+		text  string
+		width float64
+		want  []string
+	}{
+		{name: "fits", text: "ab cd", width: 26.5, want: []string{"ab cd"}},
+		{name: "wraps by words", text: "ab cd ef", width: 30, want: []string{"ab cd", "ef"}},
+		{name: "extra spaces", text: "  ab   cd  ", width: 100, want: []string{"ab cd"}},
+		{name: "long word is cut", text: "abcdefg hi", width: 24, want: []string{"abcd", "efg", "hi"}},
+		{name: "narrower than a letter", text: "abc", width: 1, want: []string{"a", "b", "c"}},
+		{name: "empty", text: "", width: 100, want: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.wrap(tt.text, 10, tt.width)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("wrap = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrUnsupportedFont = errors.New("unsupported font")
+
+// ttfFont is what the PDF writer needs from a TrueType font: glyph ids,
+// advance widths and a few metrics. The file is embedded as is.
+type ttfFont struct {
+	data       []byte
+	unitsPerEm int
+	ascent     int
+	descent    int
+	bbox       [4]int
+	widths     []int
+	cmap       map[rune]uint16
+}
+
+func loadTTF(path string) (*ttfFont, error) {
+	const op = "export.loadTTF"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	font, err := parseTTF(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, path, err)
+	}
+
+	return font, nil
+}
+
+func parseTTF(data []byte) (*ttfFont, error) {
+	if len(data) < 12 {
+		return nil, ErrUnsupportedFont
+	}
+	// 0x00010000 - TrueType, "true" - старые шрифты Apple; OTTO (CFF) и ttcf не поддерживаем
+	if version := binary.BigEndian.Uint32(data); version != 0x00010000 && version != 0x74727565 {
+		return nil, fmt.Errorf("%w: only TrueType outlines are supported", ErrUnsupportedFont)
+	}
+
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + i*16
+		if record+16 > len(data) {
+			return nil, ErrUnsupportedFont
+		}
+		tag := string(data[record : record+4])
+		offset := int(binary.BigEndian.Uint32(data[record+8:]))
+		length := int(binary.BigEndian.Uint32(data[record+12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, ErrUnsupportedFont
+		}
+		tables[tag] = data[offset : offset+length]
+	}
+
+	head, hhea, maxp, hmtx, cmap := tables["head"], tables["hhea"], tables["maxp"], tables["hmtx"], tables["cmap"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 || hmtx == nil || cmap == nil {
+		return nil, fmt.Errorf("%w: required tables are missing", ErrUnsupportedFont)
+	}
+
+	font := &ttfFont{
+		data:       data,
+		unitsPerEm: int(binary.BigEndian.Uint16(head[18:])),
+		ascent:     int(int16(binary.BigEndian.Uint16(hhea[4:]))),
+		descent:    int(int16(binary.BigEndian.Uint16(hhea[6:]))),
+	}
+	for i := range font.bbox {
+		font.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	if font.unitsPerEm == 0 {
+		return nil, ErrUnsupportedFont
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if numMetrics == 0 || numMetrics > numGlyphs || len(hmtx) < numMetrics*4 {
+		return nil, ErrUnsupportedFont
+	}
+	// после numberOfHMetrics ширина повторяет последнюю
+	font.widths = make([]int, numGlyphs)
+	for gid := range font.widths {
+		font.widths[gid] = int(binary.BigEndian.Uint16(hmtx[min(gid, numMetrics-1)*4:]))
+	}
+
+	var err error
+	if font.cmap, err = parseCmap(cmap); err != nil {
+		return nil, err
+	}
+
+	return font, nil
+}
+
+// parseCmap reads the Unicode subtable: format 12 (full Unicode) if present, else format 4 (BMP).
+func parseCmap(cmap []byte) (map[rune]uint16, error) {
+	if len(cmap) < 4 {
+		return nil, ErrUnsupportedFont
+	}
+
+	var format4, format12 []byte
+	numSubtables := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < numSubtables; i++ {
+		record := 4 + i*8
+		if record+8 > len(cmap) {
+			return nil, ErrUnsupportedFont
+		}
+		platform := binary.BigEndian.Uint16(cmap[record:])
+		encoding := binary.BigEndian.Uint16(cmap[record+2:])
+		offset := int(binary.BigEndian.Uint32(cmap[record+4:]))
+		if offset+4 > len(cmap) {
+			continue
+		}
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue
+		}
+
+		subtable := cmap[offset:]
+		switch binary.BigEndian.Uint16(subtable) {
+		case 4:
+			format4 = subtable
+		case 12:
+			format12 = subtable
+		}
+	}
+
+	switch {
+	case format12 != nil:
+		return parseCmap12(format12)
+	case format4 != nil:
+		return parseCmap4(format4)
+	}
+	return nil, fmt.Errorf("%w: no Unicode cmap", ErrUnsupportedFont)
+}
+
+func parseCmap4(subtable []byte) (map[rune]uint16, error) {
+	if len(subtable) < 14 {
+		return nil, ErrUnsupportedFont
+	}
+
+	segments := int(binary.BigEndian.Uint16(subtable[6:])) / 2
+	endCodes := 14
+	startCodes := endCodes + segments*2 + 2
+	deltas := startCodes + segments*2
+	rangeOffsets := deltas + segments*2
+	if rangeOffsets+segments*2 > len(subtable) {
+		return nil, ErrUnsupportedFont
+	}
+
+	result := make(map[rune]uint16)
+	for i := 0; i < segments; i++ {
+		end := int(binary.BigEndian.Uint16(subtable[endCodes+i*2:]))
+		start := int(binary.BigEndian.Uint16(subtable[startCodes+i*2:]))
+		delta := binary.BigEndian.Uint16(subtable[deltas+i*2:])
+		rangeOffset := int(binary.BigEndian.Uint16(subtable[rangeOffsets+i*2:]))
+
+		for code := start; code <= end && code != 0xFFFF; code++ {
+			var gid uint16
+			if rangeOffset == 0 {
+				gid = uint16(code) + delta
+			} else {
+				// смещение считается от самого поля idRangeOffset
+				at := rangeOffsets + i*2 + rangeOffset + (code-start)*2
+				if at+2 > len(subtable) {
+					continue
+				}
+				if gid = binary.BigEndian.Uint16(subtable[at:]); gid != 0 {
+					gid += delta
+				}
+			}
+			if gid != 0 {
+				result[rune(code)] = gid
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func parseCmap12(subtable []byte) (map[rune]uint16, error) {
+	if len(subtable) < 16 {
+		return nil, ErrUnsupportedFont
+	}
+
+	groups := int(binary.BigEndian.Uint32(subtable[12:]))
+	if 16+groups*12 > len(subtable) {
+		return nil, ErrUnsupportedFont
+	}
+
+	result := make(map[rune]uint16)
+	for i := 0; i < groups; i++ {
+		group := subtable[16+i*12:]
+		start := rune(binary.BigEndian.Uint32(group))
+		end := rune(binary.BigEndian.Uint32(group[4:]))
+		gid := binary.BigEndian.Uint32(group[8:])
+		if end < start || end > 0x10FFFF {
+			return nil, ErrUnsupportedFont
+		}
+		for code := start; code <= end; code++ {
+			result[code] = uint16(gid + uint32(code-start))
+		}
+	}
+
+	return result, nil
+}
+
+// glyph returns the glyph id of r, 0 (.notdef) if the font lacks it.
+func (f *ttfFont) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// width returns the advance of the glyph in 1/1000 of the font size.
+func (f *ttfFont) width(gid uint16) int {
+	if int(gid) >= len(f.widths) {
+		return 0
+	}
+	return f.widths[gid] * 1000 / f.unitsPerEm
+}
+
+func (f *ttfFont) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
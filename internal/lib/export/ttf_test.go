@@ -0,0 +1,298 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testFont describes a synthetic TrueType font: ASCII, Cyrillic А-я and "€"
+// through glyphIdArray, 3 explicit advances, the rest repeat the last one.
+type testFont struct {
+	unitsPerEm uint16
+	numGlyphs  uint16
+	numMetrics uint16
+	// таблицы, которые надо испортить или убрать
+	tables map[string][]byte
+}
+
+const (
+	testGlyphSpace = 1
+	testGlyphEuro  = 160
+	testNumGlyphs  = 161
+)
+
+func newTestFont() testFont {
+	return testFont{unitsPerEm: 1000, numGlyphs: testNumGlyphs, numMetrics: 3}
+}
+
+func be16(b []byte, v ...uint16) []byte {
+	for _, x := range v {
+		b = binary.BigEndian.AppendUint16(b, x)
+	}
+	return b
+}
+
+func testCmap4() []byte {
+	type segment struct{ start, end, delta, rangeOffset uint16 }
+	// idDelta складывается по модулю 65536
+	delta := func(gid, start int) uint16 { return uint16(gid - start) }
+	segments := []segment{
+		{start: 0x20, end: 0x7E, delta: delta(1, 0x20)},
+		{start: 0x410, end: 0x44F, delta: delta(96, 0x410)},
+		// idRangeOffset ведёт от поля сегмента 2 к glyphIdArray[0]
+		{start: 0x20AC, end: 0x20AC, rangeOffset: 4},
+		{start: 0xFFFF, end: 0xFFFF, delta: 1},
+	}
+
+	segCount := uint16(len(segments))
+	subtable := be16(nil, 4, 0, 0, segCount*2, 0, 0, 0)
+	for _, s := range segments {
+		subtable = be16(subtable, s.end)
+	}
+	subtable = be16(subtable, 0)
+	for _, s := range segments {
+		subtable = be16(subtable, s.start)
+	}
+	for _, s := range segments {
+		subtable = be16(subtable, s.delta)
+	}
+	for _, s := range segments {
+		subtable = be16(subtable, s.rangeOffset)
+	}
+	subtable = be16(subtable, testGlyphEuro)
+	binary.BigEndian.PutUint16(subtable[2:], uint16(len(subtable)))
+
+	cmap := be16(nil, 0, 1, 3, 1)
+	cmap = binary.BigEndian.AppendUint32(cmap, 12)
+	return append(cmap, subtable...)
+}
+
+func (f testFont) build() []byte {
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint16(head[18:], f.unitsPerEm)
+	for i, v := range []int16{-50, -250, 1000, 900} {
+		binary.BigEndian.PutUint16(head[36+2*i:], uint16(v))
+	}
+
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[4:], 800)
+	descent := int16(-200)
+	binary.BigEndian.PutUint16(hhea[6:], uint16(descent))
+	binary.BigEndian.PutUint16(hhea[34:], f.numMetrics)
+
+	maxp := be16(nil, 0, 0x5000, f.numGlyphs)
+
+	// .notdef 500, пробел 250, остальные 600
+	hmtx := be16(nil, 500, 0, 250, 0, 600, 0)
+	for i := 3; i < int(f.numGlyphs); i++ {
+		hmtx = be16(hmtx, 0)
+	}
+
+	tables := map[string][]byte{"head": head, "hhea": hhea, "maxp": maxp, "hmtx": hmtx, "cmap": testCmap4()}
+	for tag, data := range f.tables {
+		if data == nil {
+			delete(tables, tag)
+		} else {
+			tables[tag] = data
+		}
+	}
+
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	data := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	data = be16(data, uint16(len(tags)), 0, 0, 0)
+	offset := 12 + 16*len(tags)
+	for _, tag := range tags {
+		data = append(data, tag...)
+		data = binary.BigEndian.AppendUint32(data, 0)
+		data = binary.BigEndian.AppendUint32(data, uint32(offset))
+		data = binary.BigEndian.AppendUint32(data, uint32(len(tables[tag])))
+		offset += len(tables[tag])
+	}
+	for _, tag := range tags {
+		data = append(data, tables[tag]...)
+	}
+
+	return data
+}
+
+func TestParseTTF(t *testing.T) {
+	font, err := parseTTF(newTestFont().build())
+	if err != nil {
+		t.Fatalf("parseTTF: %v", err)
+	}
+
+	glyphs := []struct {
+		r     rune
+		gid   uint16
+		width int
+	}{
+		{r: ' ', gid: testGlyphSpace, width: 250},
+		{r: 'A', gid: 34, width: 600},
+		{r: '~', gid: 95, width: 600},
+		{r: 'А', gid: 96, width: 600},
+		{r: 'я', gid: 159, width: 600},
+		{r: '€', gid: testGlyphEuro, width: 600},
+		// нет в шрифте - .notdef
+		{r: 'Ё', gid: 0, width: 500},
+		{r: '\n', gid: 0, width: 500},
+	}
+	for _, g := range glyphs {
+		gid := font.glyph(g.r)
+		if gid != g.gid {
+			t.Errorf("glyph(%q) = %d, want %d", g.r, gid, g.gid)
+		}
+		if width := font.width(gid); width != g.width {
+			t.Errorf("width(%q) = %d, want %d", g.r, width, g.width)
+		}
+	}
+
+	if font.ascent != 800 || font.descent != -200 || font.bbox != [4]int{-50, -250, 1000, 900} {
+		t.Errorf("metrics: ascent %d descent %d bbox %v", font.ascent, font.descent, font.bbox)
+	}
+	if got := font.width(testNumGlyphs); got != 0 {
+		t.Errorf("width of a glyph out of range = %d, want 0", got)
+	}
+}
+
+func TestParseTTFScale(t *testing.T) {
+	f := newTestFont()
+	f.unitsPerEm = 2000
+
+	font, err := parseTTF(f.build())
+	if err != nil {
+		t.Fatalf("parseTTF: %v", err)
+	}
+	if got := font.width(font.glyph('A')); got != 300 {
+		t.Errorf("width = %d, want 300", got)
+	}
+	if got := font.scale(font.ascent); got != 400 {
+		t.Errorf("ascent = %d, want 400", got)
+	}
+}
+
+func TestParseTTFMalformed(t *testing.T) {
+	with := func(change func(f *testFont)) []byte {
+		f := newTestFont()
+		f.tables = make(map[string][]byte)
+		change(&f)
+		return f.build()
+	}
+
+	otto := newTestFont().build()
+	copy(otto, "OTTO")
+
+	truncatedDir := newTestFont().build()[:40]
+
+	outside := newTestFont().build()
+	binary.BigEndian.PutUint32(outside[12+12:], 1<<20)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "short", data: []byte{0, 1, 0, 0}},
+		{name: "cff outlines", data: otto},
+		{name: "collection", data: append([]byte("ttcf"), newTestFont().build()[4:]...)},
+		{name: "truncated table directory", data: truncatedDir},
+		{name: "table outside the file", data: outside},
+		{name: "no cmap", data: with(func(f *testFont) { f.tables["cmap"] = nil })},
+		{name: "no hmtx", data: with(func(f *testFont) { f.tables["hmtx"] = nil })},
+		{name: "short head", data: with(func(f *testFont) { f.tables["head"] = make([]byte, 20) })},
+		{name: "short hhea", data: with(func(f *testFont) { f.tables["hhea"] = make([]byte, 30) })},
+		{name: "short maxp", data: with(func(f *testFont) { f.tables["maxp"] = make([]byte, 4) })},
+		{name: "zero units per em", data: with(func(f *testFont) { f.unitsPerEm = 0 })},
+		{name: "no metrics", data: with(func(f *testFont) { f.numMetrics = 0 })},
+		{name: "more metrics than glyphs", data: with(func(f *testFont) { f.numMetrics = 200 })},
+		{name: "short hmtx", data: with(func(f *testFont) { f.tables["hmtx"] = make([]byte, 8) })},
+		{name: "short cmap", data: with(func(f *testFont) { f.tables["cmap"] = []byte{0, 0} })},
+		{name: "cmap without unicode", data: with(func(f *testFont) {
+			cmap := testCmap4()
+			binary.BigEndian.PutUint16(cmap[4:], 1) // Macintosh
+			f.tables["cmap"] = cmap
+		})},
+		{name: "truncated cmap record", data: with(func(f *testFont) {
+			f.tables["cmap"] = be16(nil, 0, 2, 3, 1, 0, 12)
+		})},
+		{name: "truncated format 4", data: with(func(f *testFont) { f.tables["cmap"] = testCmap4()[:30] })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTTF(tt.data); !errors.Is(err, ErrUnsupportedFont) {
+				t.Errorf("err = %v, want ErrUnsupportedFont", err)
+			}
+		})
+	}
+}
+
+func TestParseCmap12(t *testing.T) {
+	// формат 12 важнее формата 4, если в шрифте есть оба
+	format12 := be16(nil, 12, 0)
+	format12 = binary.BigEndian.AppendUint32(format12, 28)
+	format12 = binary.BigEndian.AppendUint32(format12, 0)
+	format12 = binary.BigEndian.AppendUint32(format12, 1)
+	for _, v := range []uint32{0x1F600, 0x1F602, 10} {
+		format12 = binary.BigEndian.AppendUint32(format12, v)
+	}
+
+	format4 := testCmap4()[12:]
+	cmap := be16(nil, 0, 2, 3, 1, 0, 20, 3, 10, 0, uint16(20+len(format4)))
+	cmap = append(append(cmap, format4...), format12...)
+
+	got, err := parseCmap(cmap)
+	if err != nil {
+		t.Fatalf("parseCmap: %v", err)
+	}
+	want := map[rune]uint16{0x1F600: 10, 0x1F601: 11, 0x1F602: 12}
+	if len(got) != len(want) {
+		t.Fatalf("got %d runes, want %d", len(got), len(want))
+	}
+	for r, gid := range want {
+		if got[r] != gid {
+			t.Errorf("%U = %d, want %d", r, got[r], gid)
+		}
+	}
+
+	bad := append([]byte{}, format12...)
+	binary.BigEndian.PutUint32(bad[20:], 0x1F5FF) // end < start
+	if _, err := parseCmap12(bad); !errors.Is(err, ErrUnsupportedFont) {
+		t.Errorf("end before start: err = %v", err)
+	}
+	if _, err := parseCmap12(format12[:20]); !errors.Is(err, ErrUnsupportedFont) {
+		t.Errorf("truncated groups: err = %v", err)
+	}
+}
+
+func TestLoadTTF(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "font.ttf")
+	if err := os.WriteFile(valid, newTestFont().build(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTTF(valid); err != nil {
+		t.Errorf("loadTTF: %v", err)
+	}
+
+	invalid := filepath.Join(dir, "font.otf")
+	if err := os.WriteFile(invalid, []byte("OTTO0000000000000"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTTF(invalid); !errors.Is(err, ErrUnsupportedFont) {
+		t.Errorf("OpenType CFF: err = %v, want ErrUnsupportedFont", err)
+	}
+
+	if _, err := loadTTF(filepath.Join(dir, "missing.ttf")); err == nil {
+		t.Error("missing file: no error")
+	}
+}
@@ -0,0 +1,118 @@
+package fulltext
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptyQuery = errors.New("query has no words to search for")
+
+const (
+	// MinWordLength - innodb_ft_min_token_size, более короткие слова не индексируются
+	MinWordLength = 3
+	// MaxTerms ограничивает сложность запроса к индексу
+	MaxTerms = 10
+)
+
+// stopwords - стоп-слова InnoDB по умолчанию, с ними обязательное слово ничего не находит
+var stopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"com": true, "de": true, "en": true, "for": true, "from": true, "how": true, "i": true, "in": true,
+	"is": true, "it": true, "la": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true, "who": true,
+	"will": true, "with": true, "und": true, "www": true,
+}
+
+// Term is a word or a quoted phrase of a search query. Words are lower case.
+type Term struct {
+	Words   []string
+	Phrase  bool
+	Exclude bool
+}
+
+// Parse splits a user query into terms: words match by prefix, "quoted
+// phrases" match as is, a word or phrase after - excludes documents. Any
+// other punctuation is a separator, so the result is safe for BooleanQuery.
+func Parse(query string) ([]Term, error) {
+	var terms []Term
+	var words []string
+	var word []rune
+	inPhrase, exclude := false, false
+
+	flushWord := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushTerm := func(phrase bool) {
+		flushWord()
+		if phrase && len(words) > 1 {
+			terms = append(terms, Term{Words: words, Phrase: true, Exclude: exclude})
+		} else {
+			for _, w := range words {
+				if len([]rune(w)) >= MinWordLength && !stopwords[w] {
+					terms = append(terms, Term{Words: []string{w}, Exclude: exclude})
+				}
+			}
+		}
+		words = nil
+		exclude = false
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"' && inPhrase:
+			flushTerm(true)
+			inPhrase = false
+		case r == '"':
+			// минус перед кавычкой относится к фразе
+			negated := exclude && len(word) == 0
+			flushTerm(false)
+			exclude = negated
+			inPhrase = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		case r == '-' && !inPhrase && len(word) == 0 && len(words) == 0:
+			exclude = true
+		case inPhrase:
+			flushWord()
+		default:
+			flushTerm(false)
+		}
+	}
+	// незакрытая кавычка - фраза до конца запроса
+	flushTerm(inPhrase)
+
+	if len(terms) > MaxTerms {
+		terms = terms[:MaxTerms]
+	}
+	for _, term := range terms {
+		if !term.Exclude {
+			return terms, nil
+		}
+	}
+
+	return nil, ErrEmptyQuery
+}
+
+// BooleanQuery renders terms for MATCH ... AGAINST (... IN BOOLEAN MODE):
+// every word or phrase is required, words match by prefix.
+func BooleanQuery(terms []Term) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		switch {
+		case term.Exclude && term.Phrase:
+			parts = append(parts, `-"`+strings.Join(term.Words, " ")+`"`)
+		case term.Exclude:
+			parts = append(parts, "-"+term.Words[0])
+		case term.Phrase:
+			parts = append(parts, `+"`+strings.Join(term.Words, " ")+`"`)
+		default:
+			parts = append(parts, "+"+term.Words[0]+"*")
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,178 @@
+package fulltext
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const ellipsis = "…"
+
+// Snippet is a fragment of a document around the first match of a query.
+type Snippet struct {
+	Text string
+	// Highlighted - Text, экранированный для HTML, совпадения обёрнуты в <mark>
+	Highlighted string
+	// Highlights - совпадения в Text, [начало, конец) в символах
+	Highlights [][2]int
+}
+
+type span struct {
+	start, end int
+}
+
+// MakeSnippet cuts about length characters of the body around the first
+// match of the terms and marks every match inside it. Matching follows
+// BooleanQuery: words by prefix, phrases word by word. If nothing matches
+// (e.g. the index is stale) the beginning of the body is returned.
+func MakeSnippet(body string, terms []Term, length int) Snippet {
+	// переводы строк и отступы транскрипта во фрагменте не нужны
+	text := []rune(strings.Join(strings.Fields(body), " "))
+	matches := findMatches(text, terms)
+
+	start, end := 0, len(text)
+	if len(text) > length {
+		end = length
+		if len(matches) > 0 {
+			first := matches[0]
+			start = max(0, first.start-length/4)
+			// начинаем с целого слова, но не позже совпадения
+			if start > 0 {
+				if i := slices.Index(text[start:first.start], ' '); i >= 0 {
+					start += i + 1
+				}
+			}
+			end = max(min(len(text), start+length), first.end)
+		}
+		if end < len(text) {
+			if i := lastIndex(text[:end], ' '); i > start && (len(matches) == 0 || i >= matches[0].end) {
+				end = i
+			}
+		}
+	}
+
+	var plain, marked strings.Builder
+	var highlights [][2]int
+	offset := 0
+	if start > 0 {
+		plain.WriteString(ellipsis)
+		marked.WriteString(ellipsis)
+		offset = 1
+	}
+
+	pos := start
+	for _, match := range matches {
+		if match.end <= start || match.start >= end {
+			continue
+		}
+		match.start, match.end = max(match.start, start), min(match.end, end)
+
+		plain.WriteString(string(text[pos:match.start]))
+		marked.WriteString(html.EscapeString(string(text[pos:match.start])))
+
+		plain.WriteString(string(text[match.start:match.end]))
+		marked.WriteString("<mark>" + html.EscapeString(string(text[match.start:match.end])) + "</mark>")
+		highlights = append(highlights, [2]int{match.start - start + offset, match.end - start + offset})
+
+		pos = match.end
+	}
+	plain.WriteString(string(text[pos:end]))
+	marked.WriteString(html.EscapeString(string(text[pos:end])))
+
+	if end < len(text) {
+		plain.WriteString(ellipsis)
+		marked.WriteString(ellipsis)
+	}
+
+	if highlights == nil {
+		highlights = [][2]int{}
+	}
+
+	return Snippet{
+		Text:        plain.String(),
+		Highlighted: marked.String(),
+		Highlights:  highlights,
+	}
+}
+
+// findMatches returns the sorted, non overlapping spans of text matched by
+// the positive terms.
+func findMatches(text []rune, terms []Term) []span {
+	var tokens []span
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if n := len(tokens); n > 0 && tokens[n-1].end == i {
+			tokens[n-1].end++
+		} else {
+			tokens = append(tokens, span{i, i + 1})
+		}
+	}
+
+	var matches []span
+	for _, term := range terms {
+		if term.Exclude {
+			continue
+		}
+		words := make([][]rune, len(term.Words))
+		for i, word := range term.Words {
+			words[i] = []rune(word)
+		}
+
+		for i := range tokens {
+			if i+len(words) > len(tokens) {
+				break
+			}
+			if !term.Phrase {
+				if hasPrefix(lower[tokens[i].start:tokens[i].end], words[0]) {
+					matches = append(matches, tokens[i])
+				}
+				continue
+			}
+
+			found := true
+			for j, word := range words {
+				token := tokens[i+j]
+				if !slices.Equal(lower[token.start:token.end], word) {
+					found = false
+					break
+				}
+			}
+			if found {
+				matches = append(matches, span{tokens[i].start, tokens[i+len(words)-1].end})
+			}
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b span) int {
+		return a.start - b.start
+	})
+
+	merged := matches[:0]
+	for _, match := range matches {
+		if n := len(merged); n > 0 && match.start <= merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, match.end)
+			continue
+		}
+		merged = append(merged, match)
+	}
+
+	return merged
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	return len(s) >= len(prefix) && slices.Equal(s[:len(prefix)], prefix)
+}
+
+func lastIndex(s []rune, r rune) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -2,72 +2,225 @@ package audioservice
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	minioapp "msu-logging-backend/internal/app/minio"
 	rmqapp "msu-logging-backend/internal/app/rmq"
 	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/api/links"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/services/taskevents"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
+// ErrNotPushed - прогресс без аренды для задачи, которую не обрабатывает push-воркер
+var ErrNotPushed = errors.New("task is not processed by a push worker")
+
 type AudioService struct {
 	log               *slog.Logger
 	minio             *minioapp.App
 	linkSaver         LinkSaver
 	taskStatusSaver   TaskStatusSaver
+	transcriptSaver   TranscriptSaver
+	jobSaver          JobSaver
+	progressSaver     ProgressSaver
+	metadataSaver     MetadataSaver
+	trackSaver        TrackSaver
+	protocols         ProtocolSaver
+	tracksMu          sync.Mutex
+	events            *taskevents.Broker
+	notifier          TaskNotifier
+	indexer           TranscriptIndexer
 	messageBroker     *rmqapp.App
 	toTranscribeQueue string
 	toProtocolQueue   string
+	dispatch          string
+	vad               *audio.VAD
+	storage           string
+	partSize          int
+	tempDir           string
 }
 
 type LinkSaver interface {
-	SaveAudioFile(ctx context.Context, link string) (int64, error)
-	UpdateProtocolShortText(ctx context.Context, taskId int32, protocol string) (int64, error)
-	UpdateProtocolFullText(ctx context.Context, taskId int32, full_text string) (int64, error)
+	SaveAudioFile(ctx context.Context, object rabbitmodels.ObjectRef) (int64, error)
+	UpdateProtocolFullText(ctx context.Context, taskId int32, full_text rabbitmodels.ObjectRef) (int64, error)
+	GetProtocol(ctx context.Context, id int32) (rabbitmodels.ObjectRef, rabbitmodels.ObjectRef, error)
+}
+
+// TaskNotifier gets the status events of tasks for outside subscribers (webhooks).
+type TaskNotifier interface {
+	Notify(event taskevents.Event)
+}
+
+// TranscriptIndexer adds finished transcripts to the search index.
+type TranscriptIndexer interface {
+	IndexTranscript(ctx context.Context, taskId int32, result rabbitmodels.TranscriptionResult) error
+}
+
+type ProtocolSaver interface {
+	SaveNLP(ctx context.Context, taskId int32, text string) (rabbitmodels.ProtocolRevision, bool, error)
 }
 
 type TaskStatusSaver interface {
 	UpdateTaskStatusByID(ctx context.Context, id int32, task_status string) error
+	GetTaskStatusByID(ctx context.Context, id int32) (string, error)
 }
 
+type TranscriptSaver interface {
+	SaveTranscription(ctx context.Context, taskId int32, result rabbitmodels.TranscriptionResult) error
+}
+
+type JobSaver interface {
+	CreateJob(ctx context.Context, taskId int32, kind string, payload []byte) (int64, error)
+	FinishTaskJobs(ctx context.Context, taskId int32, kind string) error
+}
+
+type ProgressSaver interface {
+	SaveTaskProgress(ctx context.Context, progress rabbitmodels.TaskProgress) error
+}
+
+type TrackSaver interface {
+	SaveTrack(ctx context.Context, taskId int32, track rabbitmodels.Track) error
+	GetTracks(ctx context.Context, taskId int32) ([]rabbitmodels.Track, error)
+}
+
+type MetadataSaver interface {
+	GetTaskMetadata(ctx context.Context, taskId int32) (rabbitmodels.TaskMetadata, error)
+	SaveTaskMetadata(ctx context.Context, taskId int32, metadata rabbitmodels.TaskMetadata) error
+}
+
+// Как задачи попадают к воркерам. both - сначала пул, а задачу, которую
+// никто не взял вовремя, leaseservice отправляет в RabbitMQ (PushJob).
+// Каждая задача уходит ровно одним путём.
+const (
+	DispatchPush = "push"
+	DispatchPull = "pull"
+	DispatchBoth = "both"
+)
+
+// Storage is everything the service keeps in MySQL.
+type Storage interface {
+	LinkSaver
+	TaskStatusSaver
+	TranscriptSaver
+	JobSaver
+	ProgressSaver
+	MetadataSaver
+	TrackSaver
+}
+
+// Config - настройки сервиса из config.yaml
+type Config struct {
+	TranscribeQueue string
+	ProtocolQueue   string
+	// Dispatch - DispatchPush, DispatchPull или DispatchBoth
+	Dispatch string
+	// Storage - StorageStream или StorageDisk
+	Storage  string
+	PartSize int
+	TempDir  string
+	// VAD - nil, если обрезка тишины выключена
+	VAD *audio.VAD
+}
+
+// New creates the service. notifier and indexer are optional, nil turns
+// webhooks or search indexing off, like a nil cfg.VAD turns off VAD.
 func New(
 	log *slog.Logger,
-	linkSaver LinkSaver,
-	taskStatusSaver TaskStatusSaver,
+	storage Storage,
+	events *taskevents.Broker,
 	messageBroker *rmqapp.App,
 	minio *minioapp.App,
-	toTranscribeQueue string,
-	toProtocolQueue string,
+	protocols ProtocolSaver,
+	notifier TaskNotifier,
+	indexer TranscriptIndexer,
+	cfg Config,
 ) *AudioService {
 	return &AudioService{
 		log:               log,
-		linkSaver:         linkSaver,
-		taskStatusSaver:   taskStatusSaver,
+		linkSaver:         storage,
+		taskStatusSaver:   storage,
+		transcriptSaver:   storage,
+		jobSaver:          storage,
+		progressSaver:     storage,
+		metadataSaver:     storage,
+		trackSaver:        storage,
+		events:            events,
 		messageBroker:     messageBroker,
 		minio:             minio,
-		toTranscribeQueue: toTranscribeQueue,
-		toProtocolQueue:   toProtocolQueue,
+		toTranscribeQueue: cfg.TranscribeQueue,
+		toProtocolQueue:   cfg.ProtocolQueue,
+		dispatch:          cfg.Dispatch,
+		vad:               cfg.VAD,
+		storage:           cfg.Storage,
+		partSize:          cfg.PartSize,
+		tempDir:           cfg.TempDir,
+		protocols:         protocols,
+		notifier:          notifier,
+		indexer:           indexer,
 	}
 }
 
-func (a *AudioService) StartFileProcessing(taskId int32, filename string) error {
-	const op = "audioservice.WhenWebsocketClosed"
+// FinishTrack uploads one recorded track file.
+func (a *AudioService) FinishTrack(taskId int32, source string, filename string, metadata rabbitmodels.TrackMetadata) error {
+	const op = "audioservice.FinishTrack"
 
 	log := a.log.With(
 		slog.String("op", op),
+		slog.Int("task_id", int(taskId)),
+		slog.String("source", source),
 	)
 
-	link, err := a.minio.UploadFile(filename, filename)
+	contentType, _ := audio.DetectFile(filename, "")
+
+	if contentType == "audio/wav" {
+		if speech, ok := a.trimSilence(taskId, filename); ok {
+			metadata.SpeechDurationSeconds = speech.Seconds()
+		}
+	}
+
+	object, err := a.minio.UploadFileWithContentType(filepath.Base(filename), filename, contentType)
 	if err != nil {
 		a.log.Error("Minio upload error", slog.String("error", err.Error()))
 		return fmt.Errorf("%s:Minio upload error: %w", op, err)
 	}
 
-	log.Info("Audiofile uploaded to minio succesfully")
+	log.Info("Audiofile uploaded to minio succesfully", slog.String("content_type", contentType))
 
 	os.Remove(filename)
 
-	_, err = a.linkSaver.SaveAudioFile(context.Background(), link)
+	return a.FinishUploadedTrack(taskId, source, object, contentType, metadata)
+}
+
+// FinishUploadedTrack saves a track that is already in MinIO. When no other
+// source of the task is still recording, all tracks are sent to transcription together.
+func (a *AudioService) FinishUploadedTrack(taskId int32, source string, object rabbitmodels.ObjectRef, contentType string, metadata rabbitmodels.TrackMetadata) error {
+	const op = "audioservice.FinishUploadedTrack"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("task_id", int(taskId)),
+		slog.String("source", source),
+	)
+
+	_, err := a.linkSaver.SaveAudioFile(context.Background(), object)
+	if err != nil {
+		log.Error("MySQL save error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: MySQL save error: %w", op, err)
+	}
+
+	err = a.trackSaver.SaveTrack(context.Background(), taskId, rabbitmodels.Track{
+		Source:      source,
+		State:       rabbitmodels.TrackStateUploaded,
+		Object:      object,
+		ContentType: contentType,
+		Metadata:    metadata,
+	})
 	if err != nil {
 		log.Error("MySQL save error", slog.String("error", err.Error()))
 		return fmt.Errorf("%s: MySQL save error: %w", op, err)
@@ -75,34 +228,148 @@ func (a *AudioService) StartFileProcessing(taskId int32, filename string) error
 
 	log.Info("Audiofile uploaded to MySQL succesfully")
 
+	if metadata.SpeechDurationSeconds > 0 {
+		a.saveSpeechDuration(taskId, time.Duration(metadata.SpeechDurationSeconds*float64(time.Second)))
+	}
+
+	return a.startTranscription(taskId)
+}
+
+// startTranscription sends every track of the task to transcription once the
+// last source has finished. Tracks of one task finish concurrently, so the
+// check and the dispatch are done under tracksMu.
+func (a *AudioService) startTranscription(taskId int32) error {
+	const op = "audioservice.startTranscription"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("task_id", int(taskId)),
+	)
+
+	a.tracksMu.Lock()
+	defer a.tracksMu.Unlock()
+
+	status, err := a.taskStatusSaver.GetTaskStatusByID(context.Background(), taskId)
+	if err != nil {
+		log.Error("MySQL read error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: MySQL read error: %w", op, err)
+	}
+	if status != "" && status != "none" {
+		log.Info("Transcription is already started", slog.String("status", status))
+		return nil
+	}
+
+	tracks, err := a.trackSaver.GetTracks(context.Background(), taskId)
+	if err != nil {
+		log.Error("MySQL read error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: MySQL read error: %w", op, err)
+	}
+
+	for _, track := range tracks {
+		if track.State == rabbitmodels.TrackStateRecording {
+			log.Info("Waiting for other sources", slog.String("source", track.Source))
+			return nil
+		}
+	}
+	if len(tracks) == 0 {
+		return fmt.Errorf("%s: task has no tracks", op)
+	}
+
+	if err := a.PresignTracks(context.Background(), tracks); err != nil {
+		log.Error("Minio presign error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: Minio presign error: %w", op, err)
+	}
+
 	transcribeRequestData := rabbitmodels.TranscribeRequest{
 		TaskId:        taskId,
-		AudioFileLink: link,
+		AudioFileLink: tracks[0].AudioFileLink,
+		ContentType:   tracks[0].ContentType,
+		Tracks:        tracks,
 	}
 
-	err = a.messageBroker.SendTranscribeRequest(a.toTranscribeQueue, transcribeRequestData)
+	err = a.sendTranscribeRequest(transcribeRequestData)
 	if err != nil {
-		log.Error("RabbitMQ publish error", slog.String("error", err.Error()))
-		return fmt.Errorf("%s: RabbitMQ publish error: %w", op, err)
+		log.Error("Dispatch error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: Dispatch error: %w", op, err)
 	}
 
-	err = a.taskStatusSaver.UpdateTaskStatusByID(context.Background(), taskId, "transcribing")
+	err = a.updateTaskStatus(taskId, "transcribing")
 
 	if err != nil {
 		a.log.Error("Error while updating the task", slog.String("error", err.Error()))
 		return fmt.Errorf("%s: Error while updating the task: %w", op, err)
 	}
 
+	log.Info("Tracks sent to transcription", slog.Int("tracks", len(tracks)))
+
 	return nil
 }
 
-func (a *AudioService) WhenAudioTranscribed(taskId int32, transcribedText string) error {
+// trimSilence cuts silence around speech before upload and returns the speech duration.
+// Errors are only logged, the file is processed as is.
+func (a *AudioService) trimSilence(taskId int32, filename string) (time.Duration, bool) {
+	const op = "audioservice.trimSilence"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("task_id", int(taskId)),
+	)
+
+	if a.vad == nil {
+		return 0, false
+	}
+
+	speech, err := a.vad.TrimWAV(filename)
+	if errors.Is(err, audio.ErrUnsupportedWAV) {
+		log.Debug("WAV is not 16 bit PCM, skipping VAD")
+		return 0, false
+	}
+	if err != nil {
+		log.Error("Failed to trim silence", slog.String("error", err.Error()))
+		return 0, false
+	}
+
+	log.Info("Silence trimmed", slog.Duration("speech", speech))
+
+	return speech, true
+}
+
+// saveSpeechDuration keeps the longest speech among the tracks in the task metadata.
+func (a *AudioService) saveSpeechDuration(taskId int32, speech time.Duration) {
+	const op = "audioservice.saveSpeechDuration"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("task_id", int(taskId)),
+	)
+
+	a.tracksMu.Lock()
+	defer a.tracksMu.Unlock()
+
+	metadata, err := a.metadataSaver.GetTaskMetadata(context.Background(), taskId)
+	if err != nil {
+		log.Error("MySQL read error", slog.String("error", err.Error()))
+		return
+	}
+	if metadata.SpeechDurationSeconds >= speech.Seconds() {
+		return
+	}
+
+	metadata.SpeechDurationSeconds = speech.Seconds()
+	if err := a.metadataSaver.SaveTaskMetadata(context.Background(), taskId, metadata); err != nil {
+		log.Error("MySQL save error", slog.String("error", err.Error()))
+	}
+}
+
+func (a *AudioService) WhenAudioTranscribed(taskId int32, result rabbitmodels.TranscriptionResult) error {
 	const op = "audioservice.WhenAudioTranscribed"
 
 	log := a.log.With(
 		slog.String("op", op),
 	)
 
+	transcribedText := result.FullText()
+
 	transcribtionFilename := fmt.Sprintf("transcribed_%v.txt", taskId)
 
 	file, err := os.Create(transcribtionFilename)
@@ -116,7 +383,7 @@ func (a *AudioService) WhenAudioTranscribed(taskId int32, transcribedText string
 		return fmt.Errorf("%s:File writing error: %w", op, err)
 	}
 
-	protocolLink, err := a.minio.UploadFile(transcribtionFilename, transcribtionFilename)
+	transcriptObject, err := a.minio.UploadFile(transcribtionFilename, transcribtionFilename)
 	if err != nil {
 		a.log.Error("Minio upload error", slog.String("error", err.Error()))
 		return fmt.Errorf("%s:Minio upload error: %w", op, err)
@@ -126,24 +393,45 @@ func (a *AudioService) WhenAudioTranscribed(taskId int32, transcribedText string
 	file.Close()
 	os.Remove(transcribtionFilename)
 
-	_, err = a.linkSaver.UpdateProtocolFullText(context.Background(), taskId, protocolLink)
+	_, err = a.linkSaver.UpdateProtocolFullText(context.Background(), taskId, transcriptObject)
+	if err != nil {
+		log.Error("MySQL save error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: MySQL save error: %w", op, err)
+	}
+
+	err = a.transcriptSaver.SaveTranscription(context.Background(), taskId, result)
 	if err != nil {
 		log.Error("MySQL save error", slog.String("error", err.Error()))
 		return fmt.Errorf("%s: MySQL save error: %w", op, err)
 	}
 
+	log.Info(fmt.Sprintf("Transcribtion #%v segments saved", taskId), slog.Int("segments", len(result.Segments)))
+
+	if a.indexer != nil {
+		if err := a.indexer.IndexTranscript(context.Background(), taskId, result); err != nil {
+			log.Error("Failed to index transcript", slog.String("error", err.Error()))
+		}
+	}
+
 	protocolRequestData := rabbitmodels.ProtocolRequest{
 		TaskId:          taskId,
 		TranscribedText: transcribedText,
+		Language:        result.Language,
 	}
 
-	err = a.messageBroker.SendProtocolRequest(a.toProtocolQueue, protocolRequestData)
+	err = a.jobSaver.FinishTaskJobs(context.Background(), taskId, rabbitmodels.JobKindTranscribe)
 	if err != nil {
-		log.Error("RabbitMQ publish error", slog.String("error", err.Error()))
-		return fmt.Errorf("%s: RabbitMQ publish error: %w", op, err)
+		log.Error("MySQL save error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: MySQL save error: %w", op, err)
+	}
+
+	err = a.sendProtocolRequest(protocolRequestData)
+	if err != nil {
+		log.Error("Dispatch error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: Dispatch error: %w", op, err)
 	}
 
-	err = a.taskStatusSaver.UpdateTaskStatusByID(context.Background(), taskId, "making protocol")
+	err = a.updateTaskStatus(taskId, "making protocol")
 	if err != nil {
 		a.log.Error("Error while updating the task", slog.String("error", err.Error()))
 		return fmt.Errorf("%s: Error while updating the task: %w", op, err)
@@ -159,42 +447,275 @@ func (a *AudioService) WhenProtocolIsReady(taskId int32, protocolText string) er
 		slog.String("op", op),
 	)
 
-	protocolFilename := fmt.Sprintf("protocol_%v.txt", taskId)
+	// первая ревизия - оригинал от NLP, правки его не перезаписывают
+	revision, saved, err := a.protocols.SaveNLP(context.Background(), taskId, protocolText)
+	if err != nil {
+		log.Error("Protocol save error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: Protocol save error: %w", op, err)
+	}
 
-	file, err := os.Create(protocolFilename)
+	if saved {
+		log.Info(fmt.Sprintf("Protocol #%v saved as revision %d", taskId, revision.Number))
+	} else {
+		// повторная доставка: если задача уже закончена, второй раз о ней не сообщаем
+		status, err := a.taskStatusSaver.GetTaskStatusByID(context.Background(), taskId)
+		if err == nil && status == "finished" {
+			log.Info(fmt.Sprintf("Protocol #%v is already saved as revision %d, skipping", taskId, revision.Number))
+			return nil
+		}
+	}
+
+	err = a.jobSaver.FinishTaskJobs(context.Background(), taskId, rabbitmodels.JobKindProtocol)
 	if err != nil {
-		log.Error("File creation error:", slog.String("error", err.Error()))
-		return fmt.Errorf("%s:File creation error: %w", op, err)
+		log.Error("MySQL save error", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: MySQL save error: %w", op, err)
 	}
-	_, err = file.Write([]byte(protocolText))
+
+	err = a.updateTaskStatus(taskId, "finished")
+
 	if err != nil {
-		log.Error("File writing error:", slog.String("error", err.Error()))
-		return fmt.Errorf("%s:File writing error: %w", op, err)
+		log.Error("Error while updating the task", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: Error while updating the task:%w", op, err)
 	}
 
-	protocolLink, err := a.minio.UploadFile(protocolFilename, protocolFilename)
+	// событие уходит в WebSocket, SSE и вебхуки: ссылки на API, файлы отдаются только с токеном
+	var fullProtocolLink string
+	_, fullProtocolObject, err := a.linkSaver.GetProtocol(context.Background(), taskId)
 	if err != nil {
-		a.log.Error("Minio upload error", slog.String("error", err.Error()))
-		return fmt.Errorf("%s:Minio upload error: %w", op, err)
+		log.Error("Failed to get full protocol", slog.String("error", err.Error()))
+	} else if !fullProtocolObject.IsZero() {
+		fullProtocolLink = links.Transcript(taskId)
 	}
 
-	log.Info(fmt.Sprintf("Protocol #%v uploaded to minio succesfully", taskId))
-	file.Close()
-	os.Remove(protocolFilename)
+	a.publish(taskevents.Event{
+		Type:          taskevents.EventProtocolReady,
+		TaskId:        taskId,
+		Status:        "finished",
+		ShortProtocol: links.Protocol(taskId),
+		FullProtocol:  fullProtocolLink,
+	})
 
-	_, err = a.linkSaver.UpdateProtocolShortText(context.Background(), taskId, protocolLink)
+	return nil
+}
+
+// WhenJobFailed marks the task failed when its job ran out of attempts.
+func (a *AudioService) WhenJobFailed(taskId int32, kind string) error {
+	const op = "audioservice.WhenJobFailed"
+
+	if err := a.updateTaskStatus(taskId, "failed"); err != nil {
+		a.log.Error("Error while updating the task", slog.String("op", op), slog.String("kind", kind), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: Error while updating the task: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetTaskStatus saves and publishes a status set outside the service, such
+// as "none" when a recording starts.
+func (a *AudioService) SetTaskStatus(taskId int32, status string) error {
+	return a.updateTaskStatus(taskId, status)
+}
+
+// updateTaskStatus saves the new status and notifies listeners of the task.
+func (a *AudioService) updateTaskStatus(taskId int32, status string) error {
+	err := a.taskStatusSaver.UpdateTaskStatusByID(context.Background(), taskId, status)
 	if err != nil {
-		log.Error("MySQL save error", slog.String("error", err.Error()))
+		return err
+	}
+
+	a.publish(taskevents.Event{
+		Type:   taskevents.EventStatus,
+		TaskId: taskId,
+		Status: status,
+	})
+
+	return nil
+}
+
+// publish sends a status change to listeners of the task and to webhooks.
+func (a *AudioService) publish(event taskevents.Event) {
+	event = a.events.Publish(event)
+
+	if a.notifier != nil {
+		a.notifier.Notify(event)
+	}
+}
+
+// ReportProgress stores the latest worker progress and notifies listeners of the task.
+func (a *AudioService) ReportProgress(taskId int32, progress rabbitmodels.TaskProgress) error {
+	const op = "audioservice.ReportProgress"
+
+	progress.TaskId = taskId
+	progress.UpdatedAt = time.Now()
+
+	err := a.progressSaver.SaveTaskProgress(context.Background(), progress)
+	if err != nil {
+		a.log.Error("MySQL save error", slog.String("op", op), slog.String("error", err.Error()))
 		return fmt.Errorf("%s: MySQL save error: %w", op, err)
 	}
 
-	log.Info("Protocol uploaded to MySQL succesfully")
+	a.events.Publish(taskevents.Event{
+		Type:     taskevents.EventProgress,
+		TaskId:   taskId,
+		Progress: &progress,
+	})
 
-	err = a.taskStatusSaver.UpdateTaskStatusByID(context.Background(), taskId, "finished")
+	return nil
+}
+
+// ReportPushProgress accepts progress of a push worker, which holds no lease
+// to address the task by: tasks must go to RabbitMQ and this one must be
+// transcribing or making its protocol.
+func (a *AudioService) ReportPushProgress(ctx context.Context, taskId int32, progress rabbitmodels.TaskProgress) error {
+	const op = "audioservice.ReportPushProgress"
+
+	if a.dispatch == DispatchPull {
+		return fmt.Errorf("%s: %w", op, ErrNotPushed)
+	}
 
+	status, err := a.taskStatusSaver.GetTaskStatusByID(ctx, taskId)
 	if err != nil {
-		log.Error("Error while updating the task", slog.String("error", err.Error()))
-		return fmt.Errorf("%s: Error while updating the task:%w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if status != "transcribing" && status != "making protocol" {
+		return fmt.Errorf("%s: task is %s: %w", op, status, ErrNotPushed)
+	}
+
+	return a.ReportProgress(taskId, progress)
+}
+
+func (a *AudioService) pushEnabled() bool {
+	return a.dispatch == DispatchPush
+}
+
+func (a *AudioService) pullEnabled() bool {
+	return a.dispatch == DispatchPull || a.dispatch == DispatchBoth
+}
+
+// PresignTracks fills AudioFileLink of the tracks with fresh links.
+// Tracks without an object (jobs queued before keys were stored) keep their link.
+func (a *AudioService) PresignTracks(ctx context.Context, tracks []rabbitmodels.Track) error {
+	for i := range tracks {
+		if tracks[i].Object.IsZero() {
+			continue
+		}
+		link, err := a.minio.PresignedURL(ctx, tracks[i].Object)
+		if err != nil {
+			return err
+		}
+		tracks[i].AudioFileLink = link
+	}
+	return nil
+}
+
+// RefreshJobPayload presigns the links of a transcribe job again:
+// a job may wait in the pool longer than a link lives.
+func (a *AudioService) RefreshJobPayload(ctx context.Context, job rabbitmodels.Job) (json.RawMessage, error) {
+	const op = "audioservice.RefreshJobPayload"
+
+	if job.Kind != rabbitmodels.JobKindTranscribe {
+		return job.Payload, nil
+	}
+
+	var request rabbitmodels.TranscribeRequest
+	if err := json.Unmarshal(job.Payload, &request); err != nil {
+		return nil, fmt.Errorf("%s: error in decoding json: %w", op, err)
+	}
+
+	if err := a.PresignTracks(ctx, request.Tracks); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(request.Tracks) > 0 {
+		request.AudioFileLink = request.Tracks[0].AudioFileLink
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error in encoding json: %w", op, err)
+	}
+
+	return payload, nil
+}
+
+// sendTranscribeRequest hands the request to exactly one path: push publishes
+// it to RabbitMQ, pull and both put it into the lease pool, where in both mode
+// the lease service pushes it later if no worker takes it.
+func (a *AudioService) sendTranscribeRequest(transcribeRequestData rabbitmodels.TranscribeRequest) error {
+	const op = "audioservice.sendTranscribeRequest"
+
+	if a.pullEnabled() {
+		if err := a.enqueueJob(transcribeRequestData.TaskId, rabbitmodels.JobKindTranscribe, transcribeRequestData); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if a.pushEnabled() {
+		if err := a.messageBroker.SendTranscribeRequest(a.toTranscribeQueue, transcribeRequestData); err != nil {
+			return fmt.Errorf("%s: RabbitMQ publish error: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *AudioService) sendProtocolRequest(protocolRequestData rabbitmodels.ProtocolRequest) error {
+	const op = "audioservice.sendProtocolRequest"
+
+	if a.pullEnabled() {
+		if err := a.enqueueJob(protocolRequestData.TaskId, rabbitmodels.JobKindProtocol, protocolRequestData); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if a.pushEnabled() {
+		if err := a.messageBroker.SendProtocolRequest(a.toProtocolQueue, protocolRequestData); err != nil {
+			return fmt.Errorf("%s: RabbitMQ publish error: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// PushJob publishes a pool job to RabbitMQ, when no pull worker took it in time.
+func (a *AudioService) PushJob(ctx context.Context, job rabbitmodels.Job) error {
+	const op = "audioservice.PushJob"
+
+	payload, err := a.RefreshJobPayload(ctx, job)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch job.Kind {
+	case rabbitmodels.JobKindTranscribe:
+		var request rabbitmodels.TranscribeRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return fmt.Errorf("%s: error in decoding json: %w", op, err)
+		}
+		err = a.messageBroker.SendTranscribeRequest(a.toTranscribeQueue, request)
+	case rabbitmodels.JobKindProtocol:
+		var request rabbitmodels.ProtocolRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return fmt.Errorf("%s: error in decoding json: %w", op, err)
+		}
+		err = a.messageBroker.SendProtocolRequest(a.toProtocolQueue, request)
+	default:
+		return fmt.Errorf("%s: unknown job kind %s", op, job.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: RabbitMQ publish error: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *AudioService) enqueueJob(taskId int32, kind string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error in encoding json: %w", err)
+	}
+
+	if _, err := a.jobSaver.CreateJob(context.Background(), taskId, kind, body); err != nil {
+		return fmt.Errorf("error in saving job: %w", err)
 	}
 
 	return nil
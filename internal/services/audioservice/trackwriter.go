@@ -0,0 +1,287 @@
+package audioservice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/audio"
+	"os"
+	"path/filepath"
+)
+
+// StorageStream sends a recording to MinIO part by part while it arrives,
+// StorageDisk writes it to a temp file that is uploaded at the end.
+const (
+	StorageStream = "stream"
+	StorageDisk   = "disk"
+)
+
+// TrackWriter receives the audio of one track while it is being recorded.
+type TrackWriter interface {
+	Write(p []byte) (int, error)
+	// SetFormat declares what the client sends, it is used when the container is not recognised.
+	SetFormat(format audio.Format)
+	// Target is the file or object the track is written to, for logs and the admin view.
+	Target() string
+	Size() int64
+	// Finish completes the track and sends it to processing.
+	Finish(metadata rabbitmodels.TrackMetadata) error
+	// Abort drops everything written so far.
+	Abort()
+}
+
+// NewTrackWriter starts a track in the configured storage.
+func (a *AudioService) NewTrackWriter(taskId int32, source string) (TrackWriter, error) {
+	const op = "audioservice.NewTrackWriter"
+
+	name := fmt.Sprintf("audio_%v_%s", taskId, source)
+
+	if a.storage == StorageDisk {
+		filename := filepath.Join(a.tempDir, name+".part")
+		file, err := os.Create(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: file creation error: %w", op, err)
+		}
+
+		return &fileTrack{service: a, taskId: taskId, source: source, file: file, filename: filename}, nil
+	}
+
+	track := &streamTrack{service: a, taskId: taskId, source: source, dataLeft: -1}
+	track.stream = a.minio.NewStream(a.partSize, func(head []byte) (string, string) {
+		contentType, ext := audio.Detect(head, track.format.MimeType)
+		return name + ext, contentType
+	})
+
+	return track, nil
+}
+
+type fileTrack struct {
+	service  *AudioService
+	taskId   int32
+	source   string
+	file     *os.File
+	filename string
+	size     int64
+	format   audio.Format
+}
+
+func (t *fileTrack) Write(p []byte) (int, error) {
+	n, err := t.file.Write(p)
+	t.size += int64(n)
+	return n, err
+}
+
+func (t *fileTrack) SetFormat(format audio.Format) {
+	t.format = format
+}
+
+func (t *fileTrack) Target() string {
+	return t.filename
+}
+
+func (t *fileTrack) Size() int64 {
+	return t.size
+}
+
+// Finish gives the file a proper extension and uploads it.
+func (t *fileTrack) Finish(metadata rabbitmodels.TrackMetadata) error {
+	log := t.service.log.With(slog.Int("task_id", int(t.taskId)), slog.String("source", t.source))
+
+	t.file.Close()
+
+	ext := ".wav"
+	if t.format.IsPCM() {
+		if err := audio.FinalizeWAV(t.filename); err != nil {
+			log.Error("Failed to finalize WAV", slog.String("error", err.Error()))
+		}
+	} else {
+		_, ext = audio.DetectFile(t.filename, t.format.MimeType)
+	}
+
+	processed, err := audio.RenameWithExtension(t.filename, ext)
+	if err != nil {
+		log.Error("Failed to rename recording", slog.String("error", err.Error()))
+	}
+	defer os.Remove(processed)
+
+	return t.service.FinishTrack(t.taskId, t.source, processed, metadata)
+}
+
+func (t *fileTrack) Abort() {
+	t.file.Close()
+	os.Remove(t.filename)
+}
+
+// maxWAVHeader - дальше начала файла чанк data не ищем, такой WAV сохраняется как есть
+const maxWAVHeader = 64 << 10
+
+type streamTrack struct {
+	service *AudioService
+	taskId  int32
+	source  string
+	stream  *minioapp.Stream
+	format  audio.Format
+	// trimmer есть у PCM и загруженных WAV при включённом VAD, заголовок WAV идёт мимо него
+	trimmer *audio.Trimmer
+	header  int
+	// wavHead копит начало загруженного WAV, пока не найден чанк data
+	wavHead  []byte
+	parseWAV bool
+	// dataLeft - сколько байт данных осталось в загруженном WAV, чанки после
+	// data отбрасываются; -1 - без ограничения
+	dataLeft int64
+	// size - сколько получено от клиента, с обрезкой в MinIO уходит меньше
+	size int64
+}
+
+func (t *streamTrack) Write(p []byte) (int, error) {
+	n, err := t.write(p)
+	t.size += int64(n)
+	return n, err
+}
+
+func (t *streamTrack) write(p []byte) (int, error) {
+	if t.parseWAV {
+		return t.writeWAV(p)
+	}
+	if t.trimmer == nil {
+		return t.stream.Write(p)
+	}
+
+	n := 0
+	if t.header > 0 {
+		header := min(t.header, len(p))
+		written, err := t.stream.Write(p[:header])
+		n += written
+		t.header -= written
+		if err != nil {
+			return n, err
+		}
+		p = p[header:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	written, err := t.trim(p)
+	return n + written, err
+}
+
+func (t *streamTrack) trim(p []byte) (int, error) {
+	n := len(p)
+	if t.dataLeft >= 0 {
+		p = p[:min(int64(len(p)), t.dataLeft)]
+		t.dataLeft -= int64(len(p))
+	}
+
+	_, err := t.trimmer.Write(p)
+	return n, err
+}
+
+// writeWAV waits for the data chunk of an uploaded WAV. 16 bit PCM gets a
+// canonical header and its data goes through the trimmer, like TrimWAV does
+// with a file on disk. Anything else is stored as is.
+func (t *streamTrack) writeWAV(p []byte) (int, error) {
+	t.wavHead = append(t.wavHead, p...)
+
+	info, err := audio.ParseWAVHeader(t.wavHead)
+	if errors.Is(err, io.ErrUnexpectedEOF) && len(t.wavHead) < maxWAVHeader {
+		return len(p), nil
+	}
+
+	head := t.wavHead
+	t.wavHead = nil
+	t.parseWAV = false
+
+	if err != nil || !info.IsPCM16() {
+		_, err := t.stream.Write(head)
+		return len(p), err
+	}
+
+	var header bytes.Buffer
+	if err := audio.WriteWAVHeader(&header, info.SampleRate, info.Channels, audio.WAVUnknownSize); err != nil {
+		return 0, err
+	}
+	t.stream.HoldHead(audio.PatchWAVHeader)
+	if _, err := t.stream.Write(header.Bytes()); err != nil {
+		return 0, err
+	}
+
+	t.trimmer = t.service.vad.NewTrimmer(t.stream, info.SampleRate, info.Channels)
+	t.dataLeft = info.DataSize
+	_, err = t.trim(head[info.DataOffset:])
+	return len(p), err
+}
+
+// SetFormat also starts trimming silence of PCM, the next WAVHeaderSize bytes
+// are the header, and of an uploaded WAV once its header is read. The header
+// of PCM is sent last, with the final sizes.
+func (t *streamTrack) SetFormat(format audio.Format) {
+	t.format = format
+	if format.IsPCM() {
+		t.stream.HoldHead(audio.PatchWAVHeader)
+	}
+	if t.service.vad == nil || t.trimmer != nil || t.parseWAV {
+		return
+	}
+
+	switch {
+	case format.IsPCM():
+		t.trimmer = t.service.vad.NewTrimmer(t.stream, format.SampleRate, format.Channels)
+		t.header = audio.WAVHeaderSize
+	case format.MimeType == "audio/wav":
+		t.parseWAV = true
+	}
+}
+
+func (t *streamTrack) Target() string {
+	return t.stream.ObjectName()
+}
+
+func (t *streamTrack) Size() int64 {
+	return t.size
+}
+
+// Finish drops the trailing silence and uploads the last part. Leading
+// silence never reached MinIO.
+func (t *streamTrack) Finish(metadata rabbitmodels.TrackMetadata) error {
+	const op = "audioservice.streamTrack.Finish"
+
+	if t.parseWAV {
+		// файл кончился раньше чанка data
+		t.parseWAV = false
+		if _, err := t.stream.Write(t.wavHead); err != nil {
+			t.Abort()
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if t.trimmer != nil {
+		if err := t.trimmer.Flush(); err != nil {
+			t.Abort()
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if metadata.SpeechDurationSeconds == 0 {
+			metadata.SpeechDurationSeconds = t.trimmer.SpeechDuration().Seconds()
+		}
+	}
+
+	object, contentType, err := t.stream.Complete(context.Background())
+	if err != nil {
+		t.Abort()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return t.service.FinishUploadedTrack(t.taskId, t.source, object, contentType, metadata)
+}
+
+func (t *streamTrack) Abort() {
+	if err := t.stream.Abort(context.Background()); err != nil {
+		t.service.log.Error("Failed to abort upload", slog.Int("task_id", int(t.taskId)), slog.String("error", err.Error()))
+	}
+}
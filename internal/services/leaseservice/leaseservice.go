@@ -0,0 +1,316 @@
+package leaseservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"sync"
+	"time"
+)
+
+var ErrUnknownJobKind = errors.New("unknown job kind")
+
+const (
+	// sweepInterval - как часто пул проверяется на задачи для RabbitMQ
+	sweepInterval = 10 * time.Second
+	// pushBatch - сколько задач отправляется за один проход
+	pushBatch = 50
+)
+
+// LeaseService hands out pending jobs to pull workers. Results go through
+// the same AudioProcessor methods the push workers use.
+type LeaseService struct {
+	log            *slog.Logger
+	jobPool        JobPool
+	audioProcessor AudioProcessor
+	leaseTimeout   time.Duration
+	maxWait        time.Duration
+	pollInterval   time.Duration
+	pushFallback   time.Duration
+	maxAttempts    int
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type JobPool interface {
+	ClaimUnleasedJobs(ctx context.Context, before time.Time, limit int) ([]rabbitmodels.Job, error)
+	ReturnPushedJob(ctx context.Context, jobId int64) error
+	LeaseJob(ctx context.Context, kinds []string, workerId, leaseId string, leaseTimeout time.Duration, maxAttempts int) (rabbitmodels.Job, bool, error)
+	RenewLease(ctx context.Context, jobId int64, leaseId string, leaseTimeout time.Duration) (time.Time, error)
+	GetLeasedJob(ctx context.Context, jobId int64, leaseId string) (rabbitmodels.Job, error)
+	ReleaseJob(ctx context.Context, jobId int64, leaseId string) error
+	FailJob(ctx context.Context, jobId int64, leaseId string) error
+	FailExpiredJobs(ctx context.Context, maxAttempts int) ([]rabbitmodels.Job, error)
+}
+
+type AudioProcessor interface {
+	WhenAudioTranscribed(taskId int32, result rabbitmodels.TranscriptionResult) error
+	WhenProtocolIsReady(taskId int32, protocolText string) error
+	RefreshJobPayload(ctx context.Context, job rabbitmodels.Job) (json.RawMessage, error)
+	PushJob(ctx context.Context, job rabbitmodels.Job) error
+	WhenJobFailed(taskId int32, kind string) error
+}
+
+func New(
+	log *slog.Logger,
+	jobPool JobPool,
+	audioProcessor AudioProcessor,
+	leaseTimeout time.Duration,
+	maxWait time.Duration,
+	pollInterval time.Duration,
+	pushFallback time.Duration,
+	maxAttempts int,
+) *LeaseService {
+	return &LeaseService{
+		log:            log,
+		jobPool:        jobPool,
+		audioProcessor: audioProcessor,
+		leaseTimeout:   leaseTimeout,
+		maxWait:        maxWait,
+		pollInterval:   pollInterval,
+		pushFallback:   pushFallback,
+		maxAttempts:    maxAttempts,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// Run fails the jobs whose last lease expired and sends to RabbitMQ the
+// jobs that no pull worker leased within pushFallback (dispatch both, zero
+// pushFallback turns it off).
+func (s *LeaseService) Run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		s.failExpired()
+		if s.pushFallback > 0 {
+			s.pushUnleased()
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *LeaseService) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+func (s *LeaseService) failExpired() {
+	const op = "leaseservice.failExpired"
+
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	jobs, err := s.jobPool.FailExpiredJobs(context.Background(), s.maxAttempts)
+	if err != nil {
+		log.Error("Failed to fail expired jobs", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, job := range jobs {
+		s.fail(log, job)
+	}
+}
+
+// fail reports a job that ran out of attempts, its task is marked failed.
+func (s *LeaseService) fail(log *slog.Logger, job rabbitmodels.Job) {
+	log.Warn("Job ran out of attempts",
+		slog.Int64("job_id", job.Id),
+		slog.Int("task_id", int(job.TaskId)),
+		slog.String("kind", job.Kind),
+		slog.Int("attempts", job.Attempts),
+	)
+
+	if err := s.audioProcessor.WhenJobFailed(job.TaskId, job.Kind); err != nil {
+		log.Error("Failed to mark the task failed", slog.Int64("job_id", job.Id), slog.String("error", err.Error()))
+	}
+}
+
+func (s *LeaseService) pushUnleased() {
+	const op = "leaseservice.pushUnleased"
+
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	jobs, err := s.jobPool.ClaimUnleasedJobs(context.Background(), time.Now().Add(-s.pushFallback), pushBatch)
+	if err != nil {
+		log.Error("Failed to claim unleased jobs", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, job := range jobs {
+		if err := s.audioProcessor.PushJob(context.Background(), job); err != nil {
+			log.Error("Failed to push job", slog.Int64("job_id", job.Id), slog.String("error", err.Error()))
+			// задача возвращается в пул, попробуем на следующем проходе
+			if err := s.jobPool.ReturnPushedJob(context.Background(), job.Id); err != nil {
+				log.Error("Failed to return job to the pool", slog.Int64("job_id", job.Id), slog.String("error", err.Error()))
+			}
+			continue
+		}
+		log.Info("No pull worker took the job, pushed to RabbitMQ", slog.Int64("job_id", job.Id), slog.String("kind", job.Kind))
+	}
+}
+
+// LeaseTask long-polls the pool for up to wait (capped by maxWait).
+// Returns false if nothing showed up in time.
+func (s *LeaseService) LeaseTask(ctx context.Context, workerId string, kinds []string, wait time.Duration) (rabbitmodels.Job, bool, error) {
+	const op = "leaseservice.LeaseTask"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("worker_id", workerId),
+	)
+
+	for _, kind := range kinds {
+		if kind != rabbitmodels.JobKindTranscribe && kind != rabbitmodels.JobKindProtocol {
+			return rabbitmodels.Job{}, false, fmt.Errorf("%s: %w: %s", op, ErrUnknownJobKind, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		kinds = []string{rabbitmodels.JobKindTranscribe, rabbitmodels.JobKindProtocol}
+	}
+
+	if wait <= 0 || wait > s.maxWait {
+		wait = s.maxWait
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		leaseId, err := newLeaseId()
+		if err != nil {
+			return rabbitmodels.Job{}, false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		job, ok, err := s.jobPool.LeaseJob(ctx, kinds, workerId, leaseId, s.leaseTimeout, s.maxAttempts)
+		if err != nil && ctx.Err() == nil {
+			return rabbitmodels.Job{}, false, fmt.Errorf("%s: %w", op, err)
+		}
+		if ok {
+			// ссылки в payload могли истечь, пока задача ждала в пуле
+			payload, err := s.audioProcessor.RefreshJobPayload(context.Background(), job)
+			if err != nil {
+				log.Error("Failed to refresh job payload", slog.Int64("job_id", job.Id), slog.String("error", err.Error()))
+				if err := s.jobPool.ReleaseJob(context.Background(), job.Id, job.LeaseId); err != nil {
+					log.Error("Failed to release job", slog.Int64("job_id", job.Id), slog.String("error", err.Error()))
+				}
+				return rabbitmodels.Job{}, false, fmt.Errorf("%s: %w", op, err)
+			}
+			job.Payload = payload
+
+			log.Info("Job leased", slog.Int64("job_id", job.Id), slog.String("kind", job.Kind))
+			return job, true, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return rabbitmodels.Job{}, false, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *LeaseService) RenewLease(ctx context.Context, jobId int64, leaseId string) (time.Time, error) {
+	const op = "leaseservice.RenewLease"
+
+	expiresAt, err := s.jobPool.RenewLease(ctx, jobId, leaseId, s.leaseTimeout)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return expiresAt, nil
+}
+
+// LeasedJob returns the job while the lease is still held, e.g. to check a
+// progress report.
+func (s *LeaseService) LeasedJob(ctx context.Context, jobId int64, leaseId string) (rabbitmodels.Job, error) {
+	const op = "leaseservice.LeasedJob"
+
+	job, err := s.jobPool.GetLeasedJob(ctx, jobId, leaseId)
+	if err != nil {
+		return job, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return job, nil
+}
+
+// CompleteTask accepts the worker result while the lease is still held.
+// A failed job goes back to the pool for another worker until it runs out
+// of attempts.
+func (s *LeaseService) CompleteTask(ctx context.Context, jobId int64, leaseId string, success bool, result string) error {
+	const op = "leaseservice.CompleteTask"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("job_id", jobId),
+	)
+
+	job, err := s.jobPool.GetLeasedJob(ctx, jobId, leaseId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !success {
+		if job.Attempts >= s.maxAttempts {
+			if err := s.jobPool.FailJob(ctx, jobId, leaseId); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			s.fail(log, job)
+			return nil
+		}
+
+		log.Info("Worker failed the job, returning it to the pool", slog.Int("attempts", job.Attempts))
+		if err := s.jobPool.ReleaseJob(ctx, jobId, leaseId); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	switch job.Kind {
+	case rabbitmodels.JobKindTranscribe:
+		err = s.audioProcessor.WhenAudioTranscribed(job.TaskId, rabbitmodels.ParseTranscriptionResult(result))
+	case rabbitmodels.JobKindProtocol:
+		err = s.audioProcessor.WhenProtocolIsReady(job.TaskId, result)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownJobKind, job.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Job completed", slog.Int("task_id", int(job.TaskId)))
+
+	return nil
+}
+
+func newLeaseId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lease id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
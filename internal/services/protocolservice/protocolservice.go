@@ -0,0 +1,250 @@
+package protocolservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/diff"
+	"msu-logging-backend/internal/storage"
+	"time"
+)
+
+// maxProtocolSize ограничивает текст ревизии, который читается в память.
+const maxProtocolSize = 10 << 20
+
+// nlpSaveAttempts - сколько раз SaveNLP пересчитывает базу, если между
+// проверкой и записью кто-то сохранил ревизию
+const nlpSaveAttempts = 3
+
+// ProtocolService keeps every saved version of the short protocol. Each
+// revision is a separate object in MinIO, so the NLP original and earlier
+// edits are never overwritten.
+type ProtocolService struct {
+	log       *slog.Logger
+	minio     *minioapp.App
+	revisions RevisionStorage
+	indexer   ProtocolIndexer
+}
+
+type RevisionStorage interface {
+	AddProtocolRevision(ctx context.Context, revision rabbitmodels.ProtocolRevision, base int) (rabbitmodels.ProtocolRevision, error)
+	ListProtocolRevisions(ctx context.Context, taskId int32) ([]rabbitmodels.ProtocolRevision, error)
+	GetProtocolRevision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, error)
+}
+
+// ProtocolIndexer keeps the search index in step with the current revision.
+type ProtocolIndexer interface {
+	IndexProtocol(ctx context.Context, taskId int32, text string) error
+}
+
+// New creates the service. indexer is optional, nil turns search indexing off.
+func New(log *slog.Logger, minio *minioapp.App, revisions RevisionStorage, indexer ProtocolIndexer) *ProtocolService {
+	return &ProtocolService{
+		log:       log,
+		minio:     minio,
+		revisions: revisions,
+		indexer:   indexer,
+	}
+}
+
+// SaveNLP stores the protocol from the NLP worker as a new revision, once
+// per task: a redelivered result returns the existing NLP revision and
+// false. The revision is saved against the current one, so a duplicate that
+// races with the first delivery sees its revision on the next attempt.
+func (s *ProtocolService) SaveNLP(ctx context.Context, taskId int32, text string) (rabbitmodels.ProtocolRevision, bool, error) {
+	const op = "protocolservice.SaveNLP"
+
+	var err error
+	for attempt := 0; attempt < nlpSaveAttempts; attempt++ {
+		var revisions []rabbitmodels.ProtocolRevision
+		revisions, err = s.revisions.ListProtocolRevisions(ctx, taskId)
+		if err != nil {
+			return rabbitmodels.ProtocolRevision{}, false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		base := 0
+		for _, revision := range revisions {
+			if revision.Source == rabbitmodels.RevisionSourceNLP {
+				return revision, false, nil
+			}
+			base = max(base, revision.Number)
+		}
+
+		var revision rabbitmodels.ProtocolRevision
+		revision, err = s.save(ctx, rabbitmodels.ProtocolRevision{
+			TaskId: taskId,
+			Source: rabbitmodels.RevisionSourceNLP,
+		}, text, base)
+		if errors.Is(err, storage.ErrRevisionConflict) {
+			continue
+		}
+		if err != nil {
+			return revision, false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return revision, true, nil
+	}
+
+	return rabbitmodels.ProtocolRevision{}, false, fmt.Errorf("%s: %w", op, err)
+}
+
+// Edit saves a user's edit made on top of the base revision. If someone
+// saved another revision in between, storage.ErrRevisionConflict is returned
+// and nothing changes.
+func (s *ProtocolService) Edit(ctx context.Context, taskId int32, text string, author string, base int) (rabbitmodels.ProtocolRevision, error) {
+	return s.save(ctx, rabbitmodels.ProtocolRevision{
+		TaskId: taskId,
+		Source: rabbitmodels.RevisionSourceEdit,
+		Author: author,
+	}, text, base)
+}
+
+func (s *ProtocolService) save(ctx context.Context, revision rabbitmodels.ProtocolRevision, text string, base int) (rabbitmodels.ProtocolRevision, error) {
+	const op = "protocolservice.save"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("task_id", int(revision.TaskId)),
+	)
+
+	// номер ревизии известен только после вставки, поэтому объект именуется по времени
+	// устаревшую правку отбрасываем до загрузки, окончательно её проверяет хранилище
+	if base != rabbitmodels.AnyRevision {
+		current, err := s.revisions.GetProtocolRevision(ctx, revision.TaskId, 0)
+		if err != nil && !errors.Is(err, storage.ErrRevisionNotFound) {
+			return revision, fmt.Errorf("%s: %w", op, err)
+		}
+		if current.Number != base {
+			return revision, fmt.Errorf("%s: %w", op, storage.ErrRevisionConflict)
+		}
+	}
+
+	objectName := fmt.Sprintf("protocol_%d_%d.txt", revision.TaskId, time.Now().UnixNano())
+
+	object, err := s.minio.PutObject(ctx, objectName, []byte(text), "text/plain; charset=utf-8")
+	if err != nil {
+		log.Error("Minio upload error", slog.String("error", err.Error()))
+		return revision, fmt.Errorf("%s: Minio upload error: %w", op, err)
+	}
+	revision.Object = object
+
+	revision, err = s.revisions.AddProtocolRevision(ctx, revision, base)
+	if errors.Is(err, storage.ErrRevisionConflict) {
+		// объект уже загружен, но ни одна ревизия на него не ссылается
+		if err := s.minio.RemoveObject(ctx, object); err != nil {
+			log.Warn("Failed to remove orphan protocol object", slog.String("error", err.Error()))
+		}
+		return revision, fmt.Errorf("%s: %w", op, err)
+	}
+	if err != nil {
+		log.Error("MySQL save error", slog.String("error", err.Error()))
+		return revision, fmt.Errorf("%s: MySQL save error: %w", op, err)
+	}
+
+	log.Info("Protocol revision saved",
+		slog.Int("revision", revision.Number),
+		slog.String("source", revision.Source),
+		slog.String("author", revision.Author),
+	)
+
+	// ревизия уже сохранена, без индекса её просто не найдёт поиск
+	if s.indexer != nil {
+		if err := s.indexer.IndexProtocol(ctx, revision.TaskId, text); err != nil {
+			log.Error("Failed to index protocol", slog.String("error", err.Error()))
+		}
+	}
+
+	return revision, nil
+}
+
+func (s *ProtocolService) Revisions(ctx context.Context, taskId int32) ([]rabbitmodels.ProtocolRevision, error) {
+	const op = "protocolservice.Revisions"
+
+	revisions, err := s.revisions.ListProtocolRevisions(ctx, taskId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revisions, nil
+}
+
+// Revision returns the revision and its text, number 0 is the current revision.
+func (s *ProtocolService) Revision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, string, error) {
+	const op = "protocolservice.Revision"
+
+	revision, err := s.revisions.GetProtocolRevision(ctx, taskId, number)
+	if err != nil {
+		return revision, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	text, err := s.read(ctx, revision.Object)
+	if err != nil {
+		return revision, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revision, text, nil
+}
+
+// Diff compares two revisions line by line, to 0 is the current revision.
+func (s *ProtocolService) Diff(ctx context.Context, taskId int32, from int, to int) ([]diff.Line, error) {
+	const op = "protocolservice.Diff"
+
+	_, oldText, err := s.Revision(ctx, taskId, from)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, newText, err := s.Revision(ctx, taskId, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	lines, err := diff.Lines(oldText, newText)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return lines, nil
+}
+
+// Revert saves the text of an earlier revision as the new current one,
+// history is kept. The base is checked the same way as in Edit.
+func (s *ProtocolService) Revert(ctx context.Context, taskId int32, number int, author string, base int) (rabbitmodels.ProtocolRevision, error) {
+	const op = "protocolservice.Revert"
+
+	_, text, err := s.Revision(ctx, taskId, number)
+	if err != nil {
+		return rabbitmodels.ProtocolRevision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revision, err := s.save(ctx, rabbitmodels.ProtocolRevision{
+		TaskId:       taskId,
+		Source:       rabbitmodels.RevisionSourceRevert,
+		Author:       author,
+		RevertedFrom: number,
+	}, text, base)
+	if err != nil {
+		return revision, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revision, nil
+}
+
+func (s *ProtocolService) read(ctx context.Context, object rabbitmodels.ObjectRef) (string, error) {
+	reader, _, err := s.minio.OpenObject(ctx, object)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxProtocolSize))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
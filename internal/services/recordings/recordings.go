@@ -0,0 +1,218 @@
+package recordings
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTaskBusy        = errors.New("source of the task already has an active recording")
+	ErrTooManySessions = errors.New("too many active recordings")
+	ErrTooManySources  = errors.New("too many sources record the task")
+	ErrMaxBytes        = errors.New("recording is too large")
+	ErrMaxDuration     = errors.New("recording is too long")
+	ErrNotOpen         = errors.New("recording has no writer")
+)
+
+// Writer is where the recording goes, Target names it for the admin view.
+type Writer interface {
+	io.Writer
+	Target() string
+}
+
+type Limits struct {
+	MaxSessions int
+	// MaxSources - сколько устройств одновременно пишут одну задачу
+	MaxSources  int
+	MaxDuration time.Duration
+	MaxBytes    int64
+}
+
+// Manager keeps active recordings, at most one per task source. Safe for concurrent use.
+type Manager struct {
+	limits Limits
+
+	mu     sync.Mutex
+	active map[key]*Recording
+}
+
+type key struct {
+	taskId int32
+	source string
+}
+
+// Recording is the file of one task that is being written right now.
+type Recording struct {
+	TaskId int32
+	Source string
+
+	manager   *Manager
+	mu        sync.Mutex
+	writer    Writer
+	startedAt time.Time
+	bytes     int64
+}
+
+// Info is a snapshot of an active recording for the admin view.
+type Info struct {
+	TaskId          int32     `json:"task_id"`
+	Source          string    `json:"source"`
+	Target          string    `json:"target"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Bytes           int64     `json:"bytes"`
+}
+
+func New(limits Limits) *Manager {
+	return &Manager{
+		limits: limits,
+		active: make(map[key]*Recording),
+	}
+}
+
+// Acquire reserves the task source for one session. The slot is freed by Release.
+func (m *Manager) Acquire(taskId int32, source string) (*Recording, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key{taskId: taskId, source: source}
+	if _, ok := m.active[k]; ok {
+		return nil, ErrTaskBusy
+	}
+	if m.limits.MaxSessions > 0 && len(m.active) >= m.limits.MaxSessions {
+		return nil, ErrTooManySessions
+	}
+	if m.limits.MaxSources > 0 && m.sourcesLocked(taskId) >= m.limits.MaxSources {
+		return nil, ErrTooManySources
+	}
+
+	r := &Recording{
+		TaskId:    taskId,
+		Source:    source,
+		manager:   m,
+		startedAt: time.Now(),
+	}
+	m.active[k] = r
+
+	return r, nil
+}
+
+// Release detaches the writer and frees the task source.
+func (m *Manager) Release(r *Recording) {
+	r.Detach()
+
+	k := key{taskId: r.TaskId, source: r.Source}
+
+	m.mu.Lock()
+	if m.active[k] == r {
+		delete(m.active, k)
+	}
+	m.mu.Unlock()
+}
+
+func (m *Manager) sourcesLocked(taskId int32) int {
+	count := 0
+	for k := range m.active {
+		if k.taskId == taskId {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *Manager) List() []Info {
+	m.mu.Lock()
+	recordings := make([]*Recording, 0, len(m.active))
+	for _, r := range m.active {
+		recordings = append(recordings, r)
+	}
+	m.mu.Unlock()
+
+	infos := make([]Info, 0, len(recordings))
+	for _, r := range recordings {
+		infos = append(infos, r.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.Before(infos[j].StartedAt)
+	})
+
+	return infos
+}
+
+// Attach makes w the destination of the recording. size is what w
+// already holds, startedAt is the start of the original recording after
+// a reconnect, the duration limit counts from it.
+func (r *Recording) Attach(w Writer, size int64, startedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writer = w
+	r.bytes = size
+	if !startedAt.IsZero() {
+		r.startedAt = startedAt
+	}
+}
+
+// Write appends data unless it would break the limits.
+func (r *Recording) Write(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writer == nil {
+		return ErrNotOpen
+	}
+
+	limits := r.manager.limits
+	if limits.MaxDuration > 0 && time.Since(r.startedAt) > limits.MaxDuration {
+		return ErrMaxDuration
+	}
+	if limits.MaxBytes > 0 && r.bytes+int64(len(data)) > limits.MaxBytes {
+		return ErrMaxBytes
+	}
+
+	n, err := r.writer.Write(data)
+	r.bytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+
+	return nil
+}
+
+// Detach stops writing, the writer is left to the caller.
+func (r *Recording) Detach() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writer = nil
+}
+
+func (r *Recording) StartedAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.startedAt
+}
+
+func (r *Recording) Info() Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	target := ""
+	if r.writer != nil {
+		target = r.writer.Target()
+	}
+
+	return Info{
+		TaskId:          r.TaskId,
+		Source:          r.Source,
+		Target:          target,
+		StartedAt:       r.startedAt,
+		DurationSeconds: time.Since(r.startedAt).Seconds(),
+		Bytes:           r.bytes,
+	}
+}
@@ -0,0 +1,239 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	minioapp "msu-logging-backend/internal/app/minio"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/fulltext"
+	"msu-logging-backend/internal/storage"
+	"sync/atomic"
+	"time"
+)
+
+var ErrReindexRunning = errors.New("reindex is already running")
+
+const (
+	// snippetLength - длина фрагмента в выдаче, в символах
+	snippetLength = 200
+	// reindexBatch - сколько задач берётся за один проход переиндексации
+	reindexBatch = 100
+	// maxProtocolSize - как в protocolservice, больше в память не читаем
+	maxProtocolSize = 10 << 20
+)
+
+// Service keeps the full-text index of transcripts and protocols, one
+// document per task and kind, and searches it. The index lives in MySQL
+// (FULLTEXT), documents are replaced whenever the text changes.
+type Service struct {
+	log        *slog.Logger
+	storage    SearchStorage
+	tasks      TaskSource
+	minio      *minioapp.App
+	reindexing atomic.Bool
+}
+
+type SearchStorage interface {
+	IndexDocument(ctx context.Context, document rabbitmodels.SearchDocument) error
+	SearchDocuments(ctx context.Context, filter rabbitmodels.SearchFilter) ([]rabbitmodels.SearchHit, error)
+}
+
+// TaskSource is where the texts are read from when the index is rebuilt.
+type TaskSource interface {
+	ListTasks(ctx context.Context, filter rabbitmodels.TaskFilter) ([]rabbitmodels.TaskSummary, error)
+	GetTranscription(ctx context.Context, taskId int32) (rabbitmodels.TranscriptionResult, error)
+	GetProtocol(ctx context.Context, id int32) (rabbitmodels.ObjectRef, rabbitmodels.ObjectRef, error)
+	GetProtocolRevision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, error)
+}
+
+func New(log *slog.Logger, storage SearchStorage, tasks TaskSource, minio *minioapp.App) *Service {
+	return &Service{
+		log:     log,
+		storage: storage,
+		tasks:   tasks,
+		minio:   minio,
+	}
+}
+
+// IndexTranscript indexes the text of a finished transcription.
+func (s *Service) IndexTranscript(ctx context.Context, taskId int32, result rabbitmodels.TranscriptionResult) error {
+	const op = "search.IndexTranscript"
+
+	if err := s.index(ctx, taskId, rabbitmodels.SearchKindTranscript, result.FullText()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// IndexProtocol indexes the text of the current protocol revision.
+func (s *Service) IndexProtocol(ctx context.Context, taskId int32, text string) error {
+	const op = "search.IndexProtocol"
+
+	if err := s.index(ctx, taskId, rabbitmodels.SearchKindProtocol, text); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Service) index(ctx context.Context, taskId int32, kind string, text string) error {
+	return s.storage.IndexDocument(ctx, rabbitmodels.SearchDocument{
+		TaskId:    taskId,
+		Kind:      kind,
+		Body:      text,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// Search finds documents by a user query (see fulltext.Parse) and cuts a
+// highlighted snippet around the first match of each. Returns
+// fulltext.ErrEmptyQuery if the query has nothing to search for.
+func (s *Service) Search(ctx context.Context, query string, filter rabbitmodels.SearchFilter) ([]rabbitmodels.SearchHit, error) {
+	const op = "search.Search"
+
+	terms, err := fulltext.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	filter.Match = fulltext.BooleanQuery(terms)
+
+	hits, err := s.storage.SearchDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range hits {
+		snippet := fulltext.MakeSnippet(hits[i].Body, terms, snippetLength)
+		hits[i].Snippet = snippet.Text
+		hits[i].Highlighted = snippet.Highlighted
+		hits[i].Highlights = snippet.Highlights
+		// весь текст в ответ не отдаём
+		hits[i].Body = ""
+	}
+
+	return hits, nil
+}
+
+// StartReindex rebuilds the index in the background, e.g. for tasks
+// finished before the index existed. Only one rebuild runs at a time.
+func (s *Service) StartReindex() error {
+	if !s.reindexing.CompareAndSwap(false, true) {
+		return ErrReindexRunning
+	}
+
+	go func() {
+		defer s.reindexing.Store(false)
+		s.Reindex(context.Background())
+	}()
+
+	return nil
+}
+
+// Reindex indexes the transcript and the current protocol of every task.
+// A task that fails is logged and skipped. Returns the number of indexed
+// documents.
+func (s *Service) Reindex(ctx context.Context) int {
+	const op = "search.Reindex"
+
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	log.Info("Reindex started")
+
+	indexed := 0
+	var afterId int32
+	for {
+		tasks, err := s.tasks.ListTasks(ctx, rabbitmodels.TaskFilter{AfterId: afterId, Ascending: true, Limit: reindexBatch})
+		if err != nil {
+			log.Error("Failed to list tasks", slog.String("error", err.Error()))
+			return indexed
+		}
+
+		for _, task := range tasks {
+			indexed += s.reindexTask(ctx, log, task.Id)
+		}
+
+		if len(tasks) < reindexBatch {
+			break
+		}
+		afterId = tasks[len(tasks)-1].Id
+	}
+
+	log.Info("Reindex finished", slog.Int("documents", indexed))
+
+	return indexed
+}
+
+func (s *Service) reindexTask(ctx context.Context, log *slog.Logger, taskId int32) int {
+	log = log.With(slog.Int("task_id", int(taskId)))
+	indexed := 0
+
+	transcript, err := s.transcript(ctx, taskId)
+	if err != nil {
+		log.Error("Failed to get transcription", slog.String("error", err.Error()))
+	} else if transcript.FullText() != "" {
+		if err := s.IndexTranscript(ctx, taskId, transcript); err != nil {
+			log.Error("Failed to index transcript", slog.String("error", err.Error()))
+		} else {
+			indexed++
+		}
+	}
+
+	revision, err := s.tasks.GetProtocolRevision(ctx, taskId, 0)
+	if errors.Is(err, storage.ErrRevisionNotFound) {
+		return indexed
+	}
+	if err != nil {
+		log.Error("Failed to get protocol revision", slog.String("error", err.Error()))
+		return indexed
+	}
+
+	text, err := s.read(ctx, revision.Object)
+	if err != nil {
+		log.Error("Failed to read protocol", slog.String("error", err.Error()))
+		return indexed
+	}
+	if err := s.IndexProtocol(ctx, taskId, text); err != nil {
+		log.Error("Failed to index protocol", slog.String("error", err.Error()))
+		return indexed
+	}
+
+	return indexed + 1
+}
+
+// transcript returns the stored segments, for tasks transcribed before
+// segments were kept - the plain text from MinIO.
+func (s *Service) transcript(ctx context.Context, taskId int32) (rabbitmodels.TranscriptionResult, error) {
+	result, err := s.tasks.GetTranscription(ctx, taskId)
+	if err != nil || len(result.Segments) > 0 {
+		return result, err
+	}
+
+	_, fullText, err := s.tasks.GetProtocol(ctx, taskId)
+	if err != nil || fullText.IsZero() {
+		return result, err
+	}
+
+	result.Text, err = s.read(ctx, fullText)
+	return result, err
+}
+
+func (s *Service) read(ctx context.Context, object rabbitmodels.ObjectRef) (string, error) {
+	reader, _, err := s.minio.OpenObject(ctx, object)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxProtocolSize))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
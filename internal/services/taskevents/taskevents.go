@@ -0,0 +1,185 @@
+package taskevents
+
+import (
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"sync"
+	"time"
+)
+
+const (
+	EventStatus        = "status"
+	EventProgress      = "progress"
+	EventProtocolReady = "protocol_ready"
+	// EventSnapshot - текущее состояние задачи, когда пропущенные события уже не хранятся
+	EventSnapshot = "snapshot"
+)
+
+type Event struct {
+	Id            int64                      `json:"id"`
+	Type          string                     `json:"type"`
+	TaskId        int32                      `json:"task_id"`
+	Status        string                     `json:"status,omitempty"`
+	Progress      *rabbitmodels.TaskProgress `json:"progress,omitempty"`
+	ShortProtocol string                     `json:"short_protocol,omitempty"`
+	FullProtocol  string                     `json:"full_protocol,omitempty"`
+	Time          time.Time                  `json:"time"`
+}
+
+// Broker is an in-process pub/sub of task events, keyed by task id. The last
+// events of every task are kept for a while, so a client that reconnects can
+// catch up.
+type Broker struct {
+	mu          sync.Mutex
+	nextId      int64
+	subscribers map[int32]map[chan Event]struct{}
+	history     map[int32]*history
+	// forgotten - последний id на момент, когда чья-то история была удалена целиком
+	forgotten int64
+	lastPrune time.Time
+}
+
+// history - последние события задачи, dropped - id последнего вытесненного
+type history struct {
+	events  []Event
+	dropped int64
+	updated time.Time
+}
+
+const (
+	subscriberBuffer = 16
+	historySize      = 64
+	historyTTL       = 10 * time.Minute
+)
+
+func New() *Broker {
+	return &Broker{
+		subscribers: make(map[int32]map[chan Event]struct{}),
+		history:     make(map[int32]*history),
+	}
+}
+
+// Subscribe returns a channel with events of the task and a function
+// that must be called to unsubscribe.
+func (b *Broker) Subscribe(taskId int32) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[taskId] == nil {
+		b.subscribers[taskId] = make(map[chan Event]struct{})
+	}
+	b.subscribers[taskId][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			// отставшего подписчика Publish уже закрыл
+			if _, ok := b.subscribers[taskId][ch]; ok {
+				b.drop(taskId, ch)
+			}
+		})
+	}
+}
+
+// Publish never blocks: a subscriber whose buffer is full is lagging, its
+// channel is closed instead of silently losing the event. The event is kept
+// in the history, so the client catches up after reconnecting with its
+// last id.
+func (b *Broker) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextId++
+	event.Id = b.nextId
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for ch := range b.subscribers[event.TaskId] {
+		select {
+		case ch <- event:
+		default:
+			b.drop(event.TaskId, ch)
+		}
+	}
+
+	b.remember(event)
+
+	return event
+}
+
+func (b *Broker) drop(taskId int32, ch chan Event) {
+	delete(b.subscribers[taskId], ch)
+	if len(b.subscribers[taskId]) == 0 {
+		delete(b.subscribers, taskId)
+	}
+	close(ch)
+}
+
+// LastId is the id of the latest published event of any task.
+func (b *Broker) LastId() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.nextId
+}
+
+// Since returns the kept events of the task with ids after lastId. complete
+// is false if some of them are no longer kept or lastId is unknown (e.g. it
+// was issued before a restart), then the caller has to send the current
+// state instead.
+func (b *Broker) Since(taskId int32, lastId int64) (events []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastId > b.nextId {
+		return nil, false
+	}
+
+	h := b.history[taskId]
+	if h == nil {
+		return nil, lastId >= b.forgotten
+	}
+	if lastId < h.dropped {
+		return nil, false
+	}
+
+	for _, event := range h.events {
+		if event.Id > lastId {
+			events = append(events, event)
+		}
+	}
+
+	return events, true
+}
+
+func (b *Broker) remember(event Event) {
+	h := b.history[event.TaskId]
+	if h == nil {
+		// более ранние события задачи, если были, удалены вместе со старой историей
+		h = &history{dropped: b.forgotten}
+		b.history[event.TaskId] = h
+	}
+
+	h.events = append(h.events, event)
+	if len(h.events) > historySize {
+		h.dropped = h.events[0].Id
+		h.events = append(h.events[:0:0], h.events[1:]...)
+	}
+	h.updated = event.Time
+
+	if time.Since(b.lastPrune) < historyTTL/10 {
+		return
+	}
+	b.lastPrune = time.Now()
+
+	for taskId, h := range b.history {
+		if time.Since(h.updated) > historyTTL {
+			delete(b.history, taskId)
+			b.forgotten = b.nextId
+		}
+	}
+}
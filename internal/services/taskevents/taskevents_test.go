@@ -0,0 +1,50 @@
+package taskevents
+
+import "testing"
+
+func TestPublishClosesLaggingSubscriber(t *testing.T) {
+	b := New()
+	events, unsubscribe := b.Subscribe(1)
+	other, unsubscribeOther := b.Subscribe(2)
+	defer unsubscribeOther()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Publish(Event{Type: EventStatus, TaskId: 1})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before close, want %d", received, subscriberBuffer)
+	}
+
+	// событие, на котором подписчик отстал, есть в истории
+	missed, complete := b.Since(1, int64(received))
+	if !complete || len(missed) != 1 || missed[0].Id != subscriberBuffer+1 {
+		t.Errorf("Since = %+v, %v, want the last event", missed, complete)
+	}
+
+	// отписка после закрытия не паникует
+	unsubscribe()
+
+	b.Publish(Event{Type: EventStatus, TaskId: 2})
+	if event := <-other; event.TaskId != 2 {
+		t.Errorf("other subscriber got %+v", event)
+	}
+}
+
+func TestUnsubscribeClosesChannel(t *testing.T) {
+	b := New()
+	events, unsubscribe := b.Subscribe(1)
+
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Error("channel is open after unsubscribe")
+	}
+	// публикация без подписчиков не блокируется
+	b.Publish(Event{Type: EventStatus, TaskId: 1})
+}
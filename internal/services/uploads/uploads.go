@@ -0,0 +1,418 @@
+package uploads
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/lib/audio"
+	"msu-logging-backend/internal/storage"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidSource  = errors.New("source must be 1-32 letters, digits, '-' or '_'")
+	ErrInvalidLength  = errors.New("upload length must be positive")
+	ErrTooLarge       = errors.New("upload is larger than allowed")
+	ErrOffsetMismatch = errors.New("offset does not match the upload")
+	ErrExceedsLength  = errors.New("data exceeds the upload length")
+	ErrNotUploading   = errors.New("upload is already complete")
+)
+
+// cleanupInterval - как часто при создании загрузки ищутся брошенные.
+const cleanupInterval = time.Hour
+
+// Service keeps resumable uploads. Data is appended to a file in dir and the
+// offset is stored in MySQL after every chunk, so an upload survives broken
+// connections and restarts. When the last byte arrives the file is handed to
+// the track finisher exactly once, if it passes the limits.
+type Service struct {
+	log      *slog.Logger
+	storage  UploadStorage
+	finisher TrackFinisher
+	dir      string
+	limits   audio.Limits
+	expiry   time.Duration
+
+	mu          sync.Mutex
+	locks       map[string]*uploadLock
+	lastCleanup time.Time
+}
+
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+type UploadStorage interface {
+	CreateUpload(ctx context.Context, upload rabbitmodels.Upload) error
+	GetUpload(ctx context.Context, id string) (rabbitmodels.Upload, error)
+	UpdateUploadOffset(ctx context.Context, id string, from int64, to int64) error
+	SetUploadState(ctx context.Context, id string, from string, to string) error
+	DeleteUpload(ctx context.Context, id string) error
+	ListStaleUploads(ctx context.Context, before time.Time) ([]rabbitmodels.Upload, error)
+}
+
+type TrackFinisher interface {
+	FinishTrack(taskId int32, source string, filename string, metadata rabbitmodels.TrackMetadata) error
+}
+
+func New(log *slog.Logger, storage UploadStorage, finisher TrackFinisher, dir string, limits audio.Limits, expiry time.Duration) *Service {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	return &Service{
+		log:      log,
+		storage:  storage,
+		finisher: finisher,
+		dir:      dir,
+		limits:   limits,
+		expiry:   expiry,
+		locks:    make(map[string]*uploadLock),
+	}
+}
+
+func (s *Service) MaxSize() int64 {
+	return s.limits.MaxSize
+}
+
+// Create starts an upload of length bytes for the task's source.
+func (s *Service) Create(ctx context.Context, taskId int32, source string, filename string, contentType string, length int64) (rabbitmodels.Upload, error) {
+	const op = "uploads.Create"
+
+	if source == "" {
+		source = rabbitmodels.DefaultTrackSource
+	}
+	if !rabbitmodels.ValidTrackSource(source) {
+		return rabbitmodels.Upload{}, ErrInvalidSource
+	}
+	if length <= 0 {
+		return rabbitmodels.Upload{}, ErrInvalidLength
+	}
+	if s.limits.CheckSize(length) != nil {
+		return rabbitmodels.Upload{}, ErrTooLarge
+	}
+	// заявленный тип - только подсказка, файл всё равно проверяется по содержимому в finish
+	if contentType != "" {
+		if err := s.limits.CheckType(contentType); err != nil {
+			return rabbitmodels.Upload{}, err
+		}
+	}
+
+	s.cleanup(ctx)
+
+	id, err := newId()
+	if err != nil {
+		return rabbitmodels.Upload{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// имя файла от клиента идёт только в метку дорожки, путь отбрасываем
+	filename = audio.SanitizeFilename(filename)
+
+	now := time.Now().Truncate(time.Second)
+	upload := rabbitmodels.Upload{
+		Id:          id,
+		TaskId:      taskId,
+		Source:      source,
+		Filename:    filename,
+		ContentType: contentType,
+		Length:      length,
+		State:       rabbitmodels.UploadStateUploading,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	file, err := os.Create(s.path(id))
+	if err != nil {
+		return upload, fmt.Errorf("%s: file creation error: %w", op, err)
+	}
+	file.Close()
+
+	if err := s.storage.CreateUpload(ctx, upload); err != nil {
+		os.Remove(s.path(id))
+		return upload, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("Upload created",
+		slog.String("upload_id", id),
+		slog.Int("task_id", int(taskId)),
+		slog.String("source", source),
+		slog.Int64("length", length),
+	)
+
+	return upload, nil
+}
+
+// Get returns the task's upload. Uploads of other tasks are not found.
+func (s *Service) Get(ctx context.Context, taskId int32, id string) (rabbitmodels.Upload, error) {
+	const op = "uploads.Get"
+
+	upload, err := s.storage.GetUpload(ctx, id)
+	if err != nil {
+		return upload, fmt.Errorf("%s: %w", op, err)
+	}
+	if upload.TaskId != taskId {
+		return rabbitmodels.Upload{}, fmt.Errorf("%s: %w", op, storage.ErrUploadNotFound)
+	}
+
+	return upload, nil
+}
+
+// Append writes data at offset, which must be the current offset of the
+// upload. Whatever was received before the body broke off is kept, the
+// client continues from the returned offset.
+func (s *Service) Append(ctx context.Context, taskId int32, id string, offset int64, data io.Reader) (rabbitmodels.Upload, error) {
+	const op = "uploads.Append"
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	upload, err := s.Get(ctx, taskId, id)
+	if err != nil {
+		return upload, fmt.Errorf("%s: %w", op, err)
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+	switch upload.State {
+	case rabbitmodels.UploadStateUploading:
+	case rabbitmodels.UploadStateProcessing, rabbitmodels.UploadStateFinished:
+		// повтор последнего запроса, ответ на который потерялся
+		if offset == upload.Length && isEmpty(data) {
+			return upload, nil
+		}
+		return upload, ErrNotUploading
+	default:
+		return upload, ErrNotUploading
+	}
+
+	if upload.Offset < upload.Length {
+		written, err := s.write(upload, data)
+		if written > 0 {
+			if err := s.storage.UpdateUploadOffset(ctx, id, upload.Offset, upload.Offset+written); err != nil {
+				return upload, fmt.Errorf("%s: %w", op, err)
+			}
+			upload.Offset += written
+		}
+		if err != nil {
+			return upload, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// завершение повторяется, если прошлая попытка обработки сорвалась
+	if upload.Offset == upload.Length {
+		if err := s.finish(ctx, &upload); err != nil {
+			return upload, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return upload, nil
+}
+
+// Terminate drops an unfinished upload and its data.
+func (s *Service) Terminate(ctx context.Context, taskId int32, id string) error {
+	const op = "uploads.Terminate"
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	upload, err := s.Get(ctx, taskId, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if upload.State != rabbitmodels.UploadStateUploading {
+		return ErrNotUploading
+	}
+
+	if err := s.storage.DeleteUpload(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	os.Remove(s.path(id))
+
+	s.log.Info("Upload terminated", slog.String("upload_id", id), slog.Int("task_id", int(taskId)))
+
+	return nil
+}
+
+// write appends the body to the file. The file is cut to the stored offset
+// first: bytes after it were written by a request whose offset was never saved.
+func (s *Service) write(upload rabbitmodels.Upload, data io.Reader) (int64, error) {
+	file, err := os.OpenFile(s.path(upload.Id), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, fmt.Errorf("open upload file: %w", err)
+	}
+	defer file.Close()
+
+	if err := file.Truncate(upload.Offset); err != nil {
+		return 0, fmt.Errorf("truncate upload file: %w", err)
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek upload file: %w", err)
+	}
+
+	remaining := upload.Length - upload.Offset
+	written, copyErr := io.Copy(file, io.LimitReader(data, remaining))
+
+	// offset сохраняем только для данных, которые точно на диске
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("sync upload file: %w", err)
+	}
+
+	if copyErr != nil {
+		return written, fmt.Errorf("receive data: %w", copyErr)
+	}
+	if written == remaining && !isEmpty(data) {
+		return written, ErrExceedsLength
+	}
+
+	return written, nil
+}
+
+// finish hands the complete file to processing. The state change is the
+// guard: only the request that moves the upload to processing continues.
+func (s *Service) finish(ctx context.Context, upload *rabbitmodels.Upload) error {
+	log := s.log.With(
+		slog.String("upload_id", upload.Id),
+		slog.Int("task_id", int(upload.TaskId)),
+		slog.String("source", upload.Source),
+	)
+
+	err := s.storage.SetUploadState(ctx, upload.Id, rabbitmodels.UploadStateUploading, rabbitmodels.UploadStateProcessing)
+	if errors.Is(err, storage.ErrUploadConflict) {
+		return ErrNotUploading
+	}
+	if err != nil {
+		return err
+	}
+	upload.State = rabbitmodels.UploadStateProcessing
+
+	info, err := audio.ProbeFile(s.path(upload.Id))
+	if err != nil {
+		s.setState(log, upload, rabbitmodels.UploadStateUploading)
+		return err
+	}
+	if err := s.limits.Check(info); err != nil {
+		// файл не годится целиком, докачка не поможет
+		log.Warn("Upload rejected", slog.String("error", err.Error()))
+		s.setState(log, upload, rabbitmodels.UploadStateFailed)
+		os.Remove(s.path(upload.Id))
+		return err
+	}
+
+	// имя файла становится именем объекта в MinIO, как у остальных дорожек
+	_, ext := audio.DetectFile(s.path(upload.Id), upload.ContentType)
+	filename := filepath.Join(s.dir, fmt.Sprintf("audio_%v_%s_%s%s", upload.TaskId, upload.Source, upload.Id[:8], ext))
+	if err := os.Rename(s.path(upload.Id), filename); err != nil {
+		log.Error("Failed to rename upload", slog.String("error", err.Error()))
+		filename = s.path(upload.Id)
+	}
+
+	err = s.finisher.FinishTrack(upload.TaskId, upload.Source, filename, rabbitmodels.TrackMetadata{Label: upload.Filename})
+	if err != nil {
+		log.Error("Failed to process upload", slog.String("error", err.Error()))
+
+		// файл на месте - загрузка в MinIO не прошла, можно повторить
+		next := rabbitmodels.UploadStateFailed
+		if _, statErr := os.Stat(filename); statErr == nil && os.Rename(filename, s.path(upload.Id)) == nil {
+			next = rabbitmodels.UploadStateUploading
+		}
+		s.setState(log, upload, next)
+
+		return err
+	}
+
+	s.setState(log, upload, rabbitmodels.UploadStateFinished)
+
+	log.Info("Upload finished", slog.Int64("length", upload.Length), slog.Duration("duration", info.Duration))
+
+	return nil
+}
+
+// setState moves an upload out of processing.
+func (s *Service) setState(log *slog.Logger, upload *rabbitmodels.Upload, state string) {
+	err := s.storage.SetUploadState(context.Background(), upload.Id, rabbitmodels.UploadStateProcessing, state)
+	if err != nil {
+		log.Error("Failed to update upload state", slog.String("error", err.Error()))
+	}
+	upload.State = state
+}
+
+// cleanup removes uploads that got no data for longer than expiry. It runs
+// at most once per cleanupInterval, piggybacking on Create.
+func (s *Service) cleanup(ctx context.Context) {
+	if s.expiry <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	if time.Since(s.lastCleanup) < cleanupInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCleanup = time.Now()
+	s.mu.Unlock()
+
+	stale, err := s.storage.ListStaleUploads(ctx, time.Now().Add(-s.expiry))
+	if err != nil {
+		s.log.Error("Failed to list stale uploads", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, upload := range stale {
+		if err := s.storage.SetUploadState(ctx, upload.Id, rabbitmodels.UploadStateUploading, rabbitmodels.UploadStateFailed); err != nil {
+			continue
+		}
+		os.Remove(s.path(upload.Id))
+		s.log.Info("Stale upload removed", slog.String("upload_id", upload.Id), slog.Int("task_id", int(upload.TaskId)))
+	}
+}
+
+// lock serialises requests to one upload within the process.
+func (s *Service) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Service) path(id string) string {
+	return filepath.Join(s.dir, "upload_"+id+".part")
+}
+
+func isEmpty(data io.Reader) bool {
+	var probe [1]byte
+	n, _ := data.Read(probe[:])
+	return n == 0
+}
+
+func newId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
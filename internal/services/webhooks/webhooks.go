@@ -0,0 +1,588 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/services/taskevents"
+	"msu-logging-backend/internal/storage"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL   = errors.New("url must be an absolute http or https URL")
+	ErrUnknownEvent = errors.New("unknown event type")
+	// ErrForbiddenAddress - адрес вебхука указывает во внутреннюю сеть
+	ErrForbiddenAddress = errors.New("webhook address must be public")
+)
+
+// Events - типы событий, которые уходят в вебхуки. progress слишком частый.
+var Events = []string{taskevents.EventStatus, taskevents.EventProtocolReady}
+
+const (
+	// dueBatch - сколько доставок берётся за один проход
+	dueBatch = 50
+	// concurrency - одновременных запросов, чтобы один медленный адрес не держал остальные
+	concurrency = 4
+	// maxErrorLength - столько текста ошибки попадает в журнал доставок
+	maxErrorLength = 1000
+	// responseLimit - сколько тела ответа читаем, чтобы соединение переиспользовалось
+	responseLimit = 64 << 10
+)
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event         string    `json:"event"`
+	TaskId        int32     `json:"task_id"`
+	Status        string    `json:"status,omitempty"`
+	ShortProtocol string    `json:"short_protocol,omitempty"`
+	FullProtocol  string    `json:"full_protocol,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// Service keeps webhook subscriptions and delivers task events to them.
+// Every event is stored as a delivery first, so it survives a restart and
+// is retried with exponential backoff until it is accepted or runs out of
+// attempts.
+type Service struct {
+	log          *slog.Logger
+	storage      WebhookStorage
+	client       *http.Client
+	maxAttempts  int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	pollInterval time.Duration
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type WebhookStorage interface {
+	CreateWebhook(ctx context.Context, webhook rabbitmodels.Webhook) (int64, error)
+	GetWebhook(ctx context.Context, id int64) (rabbitmodels.Webhook, error)
+	ListWebhooks(ctx context.Context, taskId int32) ([]rabbitmodels.Webhook, error)
+	ListTaskWebhooks(ctx context.Context, taskId int32) ([]rabbitmodels.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	CreateWebhookDelivery(ctx context.Context, delivery rabbitmodels.WebhookDelivery) (int64, error)
+	GetWebhookDelivery(ctx context.Context, id int64) (rabbitmodels.WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, webhookId int64, limit int) ([]rabbitmodels.WebhookDelivery, error)
+	ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]rabbitmodels.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery rabbitmodels.WebhookDelivery) error
+}
+
+func New(
+	log *slog.Logger,
+	storage WebhookStorage,
+	maxAttempts int,
+	backoff time.Duration,
+	maxBackoff time.Duration,
+	timeout time.Duration,
+	pollInterval time.Duration,
+) *Service {
+	return &Service{
+		log:          log,
+		storage:      storage,
+		client:       newClient(timeout),
+		maxAttempts:  max(maxAttempts, 1),
+		backoff:      backoff,
+		maxBackoff:   maxBackoff,
+		pollInterval: pollInterval,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Notify queues the event for every webhook of its task. Errors are only
+// logged: a task must not fail because of a subscriber.
+func (s *Service) Notify(event taskevents.Event) {
+	const op = "webhooks.Notify"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("task_id", int(event.TaskId)),
+		slog.String("event", event.Type),
+	)
+
+	webhooks, err := s.storage.ListTaskWebhooks(context.Background(), event.TaskId)
+	if err != nil {
+		log.Error("Failed to list webhooks", slog.String("error", err.Error()))
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(Payload{
+		Event:         event.Type,
+		TaskId:        event.TaskId,
+		Status:        event.Status,
+		ShortProtocol: event.ShortProtocol,
+		FullProtocol:  event.FullProtocol,
+		Time:          event.Time,
+	})
+	if err != nil {
+		log.Error("Failed to encode payload", slog.String("error", err.Error()))
+		return
+	}
+
+	now := time.Now().Truncate(time.Second)
+	queued := false
+	for _, webhook := range webhooks {
+		if !webhook.Wants(event.Type) {
+			continue
+		}
+
+		_, err := s.storage.CreateWebhookDelivery(context.Background(), rabbitmodels.WebhookDelivery{
+			WebhookId:     webhook.Id,
+			TaskId:        event.TaskId,
+			Event:         event.Type,
+			Payload:       payload,
+			State:         rabbitmodels.DeliveryStatePending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+		if err != nil {
+			log.Error("Failed to queue delivery", slog.Int64("webhook_id", webhook.Id), slog.String("error", err.Error()))
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		s.poke()
+	}
+}
+
+// Create subscribes url to events of the task, taskId 0 - of every task.
+// The secret is returned only here.
+func (s *Service) Create(ctx context.Context, taskId int32, rawURL string, events []string) (rabbitmodels.Webhook, error) {
+	const op = "webhooks.Create"
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return rabbitmodels.Webhook{}, ErrInvalidURL
+	}
+	if err := checkHost(ctx, parsed.Hostname()); err != nil {
+		return rabbitmodels.Webhook{}, err
+	}
+	for _, event := range events {
+		if !known(event) {
+			return rabbitmodels.Webhook{}, fmt.Errorf("%w: %s", ErrUnknownEvent, event)
+		}
+	}
+	if events == nil {
+		events = []string{}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return rabbitmodels.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	webhook := rabbitmodels.Webhook{
+		TaskId:    taskId,
+		URL:       parsed.String(),
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+
+	webhook.Id, err = s.storage.CreateWebhook(ctx, webhook)
+	if err != nil {
+		return webhook, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("Webhook created",
+		slog.Int64("webhook_id", webhook.Id),
+		slog.Int("task_id", int(taskId)),
+		slog.String("url", webhook.URL),
+	)
+
+	return webhook, nil
+}
+
+// List returns the webhooks of the task without secrets.
+func (s *Service) List(ctx context.Context, taskId int32) ([]rabbitmodels.Webhook, error) {
+	const op = "webhooks.List"
+
+	webhooks, err := s.storage.ListWebhooks(ctx, taskId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+// Get returns the webhook if it belongs to the task. Someone else's webhook
+// looks the same as a missing one.
+func (s *Service) Get(ctx context.Context, taskId int32, id int64) (rabbitmodels.Webhook, error) {
+	const op = "webhooks.Get"
+
+	webhook, err := s.storage.GetWebhook(ctx, id)
+	if err != nil {
+		return webhook, fmt.Errorf("%s: %w", op, err)
+	}
+	if webhook.TaskId != taskId {
+		return rabbitmodels.Webhook{}, fmt.Errorf("%s: %w", op, storage.ErrWebhookNotFound)
+	}
+	webhook.Secret = ""
+
+	return webhook, nil
+}
+
+func (s *Service) Delete(ctx context.Context, taskId int32, id int64) error {
+	const op = "webhooks.Delete"
+
+	if _, err := s.Get(ctx, taskId, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.storage.DeleteWebhook(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Deliveries returns the delivery log of the webhook, newest first.
+func (s *Service) Deliveries(ctx context.Context, taskId int32, webhookId int64, limit int) ([]rabbitmodels.WebhookDelivery, error) {
+	const op = "webhooks.Deliveries"
+
+	if _, err := s.Get(ctx, taskId, webhookId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deliveries, err := s.storage.ListWebhookDeliveries(ctx, webhookId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver queues the payload of a past delivery again as a new delivery,
+// the log of the old one is kept.
+func (s *Service) Redeliver(ctx context.Context, taskId int32, webhookId int64, deliveryId int64) (rabbitmodels.WebhookDelivery, error) {
+	const op = "webhooks.Redeliver"
+
+	if _, err := s.Get(ctx, taskId, webhookId); err != nil {
+		return rabbitmodels.WebhookDelivery{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	original, err := s.storage.GetWebhookDelivery(ctx, deliveryId)
+	if err != nil {
+		return original, fmt.Errorf("%s: %w", op, err)
+	}
+	if original.WebhookId != webhookId {
+		return rabbitmodels.WebhookDelivery{}, fmt.Errorf("%s: %w", op, storage.ErrDeliveryNotFound)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	delivery := rabbitmodels.WebhookDelivery{
+		WebhookId:     original.WebhookId,
+		TaskId:        original.TaskId,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		State:         rabbitmodels.DeliveryStatePending,
+		RedeliveryOf:  original.Id,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	delivery.Id, err = s.storage.CreateWebhookDelivery(ctx, delivery)
+	if err != nil {
+		return delivery, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.poke()
+
+	return delivery, nil
+}
+
+// Run delivers due deliveries until Stop is called.
+func (s *Service) Run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.deliverDue()
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// Stop waits for the attempts in flight to finish.
+func (s *Service) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+func (s *Service) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) deliverDue() {
+	const op = "webhooks.deliverDue"
+
+	for {
+		deliveries, err := s.storage.ListDueWebhookDeliveries(context.Background(), time.Now(), dueBatch)
+		if err != nil {
+			s.log.Error("Failed to list due deliveries", slog.String("op", op), slog.String("error", err.Error()))
+			return
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				s.attempt(delivery)
+			}()
+		}
+		wg.Wait()
+
+		// полный пакет - возможно, в очереди есть ещё
+		if len(deliveries) < dueBatch {
+			return
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// attempt sends the delivery once and stores the outcome.
+func (s *Service) attempt(delivery rabbitmodels.WebhookDelivery) {
+	log := s.log.With(
+		slog.Int64("delivery_id", delivery.Id),
+		slog.Int64("webhook_id", delivery.WebhookId),
+		slog.String("event", delivery.Event),
+	)
+
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.LastError = ""
+
+	webhook, err := s.storage.GetWebhook(context.Background(), delivery.WebhookId)
+	if errors.Is(err, storage.ErrWebhookNotFound) {
+		delivery.State = rabbitmodels.DeliveryStateFailed
+		delivery.LastError = "webhook was deleted"
+		s.save(log, delivery)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get webhook", slog.String("error", err.Error()))
+		return
+	}
+
+	status, err := s.send(webhook, delivery)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.State = rabbitmodels.DeliveryStateDelivered
+		s.save(log, delivery)
+		log.Info("Webhook delivered", slog.Int("attempts", delivery.Attempts))
+		return
+	}
+
+	delivery.LastError = truncate(err.Error(), maxErrorLength)
+	if delivery.Attempts >= s.maxAttempts {
+		delivery.State = rabbitmodels.DeliveryStateFailed
+		log.Warn("Webhook delivery failed", slog.Int("attempts", delivery.Attempts), slog.String("error", err.Error()))
+	} else {
+		delivery.NextAttemptAt = time.Now().Add(s.retryDelay(delivery.Attempts))
+		log.Info("Webhook delivery will be retried", slog.Int("attempts", delivery.Attempts),
+			slog.Time("next_attempt", delivery.NextAttemptAt), slog.String("error", err.Error()))
+	}
+	s.save(log, delivery)
+}
+
+// send posts the payload signed with the webhook secret. Only 2xx counts as delivered.
+func (s *Service) send(webhook rabbitmodels.Webhook, delivery rabbitmodels.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "msu-logging-backend-webhooks")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(webhook.Id, 10))
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, responseLimit))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Sign is the hex HMAC-SHA256 of "<timestamp>.<body>". Receivers compute the
+// same with their copy of the secret and compare it with X-Webhook-Signature.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay - backoff, 2*backoff, 4*backoff, ... не больше maxBackoff
+func (s *Service) retryDelay(attempts int) time.Duration {
+	delay := s.backoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if s.maxBackoff > 0 && delay >= s.maxBackoff {
+			return s.maxBackoff
+		}
+	}
+	return delay
+}
+
+func (s *Service) save(log *slog.Logger, delivery rabbitmodels.WebhookDelivery) {
+	delivery.UpdatedAt = time.Now()
+	if err := s.storage.UpdateWebhookDelivery(context.Background(), delivery); err != nil {
+		log.Error("Failed to save delivery", slog.String("error", err.Error()))
+	}
+}
+
+// newClient dials only public addresses. The check runs on the resolved
+// address right before connecting, so neither DNS rebinding nor a redirect
+// leads into the internal network. There is no proxy: it would hide the
+// real address from the check.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// checkHost resolves the host of a new webhook, every address must be public.
+func checkHost(ctx context.Context, host string) error {
+	const op = "webhooks.checkHost"
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !public(ip) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return fmt.Errorf("%w: host %s not found", ErrInvalidURL, host)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, addr := range addrs {
+		if !public(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, host, addr.IP)
+		}
+	}
+
+	return nil
+}
+
+// public - не loopback, не частная сеть, не link-local (169.254.169.254 - метаданные облака),
+// не 0.0.0.0 и не multicast
+func public(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
@@ -0,0 +1,303 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStorage держит вебхуки и доставки в памяти.
+type fakeStorage struct {
+	WebhookStorage
+
+	mu         sync.Mutex
+	webhooks   map[int64]rabbitmodels.Webhook
+	deliveries map[int64]rabbitmodels.WebhookDelivery
+	nextId     int64
+}
+
+func newFakeStorage(webhooks ...rabbitmodels.Webhook) *fakeStorage {
+	s := &fakeStorage{
+		webhooks:   make(map[int64]rabbitmodels.Webhook),
+		deliveries: make(map[int64]rabbitmodels.WebhookDelivery),
+		nextId:     100,
+	}
+	for _, webhook := range webhooks {
+		s.webhooks[webhook.Id] = webhook
+	}
+	return s
+}
+
+func (s *fakeStorage) CreateWebhook(_ context.Context, webhook rabbitmodels.Webhook) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextId++
+	webhook.Id = s.nextId
+	s.webhooks[webhook.Id] = webhook
+	return webhook.Id, nil
+}
+
+func (s *fakeStorage) GetWebhook(_ context.Context, id int64) (rabbitmodels.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return rabbitmodels.Webhook{}, storage.ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (s *fakeStorage) CreateWebhookDelivery(_ context.Context, delivery rabbitmodels.WebhookDelivery) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextId++
+	delivery.Id = s.nextId
+	s.deliveries[delivery.Id] = delivery
+	return delivery.Id, nil
+}
+
+func (s *fakeStorage) GetWebhookDelivery(_ context.Context, id int64) (rabbitmodels.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return rabbitmodels.WebhookDelivery{}, storage.ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+func (s *fakeStorage) UpdateWebhookDelivery(_ context.Context, delivery rabbitmodels.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[delivery.Id] = delivery
+	return nil
+}
+
+func newService(storage WebhookStorage) *Service {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return New(log, storage, 3, 30*time.Second, 5*time.Minute, 5*time.Second, time.Minute)
+}
+
+func TestSign(t *testing.T) {
+	// то же считает получатель: hmac.new(b"secret", b"1700000000." + body, sha256)
+	got := Sign("secret", "1700000000", []byte(`{"event":"status"}`))
+	want := "0b7fbe4d03705f0062618530b4d0458491a5b81d5fd8f1366200257ca42a3f28"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+	if Sign("other", "1700000000", []byte(`{"event":"status"}`)) == want {
+		t.Error("Sign() does not depend on the secret")
+	}
+	if Sign("secret", "1700000001", []byte(`{"event":"status"}`)) == want {
+		t.Error("Sign() does not depend on the timestamp")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		maxBackoff time.Duration
+		attempts   int
+		want       time.Duration
+	}{
+		{5 * time.Minute, 1, 30 * time.Second},
+		{5 * time.Minute, 2, time.Minute},
+		{5 * time.Minute, 4, 4 * time.Minute},
+		{5 * time.Minute, 5, 5 * time.Minute},
+		{5 * time.Minute, 60, 5 * time.Minute},
+		// без предела задержка только растёт
+		{0, 6, 16 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		s := &Service{backoff: 30 * time.Second, maxBackoff: tt.maxBackoff}
+		if got := s.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) with max %s = %s, want %s", tt.attempts, tt.maxBackoff, got, tt.want)
+		}
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		attempts  int
+		deleted   bool
+		wantState string
+		wantRetry bool
+	}{
+		{name: "delivered", status: http.StatusNoContent, wantState: rabbitmodels.DeliveryStateDelivered},
+		{name: "retried", status: http.StatusInternalServerError, attempts: 1, wantState: rabbitmodels.DeliveryStatePending, wantRetry: true},
+		// maxAttempts = 3, это третья попытка
+		{name: "out of attempts", status: http.StatusBadGateway, attempts: 2, wantState: rabbitmodels.DeliveryStateFailed},
+		{name: "webhook deleted", deleted: true, wantState: rabbitmodels.DeliveryStateFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				body, _ := io.ReadAll(r.Body)
+				signature := "sha256=" + Sign("secret", r.Header.Get("X-Webhook-Timestamp"), body)
+				if r.Header.Get("X-Webhook-Signature") != signature {
+					t.Errorf("signature = %s, want %s", r.Header.Get("X-Webhook-Signature"), signature)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			store := newFakeStorage()
+			if !tt.deleted {
+				store.webhooks[1] = rabbitmodels.Webhook{Id: 1, TaskId: 10, URL: server.URL, Secret: "secret"}
+			}
+			s := newService(store)
+			// тестовый сервер на loopback, обычный клиент его не пускает
+			s.client = server.Client()
+
+			delivery := rabbitmodels.WebhookDelivery{
+				Id:        7,
+				WebhookId: 1,
+				Event:     "status",
+				Payload:   []byte(`{"event":"status"}`),
+				State:     rabbitmodels.DeliveryStatePending,
+				Attempts:  tt.attempts,
+				LastError: "previous error",
+			}
+			store.deliveries[7] = delivery
+			s.attempt(delivery)
+
+			got := store.deliveries[7]
+			if got.State != tt.wantState {
+				t.Errorf("state = %s, want %s", got.State, tt.wantState)
+			}
+			if got.Attempts != tt.attempts+1 {
+				t.Errorf("attempts = %d, want %d", got.Attempts, tt.attempts+1)
+			}
+			if tt.deleted {
+				if requests != 0 || got.LastError != "webhook was deleted" {
+					t.Errorf("requests = %d, last error = %q", requests, got.LastError)
+				}
+				return
+			}
+			if got.ResponseStatus != tt.status {
+				t.Errorf("response status = %d, want %d", got.ResponseStatus, tt.status)
+			}
+			if (got.LastError == "") != (tt.wantState == rabbitmodels.DeliveryStateDelivered) {
+				t.Errorf("last error = %q", got.LastError)
+			}
+			if retry := got.NextAttemptAt.After(time.Now().Add(20 * time.Second)); retry != tt.wantRetry {
+				t.Errorf("next attempt = %s, retry %v, want %v", got.NextAttemptAt, retry, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestAttemptRejectsPrivateAddress(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	// адрес мог пройти проверку при создании и смениться в DNS потом
+	store := newFakeStorage(rabbitmodels.Webhook{Id: 1, TaskId: 10, URL: server.URL, Secret: "secret"})
+	s := newService(store)
+
+	delivery := rabbitmodels.WebhookDelivery{Id: 7, WebhookId: 1, Event: "status", Payload: []byte(`{}`), State: rabbitmodels.DeliveryStatePending}
+	store.deliveries[7] = delivery
+	s.attempt(delivery)
+
+	got := store.deliveries[7]
+	if requests != 0 {
+		t.Errorf("server got %d requests", requests)
+	}
+	if got.State != rabbitmodels.DeliveryStatePending || !strings.Contains(got.LastError, ErrForbiddenAddress.Error()) {
+		t.Errorf("state = %s, last error = %q", got.State, got.LastError)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{url: "https://93.184.216.34/hook"},
+		{url: "ftp://93.184.216.34/hook", wantErr: ErrInvalidURL},
+		{url: "http:///hook", wantErr: ErrInvalidURL},
+		{url: "http://127.0.0.1:8080/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://localhost/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://10.1.2.3/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://192.168.0.1/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: ErrForbiddenAddress},
+		{url: "http://0.0.0.0/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://[::1]/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://[fd00::1]/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://[fe80::1]/hook", wantErr: ErrForbiddenAddress},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: ErrForbiddenAddress},
+	}
+
+	for _, tt := range tests {
+		store := newFakeStorage()
+		webhook, err := newService(store).Create(context.Background(), 10, tt.url, nil)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Create(%s) error = %v, want %v", tt.url, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && (webhook.Id == 0 || webhook.Secret == "") {
+			t.Errorf("Create(%s) = %+v", tt.url, webhook)
+		}
+		if tt.wantErr != nil && len(store.webhooks) != 0 {
+			t.Errorf("Create(%s) stored the webhook", tt.url)
+		}
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	store := newFakeStorage(
+		rabbitmodels.Webhook{Id: 1, TaskId: 10},
+		rabbitmodels.Webhook{Id: 2, TaskId: 20},
+	)
+	store.deliveries[5] = rabbitmodels.WebhookDelivery{
+		Id:        5,
+		WebhookId: 2,
+		TaskId:    20,
+		Event:     "status",
+		Payload:   []byte(`{"event":"status"}`),
+		State:     rabbitmodels.DeliveryStateFailed,
+		Attempts:  8,
+	}
+	s := newService(store)
+
+	// доставка чужого вебхука выглядит как отсутствующая
+	if _, err := s.Redeliver(context.Background(), 10, 1, 5); !errors.Is(err, storage.ErrDeliveryNotFound) {
+		t.Errorf("Redeliver() of another webhook's delivery error = %v", err)
+	}
+	// вебхук чужой задачи
+	if _, err := s.Redeliver(context.Background(), 10, 2, 5); !errors.Is(err, storage.ErrWebhookNotFound) {
+		t.Errorf("Redeliver() of another task's webhook error = %v", err)
+	}
+	if len(store.deliveries) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(store.deliveries))
+	}
+
+	delivery, err := s.Redeliver(context.Background(), 20, 2, 5)
+	if err != nil {
+		t.Fatalf("Redeliver() error = %v", err)
+	}
+	if delivery.Id == 5 || delivery.RedeliveryOf != 5 || delivery.State != rabbitmodels.DeliveryStatePending ||
+		delivery.Attempts != 0 || string(delivery.Payload) != `{"event":"status"}` {
+		t.Errorf("Redeliver() = %+v", delivery)
+	}
+	if store.deliveries[5].State != rabbitmodels.DeliveryStateFailed {
+		t.Error("the original delivery was changed")
+	}
+}
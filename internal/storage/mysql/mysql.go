@@ -3,9 +3,13 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	rabbitmodels "msu-logging-backend/internal/domain/models"
+	"msu-logging-backend/internal/storage"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -15,6 +19,26 @@ type Storage struct {
 	db *sql.DB
 }
 
+// DSN собирается без parseTime, поэтому DATETIME передаём и читаем строками
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+func formatDateTime(t time.Time) string {
+	return t.Format(dateTimeLayout)
+}
+
+func parseDateTime(value sql.NullString) time.Time {
+	if !value.Valid {
+		return time.Time{}
+	}
+
+	t, err := time.ParseInLocation(dateTimeLayout, value.String, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
 func New() (*Storage, error) {
 	const op = "storage.mysql.New"
 
@@ -45,16 +69,16 @@ func New() (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
-func (s *Storage) SaveAudioFile(ctx context.Context, link string) (int64, error) {
+func (s *Storage) SaveAudioFile(ctx context.Context, object rabbitmodels.ObjectRef) (int64, error) {
 	const op = "storage.mysql.SaveAudioFile"
 
-	stmt, err := s.db.Prepare("INSERT INTO logging.audio_file (link, date_created) VALUES (?, ?)")
+	stmt, err := s.db.Prepare("INSERT INTO logging.audio_file (bucket, object_key, date_created) VALUES (?, ?, ?)")
 	if err != nil {
 		return 0, fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.ExecContext(ctx, link, time.Now().Format("2006-01-02 15:04:05"))
+	res, err := stmt.ExecContext(ctx, object.Bucket, object.Key, time.Now().Format("2006-01-02 15:04:05"))
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -67,38 +91,16 @@ func (s *Storage) SaveAudioFile(ctx context.Context, link string) (int64, error)
 	return id, nil
 }
 
-func (s *Storage) UpdateProtocolShortText(ctx context.Context, taskId int32, protocol string) (int64, error) {
-	const op = "storage.mysql.UpdateProtocolShortText"
-
-	stmt, err := s.db.Prepare("UPDATE logging.protocols SET text_short = ? WHERE task_id = ?")
-	if err != nil {
-		return 0, fmt.Errorf("%s: prepare statement: %w", op, err)
-	}
-	defer stmt.Close()
-
-	res, err := stmt.ExecContext(ctx, protocol, taskId)
-	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
-	}
-
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
-	}
-
-	return rowsAffected, nil
-}
-
-func (s *Storage) UpdateProtocolFullText(ctx context.Context, taskId int32, full_text string) (int64, error) {
-	const op = "storage.mysql.UpdateProtocolShortText"
+func (s *Storage) UpdateProtocolFullText(ctx context.Context, taskId int32, full_text rabbitmodels.ObjectRef) (int64, error) {
+	const op = "storage.mysql.UpdateProtocolFullText"
 
-	stmt, err := s.db.Prepare("UPDATE logging.protocols SET text_full = ? WHERE task_id = ?")
+	stmt, err := s.db.Prepare("UPDATE logging.protocols SET full_bucket = ?, full_key = ? WHERE task_id = ?")
 	if err != nil {
 		return 0, fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.ExecContext(ctx, full_text, taskId)
+	res, err := stmt.ExecContext(ctx, full_text.Bucket, full_text.Key, taskId)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -159,13 +161,13 @@ func (s *Storage) CreateNewTaskStatus(ctx context.Context) (int32, error) {
 	const op = "storage.mysql.CreateNewTaskStatus"
 	var task_status string = ""
 
-	stmt, err := s.db.Prepare("INSERT INTO logging.tasks (task_status) VALUES (?)")
+	stmt, err := s.db.Prepare("INSERT INTO logging.tasks (task_status, date_created) VALUES (?, ?)")
 	if err != nil {
 		return 0, fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.ExecContext(ctx, task_status)
+	res, err := stmt.ExecContext(ctx, task_status, formatDateTime(time.Now()))
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -218,7 +220,7 @@ func (s *Storage) GetTaskStatusByID(ctx context.Context, id int32) (string, erro
 	err = stmt.QueryRowContext(ctx, id).Scan(&taskStatus)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", fmt.Errorf("%s: task with id %d not found", op, id)
+			return "", fmt.Errorf("%s: task with id %d: %w", op, id, storage.ErrTaskNotFound)
 		}
 		return "", fmt.Errorf("%s: execute query: %w", op, err)
 	}
@@ -226,39 +228,43 @@ func (s *Storage) GetTaskStatusByID(ctx context.Context, id int32) (string, erro
 	return taskStatus, nil
 }
 
-func (s *Storage) GetProtocol(ctx context.Context, id int32) (string, string, error) {
-	const op = "storage.mysql.GetTaskStatusByID"
+// GetProtocol returns the short protocol and the full transcript objects,
+// not written ones are zero.
+func (s *Storage) GetProtocol(ctx context.Context, id int32) (rabbitmodels.ObjectRef, rabbitmodels.ObjectRef, error) {
+	const op = "storage.mysql.GetProtocol"
 
-	stmt, err := s.db.Prepare("SELECT text_short, text_full FROM logging.protocols WHERE task_id = ?")
+	stmt, err := s.db.Prepare("SELECT short_bucket, short_key, full_bucket, full_key FROM logging.protocols WHERE task_id = ?")
 	if err != nil {
-		return "", "", fmt.Errorf("%s: prepare statement: %w", op, err)
+		return rabbitmodels.ObjectRef{}, rabbitmodels.ObjectRef{}, fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
 	defer stmt.Close()
 
-	var short string
-	var full string
+	var shortBucket, shortKey, fullBucket, fullKey sql.NullString
 
-	err = stmt.QueryRowContext(ctx, id).Scan(&short, &full)
+	err = stmt.QueryRowContext(ctx, id).Scan(&shortBucket, &shortKey, &fullBucket, &fullKey)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", "", fmt.Errorf("%s: protocol with id %d not found", op, id)
+			return rabbitmodels.ObjectRef{}, rabbitmodels.ObjectRef{}, fmt.Errorf("%s: protocol with id %d not found", op, id)
 		}
-		return "", "", fmt.Errorf("%s: execute query: %w", op, err)
+		return rabbitmodels.ObjectRef{}, rabbitmodels.ObjectRef{}, fmt.Errorf("%s: execute query: %w", op, err)
 	}
 
+	short := rabbitmodels.ObjectRef{Bucket: shortBucket.String, Key: shortKey.String}
+	full := rabbitmodels.ObjectRef{Bucket: fullBucket.String, Key: fullKey.String}
+
 	return short, full, nil
 }
 
 func (s *Storage) CreateNewProtocol(ctx context.Context, task_id int32) error {
 	const op = "storage.mysql.CreateNewTaskStatus"
 
-	stmt, err := s.db.Prepare("INSERT INTO logging.protocols (task_id, text_full, text_short, date_created) VALUES (?, ?, ?, ?)")
+	stmt, err := s.db.Prepare("INSERT INTO logging.protocols (task_id, date_created) VALUES (?, ?)")
 	if err != nil {
 		return fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.ExecContext(ctx, task_id, "", "", time.Now().Format("2006-01-02 15:04:05"))
+	res, err := stmt.ExecContext(ctx, task_id, time.Now().Format("2006-01-02 15:04:05"))
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -270,3 +276,1332 @@ func (s *Storage) CreateNewProtocol(ctx context.Context, task_id int32) error {
 
 	return nil
 }
+
+func (s *Storage) SaveTranscription(ctx context.Context, taskId int32, result rabbitmodels.TranscriptionResult) error {
+	const op = "storage.mysql.SaveTranscription"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE logging.tasks SET language = ? WHERE id = ?", result.Language, taskId); err != nil {
+		return fmt.Errorf("%s: update language: %w", op, err)
+	}
+
+	// повторный результат от воркера полностью заменяет старые сегменты
+	if _, err := tx.ExecContext(ctx, "DELETE FROM logging.transcript_segments WHERE task_id = ?", taskId); err != nil {
+		return fmt.Errorf("%s: delete old segments: %w", op, err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO logging.transcript_segments (task_id, segment_index, start_time, end_time, speaker, text, confidence, words) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer stmt.Close()
+
+	for i, segment := range result.Segments {
+		words, err := json.Marshal(segment.Words)
+		if err != nil {
+			return fmt.Errorf("%s: marshal words: %w", op, err)
+		}
+
+		_, err = stmt.ExecContext(ctx, taskId, i, segment.Start, segment.End, segment.Speaker, segment.Text, segment.Confidence, words)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetTranscription(ctx context.Context, taskId int32) (rabbitmodels.TranscriptionResult, error) {
+	const op = "storage.mysql.GetTranscription"
+
+	var result rabbitmodels.TranscriptionResult
+	var language sql.NullString
+
+	err := s.db.QueryRowContext(ctx, "SELECT language FROM logging.tasks WHERE id = ?", taskId).Scan(&language)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, fmt.Errorf("%s: task with id %d not found", op, taskId)
+		}
+		return result, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	result.Language = language.String
+
+	rows, err := s.db.QueryContext(ctx, "SELECT start_time, end_time, speaker, text, confidence, words FROM logging.transcript_segments WHERE task_id = ? ORDER BY segment_index", taskId)
+	if err != nil {
+		return result, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var segment rabbitmodels.TranscriptionSegment
+		var speaker, text sql.NullString
+		var confidence sql.NullFloat64
+		var words []byte
+
+		if err := rows.Scan(&segment.Start, &segment.End, &speaker, &text, &confidence, &words); err != nil {
+			return result, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+
+		segment.Speaker = speaker.String
+		segment.Text = text.String
+		segment.Confidence = confidence.Float64
+		if len(words) > 0 {
+			if err := json.Unmarshal(words, &segment.Words); err != nil {
+				return result, fmt.Errorf("%s: unmarshal words: %w", op, err)
+			}
+		}
+
+		result.Segments = append(result.Segments, segment)
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result, nil
+}
+
+// objectColumns - ссылка до миграции 8 и колонки, куда из неё переносится объект
+var objectColumns = []struct {
+	table, link, bucket, key string
+}{
+	{"audio_file", "link", "bucket", "object_key"},
+	{"task_tracks", "link", "bucket", "object_key"},
+	{"protocols", "text_short", "short_bucket", "short_key"},
+	{"protocols", "text_full", "full_bucket", "full_key"},
+}
+
+// BackfillObjectKeys fills bucket and key of rows stored before ObjectRef
+// from their presigned links. Links that are not presigned URLs are left
+// for a manual check. Returns the number of filled objects.
+func (s *Storage) BackfillObjectKeys(ctx context.Context) (int, error) {
+	const op = "storage.mysql.BackfillObjectKeys"
+
+	filled := 0
+	for _, columns := range objectColumns {
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT id, %s FROM logging.%s WHERE %s IS NOT NULL AND %s IS NULL",
+			columns.link, columns.table, columns.link, columns.key))
+		if err != nil {
+			return filled, fmt.Errorf("%s: execute query: %w", op, err)
+		}
+
+		objects := make(map[int64]rabbitmodels.ObjectRef)
+		for rows.Next() {
+			var id int64
+			var link string
+			if err := rows.Scan(&id, &link); err != nil {
+				rows.Close()
+				return filled, fmt.Errorf("%s: scan row: %w", op, err)
+			}
+			if object, ok := rabbitmodels.ObjectRefFromLink(link); ok {
+				objects[id] = object
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return filled, fmt.Errorf("%s: read rows: %w", op, err)
+		}
+
+		query := fmt.Sprintf("UPDATE logging.%s SET %s = ?, %s = ? WHERE id = ? AND %s IS NULL",
+			columns.table, columns.bucket, columns.key, columns.key)
+		for id, object := range objects {
+			if _, err := s.db.ExecContext(ctx, query, object.Bucket, object.Key, id); err != nil {
+				return filled, fmt.Errorf("%s: execute query: %w", op, err)
+			}
+			filled++
+		}
+	}
+
+	return filled, nil
+}
+
+func (s *Storage) CreateJob(ctx context.Context, taskId int32, kind string, payload []byte) (int64, error) {
+	const op = "storage.mysql.CreateJob"
+
+	stmt, err := s.db.Prepare("INSERT INTO logging.task_jobs (task_id, kind, payload, state, date_created) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, taskId, kind, payload, rabbitmodels.JobStatePending, formatDateTime(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// LeaseJob takes the oldest pending job of the given kinds, or a leased one
+// whose lease has expired and that has attempts left. Returns false if the
+// pool is empty.
+func (s *Storage) LeaseJob(ctx context.Context, kinds []string, workerId, leaseId string, leaseTimeout time.Duration, maxAttempts int) (rabbitmodels.Job, bool, error) {
+	const op = "storage.mysql.LeaseJob"
+
+	var job rabbitmodels.Job
+	if len(kinds) == 0 {
+		return job, false, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return job, false, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(kinds)), ", ")
+	args := make([]any, 0, len(kinds)+3)
+	for _, kind := range kinds {
+		args = append(args, kind)
+	}
+	now := time.Now()
+	args = append(args, rabbitmodels.JobStatePending, rabbitmodels.JobStateLeased, formatDateTime(now), maxAttempts)
+
+	query := "SELECT id, task_id, kind, payload, attempts FROM logging.task_jobs " +
+		"WHERE kind IN (" + placeholders + ") AND (state = ? OR (state = ? AND lease_expires_at < ? AND attempts < ?)) " +
+		"ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED"
+
+	var payload []byte
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&job.Id, &job.TaskId, &job.Kind, &payload, &job.Attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return job, false, nil
+		}
+		return job, false, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	job.Payload = payload
+	job.LeaseId = leaseId
+	job.WorkerId = workerId
+	job.LeaseExpiresAt = now.Add(leaseTimeout)
+	job.Attempts++
+
+	_, err = tx.ExecContext(ctx, "UPDATE logging.task_jobs SET state = ?, lease_id = ?, worker_id = ?, lease_expires_at = ?, attempts = ? WHERE id = ?",
+		rabbitmodels.JobStateLeased, job.LeaseId, job.WorkerId, formatDateTime(job.LeaseExpiresAt), job.Attempts, job.Id)
+	if err != nil {
+		return job, false, fmt.Errorf("%s: update job: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return job, false, fmt.Errorf("%s: commit: %w", op, err)
+	}
+
+	return job, true, nil
+}
+
+func (s *Storage) RenewLease(ctx context.Context, jobId int64, leaseId string, leaseTimeout time.Duration) (time.Time, error) {
+	const op = "storage.mysql.RenewLease"
+
+	expiresAt := time.Now().Add(leaseTimeout)
+
+	res, err := s.db.ExecContext(ctx, "UPDATE logging.task_jobs SET lease_expires_at = ? WHERE id = ? AND lease_id = ? AND state = ? AND lease_expires_at >= ?",
+		formatDateTime(expiresAt), jobId, leaseId, rabbitmodels.JobStateLeased, formatDateTime(time.Now()))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: get rows affected: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return time.Time{}, fmt.Errorf("%s: lease %s for job %d is lost or expired", op, leaseId, jobId)
+	}
+
+	return expiresAt, nil
+}
+
+// GetLeasedJob returns the job only while the given lease still owns it.
+func (s *Storage) GetLeasedJob(ctx context.Context, jobId int64, leaseId string) (rabbitmodels.Job, error) {
+	const op = "storage.mysql.GetLeasedJob"
+
+	var job rabbitmodels.Job
+	var payload []byte
+	var expiresAt sql.NullString
+
+	err := s.db.QueryRowContext(ctx, "SELECT id, task_id, kind, payload, lease_id, worker_id, lease_expires_at, attempts FROM logging.task_jobs WHERE id = ? AND lease_id = ? AND state = ? AND lease_expires_at >= ?",
+		jobId, leaseId, rabbitmodels.JobStateLeased, formatDateTime(time.Now())).
+		Scan(&job.Id, &job.TaskId, &job.Kind, &payload, &job.LeaseId, &job.WorkerId, &expiresAt, &job.Attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return job, fmt.Errorf("%s: lease %s for job %d is lost or expired", op, leaseId, jobId)
+		}
+		return job, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	job.Payload = payload
+	job.LeaseExpiresAt = parseDateTime(expiresAt)
+
+	return job, nil
+}
+
+// ReleaseJob returns a leased job to the pool, e.g. when the worker failed it.
+func (s *Storage) ReleaseJob(ctx context.Context, jobId int64, leaseId string) error {
+	const op = "storage.mysql.ReleaseJob"
+
+	_, err := s.db.ExecContext(ctx, "UPDATE logging.task_jobs SET state = ?, lease_id = NULL, worker_id = NULL, lease_expires_at = NULL WHERE id = ? AND lease_id = ? AND state = ?",
+		rabbitmodels.JobStatePending, jobId, leaseId, rabbitmodels.JobStateLeased)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+// ClaimUnleasedJobs moves jobs that no pull worker has leased since before
+// into the pushed state and returns them. A claimed job is never leased,
+// so it is processed by exactly one worker.
+func (s *Storage) ClaimUnleasedJobs(ctx context.Context, before time.Time, limit int) ([]rabbitmodels.Job, error) {
+	const op = "storage.mysql.ClaimUnleasedJobs"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, task_id, kind, payload, attempts FROM logging.task_jobs "+
+		"WHERE state = ? AND attempts = 0 AND date_created < ? ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED",
+		rabbitmodels.JobStatePending, formatDateTime(before), limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	var jobs []rabbitmodels.Job
+	for rows.Next() {
+		var job rabbitmodels.Job
+		var payload []byte
+		if err := rows.Scan(&job.Id, &job.TaskId, &job.Kind, &payload, &job.Attempts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		job.Payload = payload
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	for _, job := range jobs {
+		_, err := tx.ExecContext(ctx, "UPDATE logging.task_jobs SET state = ? WHERE id = ?", rabbitmodels.JobStatePushed, job.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: update job: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: commit: %w", op, err)
+	}
+
+	return jobs, nil
+}
+
+// ReturnPushedJob puts a claimed job back into the pool when it could not be published.
+func (s *Storage) ReturnPushedJob(ctx context.Context, jobId int64) error {
+	const op = "storage.mysql.ReturnPushedJob"
+
+	_, err := s.db.ExecContext(ctx, "UPDATE logging.task_jobs SET state = ? WHERE id = ? AND state = ?",
+		rabbitmodels.JobStatePending, jobId, rabbitmodels.JobStatePushed)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+// FailJob marks a leased job as failed, it is not leased again.
+func (s *Storage) FailJob(ctx context.Context, jobId int64, leaseId string) error {
+	const op = "storage.mysql.FailJob"
+
+	_, err := s.db.ExecContext(ctx, "UPDATE logging.task_jobs SET state = ?, lease_id = NULL, lease_expires_at = NULL WHERE id = ? AND lease_id = ? AND state = ?",
+		rabbitmodels.JobStateFailed, jobId, leaseId, rabbitmodels.JobStateLeased)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+// FailExpiredJobs marks as failed the jobs whose lease expired on the last
+// allowed attempt (the worker died or hung) and returns them.
+func (s *Storage) FailExpiredJobs(ctx context.Context, maxAttempts int) ([]rabbitmodels.Job, error) {
+	const op = "storage.mysql.FailExpiredJobs"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, task_id, kind, attempts FROM logging.task_jobs "+
+		"WHERE state = ? AND lease_expires_at < ? AND attempts >= ? FOR UPDATE SKIP LOCKED",
+		rabbitmodels.JobStateLeased, formatDateTime(time.Now()), maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	var jobs []rabbitmodels.Job
+	for rows.Next() {
+		var job rabbitmodels.Job
+		if err := rows.Scan(&job.Id, &job.TaskId, &job.Kind, &job.Attempts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	for _, job := range jobs {
+		_, err := tx.ExecContext(ctx, "UPDATE logging.task_jobs SET state = ?, lease_id = NULL, lease_expires_at = NULL WHERE id = ?",
+			rabbitmodels.JobStateFailed, job.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: update job: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: commit: %w", op, err)
+	}
+
+	return jobs, nil
+}
+
+// FinishTaskJobs marks every job of the task and kind as done. It is called
+// from the common completion path, so a result from a push worker also
+// removes the job from the pull pool.
+func (s *Storage) FinishTaskJobs(ctx context.Context, taskId int32, kind string) error {
+	const op = "storage.mysql.FinishTaskJobs"
+
+	_, err := s.db.ExecContext(ctx, "UPDATE logging.task_jobs SET state = ? WHERE task_id = ? AND kind = ? AND state <> ?",
+		rabbitmodels.JobStateDone, taskId, kind, rabbitmodels.JobStateDone)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveTaskProgress(ctx context.Context, progress rabbitmodels.TaskProgress) error {
+	const op = "storage.mysql.SaveTaskProgress"
+
+	stmt, err := s.db.Prepare("INSERT INTO logging.task_progress (task_id, percent, eta_seconds, stage, message, date_updated) VALUES (?, ?, ?, ?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE percent = VALUES(percent), eta_seconds = VALUES(eta_seconds), stage = VALUES(stage), message = VALUES(message), date_updated = VALUES(date_updated)")
+	if err != nil {
+		return fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, progress.TaskId, progress.Percent, progress.EtaSeconds, progress.Stage, progress.Message, formatDateTime(progress.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetTaskProgress returns false if no worker has reported progress for the task yet.
+func (s *Storage) GetTaskProgress(ctx context.Context, taskId int32) (rabbitmodels.TaskProgress, bool, error) {
+	const op = "storage.mysql.GetTaskProgress"
+
+	progress := rabbitmodels.TaskProgress{TaskId: taskId}
+	var eta sql.NullInt64
+	var stage, message, updated sql.NullString
+
+	err := s.db.QueryRowContext(ctx, "SELECT percent, eta_seconds, stage, message, date_updated FROM logging.task_progress WHERE task_id = ?", taskId).
+		Scan(&progress.Percent, &eta, &stage, &message, &updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return progress, false, nil
+		}
+		return progress, false, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	progress.EtaSeconds = eta.Int64
+	progress.Stage = stage.String
+	progress.Message = message.String
+	progress.UpdatedAt = parseDateTime(updated)
+
+	return progress, true, nil
+}
+
+func (s *Storage) SaveTaskMetadata(ctx context.Context, taskId int32, metadata rabbitmodels.TaskMetadata) error {
+	const op = "storage.mysql.SaveTaskMetadata"
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("%s: marshal metadata: %w", op, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, "UPDATE logging.tasks SET metadata = ? WHERE id = ?", data, taskId)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetTaskMetadata(ctx context.Context, taskId int32) (rabbitmodels.TaskMetadata, error) {
+	const op = "storage.mysql.GetTaskMetadata"
+
+	var metadata rabbitmodels.TaskMetadata
+	var data []byte
+
+	err := s.db.QueryRowContext(ctx, "SELECT metadata FROM logging.tasks WHERE id = ?", taskId).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return metadata, fmt.Errorf("%s: task with id %d not found", op, taskId)
+		}
+		return metadata, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return metadata, fmt.Errorf("%s: unmarshal metadata: %w", op, err)
+		}
+	}
+
+	return metadata, nil
+}
+
+// StartTrack registers a recording source of the task. A source that was
+// already uploaded cannot record again.
+func (s *Storage) StartTrack(ctx context.Context, taskId int32, source string) error {
+	const op = "storage.mysql.StartTrack"
+
+	_, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO logging.task_tracks (task_id, source, state, date_created) VALUES (?, ?, ?, ?)",
+		taskId, source, rabbitmodels.TrackStateRecording, formatDateTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	var state string
+	err = s.db.QueryRowContext(ctx, "SELECT state FROM logging.task_tracks WHERE task_id = ? AND source = ?", taskId, source).Scan(&state)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	if state != rabbitmodels.TrackStateRecording {
+		return fmt.Errorf("%s: %w", op, storage.ErrTrackFinished)
+	}
+
+	return nil
+}
+
+// SaveTrack stores the uploaded track, the source may be unregistered (file upload).
+func (s *Storage) SaveTrack(ctx context.Context, taskId int32, track rabbitmodels.Track) error {
+	const op = "storage.mysql.SaveTrack"
+
+	metadata, err := json.Marshal(track.Metadata)
+	if err != nil {
+		return fmt.Errorf("%s: marshal metadata: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare("INSERT INTO logging.task_tracks (task_id, source, state, bucket, object_key, content_type, metadata, date_created) VALUES (?, ?, ?, ?, ?, ?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE state = VALUES(state), bucket = VALUES(bucket), object_key = VALUES(object_key), content_type = VALUES(content_type), metadata = VALUES(metadata)")
+	if err != nil {
+		return fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, taskId, track.Source, track.State, track.Object.Bucket, track.Object.Key, track.ContentType, metadata, formatDateTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetTracks returns the tracks of the task in the order the sources joined.
+func (s *Storage) GetTracks(ctx context.Context, taskId int32) ([]rabbitmodels.Track, error) {
+	const op = "storage.mysql.GetTracks"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT source, state, bucket, object_key, content_type, metadata FROM logging.task_tracks WHERE task_id = ? ORDER BY id", taskId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var tracks []rabbitmodels.Track
+	for rows.Next() {
+		var track rabbitmodels.Track
+		var bucket, objectKey, contentType sql.NullString
+		var metadata []byte
+
+		if err := rows.Scan(&track.Source, &track.State, &bucket, &objectKey, &contentType, &metadata); err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		track.Object = rabbitmodels.ObjectRef{Bucket: bucket.String, Key: objectKey.String}
+		track.ContentType = contentType.String
+
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &track.Metadata); err != nil {
+				return nil, fmt.Errorf("%s: unmarshal metadata: %w", op, err)
+			}
+		}
+
+		tracks = append(tracks, track)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	return tracks, nil
+}
+
+// ListTasks returns tasks matching the filter ordered by id, which follows
+// the creation order, so the id of the last task is the next page cursor.
+func (s *Storage) ListTasks(ctx context.Context, filter rabbitmodels.TaskFilter) ([]rabbitmodels.TaskSummary, error) {
+	const op = "storage.mysql.ListTasks"
+
+	var where []string
+	var args []any
+
+	if filter.TaskId != 0 {
+		where = append(where, "t.id = ?")
+		args = append(args, filter.TaskId)
+	}
+	if len(filter.Statuses) > 0 {
+		where = append(where, "t.task_status IN (?"+strings.Repeat(", ?", len(filter.Statuses)-1)+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if filter.Source != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM logging.task_tracks s WHERE s.task_id = t.id AND s.source = ?)")
+		args = append(args, filter.Source)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "t.date_created >= ?")
+		args = append(args, formatDateTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "t.date_created < ?")
+		args = append(args, formatDateTime(filter.To))
+	}
+
+	order := "DESC"
+	if filter.Ascending {
+		order = "ASC"
+	}
+	if filter.AfterId != 0 {
+		if filter.Ascending {
+			where = append(where, "t.id > ?")
+		} else {
+			where = append(where, "t.id < ?")
+		}
+		args = append(args, filter.AfterId)
+	}
+
+	query := "SELECT t.id, t.task_status, t.language, t.metadata, t.date_created, GROUP_CONCAT(tt.source ORDER BY tt.id) " +
+		"FROM logging.tasks t LEFT JOIN logging.task_tracks tt ON tt.task_id = t.id"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " GROUP BY t.id ORDER BY t.id " + order
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	defer rows.Close()
+
+	tasks := []rabbitmodels.TaskSummary{}
+	for rows.Next() {
+		var task rabbitmodels.TaskSummary
+		var language, dateCreated, sources sql.NullString
+		var metadata []byte
+
+		if err := rows.Scan(&task.Id, &task.Status, &language, &metadata, &dateCreated, &sources); err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		task.Language = language.String
+
+		if dateCreated.Valid {
+			createdAt := parseDateTime(dateCreated)
+			task.CreatedAt = &createdAt
+		}
+		if sources.Valid && sources.String != "" {
+			task.Sources = strings.Split(sources.String, ",")
+		}
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &task.Metadata); err != nil {
+				return nil, fmt.Errorf("%s: unmarshal metadata: %w", op, err)
+			}
+		}
+
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	return tasks, nil
+}
+
+func (s *Storage) GetTask(ctx context.Context, taskId int32) (rabbitmodels.TaskSummary, error) {
+	const op = "storage.mysql.GetTask"
+
+	tasks, err := s.ListTasks(ctx, rabbitmodels.TaskFilter{TaskId: taskId, Limit: 1})
+	if err != nil {
+		return rabbitmodels.TaskSummary{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(tasks) == 0 {
+		return rabbitmodels.TaskSummary{}, fmt.Errorf("%s: %w", op, storage.ErrTaskNotFound)
+	}
+
+	return tasks[0], nil
+}
+
+func (s *Storage) GetTranscriptSummary(ctx context.Context, taskId int32) (rabbitmodels.TranscriptSummary, error) {
+	const op = "storage.mysql.GetTranscriptSummary"
+
+	var summary rabbitmodels.TranscriptSummary
+	var duration sql.NullFloat64
+
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*), MAX(end_time) FROM logging.transcript_segments WHERE task_id = ?", taskId).
+		Scan(&summary.Segments, &duration)
+	if err != nil {
+		return summary, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	summary.DurationSeconds = duration.Float64
+
+	return summary, nil
+}
+
+// AddProtocolRevision saves the next revision of the task's protocol and
+// makes it current. Revisions of one task are numbered under the lock of
+// the task's protocols row. A non-negative base must be the current
+// revision, otherwise ErrRevisionConflict is returned.
+func (s *Storage) AddProtocolRevision(ctx context.Context, revision rabbitmodels.ProtocolRevision, base int) (rabbitmodels.ProtocolRevision, error) {
+	const op = "storage.mysql.AddProtocolRevision"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return revision, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var protocolId int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM logging.protocols WHERE task_id = ? FOR UPDATE", revision.TaskId).Scan(&protocolId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return revision, fmt.Errorf("%s: %w", op, storage.ErrTaskNotFound)
+	}
+	if err != nil {
+		return revision, fmt.Errorf("%s: lock protocol: %w", op, err)
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(revision), 0) + 1 FROM logging.protocol_revisions WHERE task_id = ?", revision.TaskId).
+		Scan(&revision.Number)
+	if err != nil {
+		return revision, fmt.Errorf("%s: next revision: %w", op, err)
+	}
+	if base >= 0 && revision.Number-1 != base {
+		return revision, fmt.Errorf("%s: %w", op, storage.ErrRevisionConflict)
+	}
+
+	revision.CreatedAt = time.Now().Truncate(time.Second)
+
+	var revertedFrom sql.NullInt64
+	if revision.RevertedFrom > 0 {
+		revertedFrom = sql.NullInt64{Int64: int64(revision.RevertedFrom), Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO logging.protocol_revisions (task_id, revision, source, author, reverted_from, bucket, object_key, date_created) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		revision.TaskId, revision.Number, revision.Source, revision.Author, revertedFrom, revision.Object.Bucket, revision.Object.Key, formatDateTime(revision.CreatedAt))
+	if err != nil {
+		return revision, fmt.Errorf("%s: insert revision: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE logging.protocols SET short_bucket = ?, short_key = ? WHERE id = ?", revision.Object.Bucket, revision.Object.Key, protocolId)
+	if err != nil {
+		return revision, fmt.Errorf("%s: update protocol: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return revision, fmt.Errorf("%s: commit: %w", op, err)
+	}
+
+	return revision, nil
+}
+
+// SeedLegacyRevisions saves the protocol of every task without revisions as
+// its revision 1. Keys of protocols stored before migration 8 are known only
+// after BackfillObjectKeys, so it runs after it and not in migration 9.
+func (s *Storage) SeedLegacyRevisions(ctx context.Context) (int, error) {
+	const op = "storage.mysql.SeedLegacyRevisions"
+
+	// IGNORE: ревизию 1 мог только что сохранить другой экземпляр
+	res, err := s.db.ExecContext(ctx, `INSERT IGNORE INTO logging.protocol_revisions (task_id, revision, source, bucket, object_key, date_created)
+		SELECT p.task_id, 1, ?, p.short_bucket, p.short_key, p.date_created
+		FROM logging.protocols p
+		WHERE p.short_key IS NOT NULL AND p.short_key <> ''
+			AND NOT EXISTS (SELECT 1 FROM logging.protocol_revisions r WHERE r.task_id = p.task_id)`,
+		rabbitmodels.RevisionSourceLegacy)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	seeded, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(seeded), nil
+}
+
+func (s *Storage) ListProtocolRevisions(ctx context.Context, taskId int32) ([]rabbitmodels.ProtocolRevision, error) {
+	const op = "storage.mysql.ListProtocolRevisions"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+revisionColumns+" FROM logging.protocol_revisions WHERE task_id = ? ORDER BY revision", taskId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	defer rows.Close()
+
+	revisions := []rabbitmodels.ProtocolRevision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	return revisions, nil
+}
+
+// GetProtocolRevision returns the revision by number, 0 is the current one.
+func (s *Storage) GetProtocolRevision(ctx context.Context, taskId int32, number int) (rabbitmodels.ProtocolRevision, error) {
+	const op = "storage.mysql.GetProtocolRevision"
+
+	query := "SELECT " + revisionColumns + " FROM logging.protocol_revisions WHERE task_id = ? AND revision = ?"
+	args := []any{taskId, number}
+	if number == 0 {
+		query = "SELECT " + revisionColumns + " FROM logging.protocol_revisions WHERE task_id = ? ORDER BY revision DESC LIMIT 1"
+		args = args[:1]
+	}
+
+	revision, err := scanRevision(s.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return revision, fmt.Errorf("%s: %w", op, storage.ErrRevisionNotFound)
+	}
+	if err != nil {
+		return revision, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return revision, nil
+}
+
+const revisionColumns = "task_id, revision, source, author, reverted_from, bucket, object_key, date_created"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRevision(row rowScanner) (rabbitmodels.ProtocolRevision, error) {
+	var revision rabbitmodels.ProtocolRevision
+	var author, bucket, objectKey, dateCreated sql.NullString
+	var revertedFrom sql.NullInt64
+
+	err := row.Scan(&revision.TaskId, &revision.Number, &revision.Source, &author, &revertedFrom, &bucket, &objectKey, &dateCreated)
+	if err != nil {
+		return revision, err
+	}
+
+	revision.Author = author.String
+	revision.RevertedFrom = int(revertedFrom.Int64)
+	revision.Object = rabbitmodels.ObjectRef{Bucket: bucket.String, Key: objectKey.String}
+	revision.CreatedAt = parseDateTime(dateCreated)
+
+	return revision, nil
+}
+
+func (s *Storage) CreateUpload(ctx context.Context, upload rabbitmodels.Upload) error {
+	const op = "storage.mysql.CreateUpload"
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO logging.uploads (id, task_id, source, filename, content_type, length, received, state, date_created, date_updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		upload.Id, upload.TaskId, upload.Source, upload.Filename, upload.ContentType, upload.Length, upload.Offset, upload.State,
+		formatDateTime(upload.CreatedAt), formatDateTime(upload.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetUpload(ctx context.Context, id string) (rabbitmodels.Upload, error) {
+	const op = "storage.mysql.GetUpload"
+
+	upload, err := scanUpload(s.db.QueryRowContext(ctx, "SELECT "+uploadColumns+" FROM logging.uploads WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return upload, fmt.Errorf("%s: %w", op, storage.ErrUploadNotFound)
+	}
+	if err != nil {
+		return upload, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return upload, nil
+}
+
+// UpdateUploadOffset moves the offset of an upload that is still receiving
+// data from one value to another.
+func (s *Storage) UpdateUploadOffset(ctx context.Context, id string, from int64, to int64) error {
+	const op = "storage.mysql.UpdateUploadOffset"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE logging.uploads SET received = ?, date_updated = ? WHERE id = ? AND received = ? AND state = ?",
+		to, formatDateTime(time.Now()), id, from, rabbitmodels.UploadStateUploading)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return uploadChanged(op, res)
+}
+
+// SetUploadState changes the state only if it is still from, so exactly one
+// caller wins the transition.
+func (s *Storage) SetUploadState(ctx context.Context, id string, from string, to string) error {
+	const op = "storage.mysql.SetUploadState"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE logging.uploads SET state = ?, date_updated = ? WHERE id = ? AND state = ?",
+		to, formatDateTime(time.Now()), id, from)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return uploadChanged(op, res)
+}
+
+func (s *Storage) DeleteUpload(ctx context.Context, id string) error {
+	const op = "storage.mysql.DeleteUpload"
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM logging.uploads WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+// ListStaleUploads returns unfinished uploads that got no data since before.
+func (s *Storage) ListStaleUploads(ctx context.Context, before time.Time) ([]rabbitmodels.Upload, error) {
+	const op = "storage.mysql.ListStaleUploads"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+uploadColumns+" FROM logging.uploads WHERE state = ? AND date_updated < ?",
+		rabbitmodels.UploadStateUploading, formatDateTime(before))
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var uploads []rabbitmodels.Upload
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		uploads = append(uploads, upload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: rows: %w", op, err)
+	}
+
+	return uploads, nil
+}
+
+const uploadColumns = "id, task_id, source, filename, content_type, length, received, state, date_created, date_updated"
+
+func scanUpload(row rowScanner) (rabbitmodels.Upload, error) {
+	var upload rabbitmodels.Upload
+	var filename, contentType, dateCreated, dateUpdated sql.NullString
+
+	err := row.Scan(&upload.Id, &upload.TaskId, &upload.Source, &filename, &contentType,
+		&upload.Length, &upload.Offset, &upload.State, &dateCreated, &dateUpdated)
+	if err != nil {
+		return upload, err
+	}
+
+	upload.Filename = filename.String
+	upload.ContentType = contentType.String
+	upload.CreatedAt = parseDateTime(dateCreated)
+	upload.UpdatedAt = parseDateTime(dateUpdated)
+
+	return upload, nil
+}
+
+func uploadChanged(op string, res sql.Result) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUploadConflict)
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, webhook rabbitmodels.Webhook) (int64, error) {
+	const op = "storage.mysql.CreateWebhook"
+
+	res, err := s.db.ExecContext(ctx, "INSERT INTO logging.webhooks (task_id, url, secret, events, date_created) VALUES (?, ?, ?, ?, ?)",
+		webhook.TaskId, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), formatDateTime(webhook.CreatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, id int64) (rabbitmodels.Webhook, error) {
+	const op = "storage.mysql.GetWebhook"
+
+	webhook, err := scanWebhook(s.db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM logging.webhooks WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhook, fmt.Errorf("%s: %w", op, storage.ErrWebhookNotFound)
+	}
+	if err != nil {
+		return webhook, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return webhook, nil
+}
+
+// ListWebhooks returns the webhooks of the task, taskId 0 - the global ones.
+func (s *Storage) ListWebhooks(ctx context.Context, taskId int32) ([]rabbitmodels.Webhook, error) {
+	const op = "storage.mysql.ListWebhooks"
+
+	webhooks, err := s.queryWebhooks(ctx, "SELECT "+webhookColumns+" FROM logging.webhooks WHERE task_id = ? ORDER BY id", taskId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return webhooks, nil
+}
+
+// ListTaskWebhooks returns the webhooks an event of the task goes to: its own and the global ones.
+func (s *Storage) ListTaskWebhooks(ctx context.Context, taskId int32) ([]rabbitmodels.Webhook, error) {
+	const op = "storage.mysql.ListTaskWebhooks"
+
+	webhooks, err := s.queryWebhooks(ctx, "SELECT "+webhookColumns+" FROM logging.webhooks WHERE task_id IN (0, ?) ORDER BY id", taskId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook removes the webhook with its delivery log.
+func (s *Storage) DeleteWebhook(ctx context.Context, id int64) error {
+	const op = "storage.mysql.DeleteWebhook"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM logging.webhooks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	if rowsAffected, err := res.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrWebhookNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM logging.webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateWebhookDelivery(ctx context.Context, delivery rabbitmodels.WebhookDelivery) (int64, error) {
+	const op = "storage.mysql.CreateWebhookDelivery"
+
+	var redeliveryOf sql.NullInt64
+	if delivery.RedeliveryOf > 0 {
+		redeliveryOf = sql.NullInt64{Int64: delivery.RedeliveryOf, Valid: true}
+	}
+
+	res, err := s.db.ExecContext(ctx, "INSERT INTO logging.webhook_deliveries (webhook_id, task_id, event, payload, state, attempts, redelivery_of, next_attempt, date_created, date_updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		delivery.WebhookId, delivery.TaskId, delivery.Event, string(delivery.Payload), delivery.State, delivery.Attempts, redeliveryOf,
+		formatDateTime(delivery.NextAttemptAt), formatDateTime(delivery.CreatedAt), formatDateTime(delivery.UpdatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetWebhookDelivery(ctx context.Context, id int64) (rabbitmodels.WebhookDelivery, error) {
+	const op = "storage.mysql.GetWebhookDelivery"
+
+	delivery, err := scanDelivery(s.db.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM logging.webhook_deliveries WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return delivery, fmt.Errorf("%s: %w", op, storage.ErrDeliveryNotFound)
+	}
+	if err != nil {
+		return delivery, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return delivery, nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the webhook, newest first.
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, webhookId int64, limit int) ([]rabbitmodels.WebhookDelivery, error) {
+	const op = "storage.mysql.ListWebhookDeliveries"
+
+	deliveries, err := s.queryDeliveries(ctx, "SELECT "+deliveryColumns+" FROM logging.webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?", webhookId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// ListDueWebhookDeliveries returns pending deliveries whose next attempt is not after now.
+func (s *Storage) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]rabbitmodels.WebhookDelivery, error) {
+	const op = "storage.mysql.ListDueWebhookDeliveries"
+
+	deliveries, err := s.queryDeliveries(ctx, "SELECT "+deliveryColumns+" FROM logging.webhook_deliveries WHERE state = ? AND next_attempt <= ? ORDER BY next_attempt, id LIMIT ?",
+		rabbitmodels.DeliveryStatePending, formatDateTime(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery stores the outcome of an attempt.
+func (s *Storage) UpdateWebhookDelivery(ctx context.Context, delivery rabbitmodels.WebhookDelivery) error {
+	const op = "storage.mysql.UpdateWebhookDelivery"
+
+	var responseStatus sql.NullInt64
+	if delivery.ResponseStatus > 0 {
+		responseStatus = sql.NullInt64{Int64: int64(delivery.ResponseStatus), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, "UPDATE logging.webhook_deliveries SET state = ?, attempts = ?, response_status = ?, last_error = ?, next_attempt = ?, date_updated = ? WHERE id = ?",
+		delivery.State, delivery.Attempts, responseStatus, delivery.LastError, formatDateTime(delivery.NextAttemptAt), formatDateTime(delivery.UpdatedAt), delivery.Id)
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+const webhookColumns = "id, task_id, url, secret, events, date_created"
+
+func scanWebhook(row rowScanner) (rabbitmodels.Webhook, error) {
+	var webhook rabbitmodels.Webhook
+	var events string
+	var dateCreated sql.NullString
+
+	err := row.Scan(&webhook.Id, &webhook.TaskId, &webhook.URL, &webhook.Secret, &events, &dateCreated)
+	if err != nil {
+		return webhook, err
+	}
+
+	webhook.Events = []string{}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	webhook.CreatedAt = parseDateTime(dateCreated)
+
+	return webhook, nil
+}
+
+func (s *Storage) queryWebhooks(ctx context.Context, query string, args ...any) ([]rabbitmodels.Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []rabbitmodels.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+const deliveryColumns = "id, webhook_id, task_id, event, payload, state, attempts, response_status, last_error, redelivery_of, next_attempt, date_created, date_updated"
+
+func scanDelivery(row rowScanner) (rabbitmodels.WebhookDelivery, error) {
+	var delivery rabbitmodels.WebhookDelivery
+	var payload string
+	var responseStatus, redeliveryOf sql.NullInt64
+	var lastError, nextAttempt, dateCreated, dateUpdated sql.NullString
+
+	err := row.Scan(&delivery.Id, &delivery.WebhookId, &delivery.TaskId, &delivery.Event, &payload, &delivery.State,
+		&delivery.Attempts, &responseStatus, &lastError, &redeliveryOf, &nextAttempt, &dateCreated, &dateUpdated)
+	if err != nil {
+		return delivery, err
+	}
+
+	delivery.Payload = json.RawMessage(payload)
+	delivery.ResponseStatus = int(responseStatus.Int64)
+	delivery.LastError = lastError.String
+	delivery.RedeliveryOf = redeliveryOf.Int64
+	delivery.NextAttemptAt = parseDateTime(nextAttempt)
+	delivery.CreatedAt = parseDateTime(dateCreated)
+	delivery.UpdatedAt = parseDateTime(dateUpdated)
+
+	return delivery, nil
+}
+
+func (s *Storage) queryDeliveries(ctx context.Context, query string, args ...any) ([]rabbitmodels.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []rabbitmodels.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// IndexDocument replaces the indexed text of the task of the given kind.
+func (s *Storage) IndexDocument(ctx context.Context, document rabbitmodels.SearchDocument) error {
+	const op = "storage.mysql.IndexDocument"
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO logging.search_documents (task_id, kind, body, date_updated) VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE body = VALUES(body), date_updated = VALUES(date_updated)",
+		document.TaskId, document.Kind, document.Body, formatDateTime(document.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("%s: execute query: %w", op, err)
+	}
+
+	return nil
+}
+
+// SearchDocuments finds documents by a full-text boolean query, the most
+// relevant first.
+func (s *Storage) SearchDocuments(ctx context.Context, filter rabbitmodels.SearchFilter) ([]rabbitmodels.SearchHit, error) {
+	const op = "storage.mysql.SearchDocuments"
+
+	where := []string{"MATCH(d.body) AGAINST (? IN BOOLEAN MODE)"}
+	args := []any{filter.Match, filter.Match}
+
+	if filter.TaskId != 0 {
+		where = append(where, "d.task_id = ?")
+		args = append(args, filter.TaskId)
+	}
+	if len(filter.Kinds) > 0 {
+		where = append(where, "d.kind IN (?"+strings.Repeat(", ?", len(filter.Kinds)-1)+")")
+		for _, kind := range filter.Kinds {
+			args = append(args, kind)
+		}
+	}
+	if len(filter.Statuses) > 0 {
+		where = append(where, "t.task_status IN (?"+strings.Repeat(", ?", len(filter.Statuses)-1)+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "t.date_created >= ?")
+		args = append(args, formatDateTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "t.date_created < ?")
+		args = append(args, formatDateTime(filter.To))
+	}
+
+	query := "SELECT d.task_id, d.kind, d.body, d.date_updated, t.task_status, t.date_created, MATCH(d.body) AGAINST (? IN BOOLEAN MODE) AS score " +
+		"FROM logging.search_documents d JOIN logging.tasks t ON t.id = d.task_id " +
+		"WHERE " + strings.Join(where, " AND ") + " ORDER BY score DESC, d.task_id DESC, d.kind"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute query: %w", op, err)
+	}
+	defer rows.Close()
+
+	hits := []rabbitmodels.SearchHit{}
+	for rows.Next() {
+		var hit rabbitmodels.SearchHit
+		var status, dateUpdated, dateCreated sql.NullString
+
+		if err := rows.Scan(&hit.TaskId, &hit.Kind, &hit.Body, &dateUpdated, &status, &dateCreated, &hit.Score); err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		hit.Status = status.String
+		hit.UpdatedAt = parseDateTime(dateUpdated)
+		if dateCreated.Valid {
+			createdAt := parseDateTime(dateCreated)
+			hit.CreatedAt = &createdAt
+		}
+
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	return hits, nil
+}
@@ -1 +1,14 @@
 package storage
+
+import "errors"
+
+var (
+	ErrTrackFinished    = errors.New("track is already finished")
+	ErrTaskNotFound     = errors.New("task not found")
+	ErrRevisionNotFound = errors.New("protocol revision not found")
+	ErrRevisionConflict = errors.New("protocol revision is not current")
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadConflict   = errors.New("upload was changed concurrently")
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS logging.uploads (
+    id VARCHAR(32) NOT NULL PRIMARY KEY,
+    task_id INT UNSIGNED NOT NULL,
+    source VARCHAR(32) NOT NULL,
+    filename VARCHAR(255),
+    content_type VARCHAR(127),
+    length BIGINT UNSIGNED NOT NULL,
+    received BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    state VARCHAR(16) NOT NULL,
+    date_created DATETIME,
+    date_updated DATETIME,
+    KEY idx_uploads_task (task_id),
+    KEY idx_uploads_updated (state, date_updated)
+);
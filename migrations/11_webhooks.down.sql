@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS logging.webhook_deliveries;
+DROP TABLE IF EXISTS logging.webhooks;
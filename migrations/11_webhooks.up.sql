@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS logging.webhooks (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    task_id INT UNSIGNED NOT NULL DEFAULT 0,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    events VARCHAR(255) NOT NULL DEFAULT '',
+    date_created DATETIME,
+    KEY idx_webhooks_task (task_id)
+);
+
+CREATE TABLE IF NOT EXISTS logging.webhook_deliveries (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    webhook_id BIGINT UNSIGNED NOT NULL,
+    task_id INT UNSIGNED NOT NULL,
+    event VARCHAR(32) NOT NULL,
+    payload MEDIUMTEXT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    response_status INT,
+    last_error VARCHAR(1000),
+    redelivery_of BIGINT UNSIGNED,
+    next_attempt DATETIME,
+    date_created DATETIME,
+    date_updated DATETIME,
+    KEY idx_webhook_deliveries_webhook (webhook_id, id),
+    KEY idx_webhook_deliveries_due (state, next_attempt)
+);
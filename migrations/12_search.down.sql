@@ -0,0 +1 @@
+DROP TABLE IF EXISTS logging.search_documents;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS logging.search_documents (
+    task_id INT UNSIGNED NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    body MEDIUMTEXT NOT NULL,
+    date_updated DATETIME,
+    PRIMARY KEY (task_id, kind),
+    FULLTEXT KEY ft_search_documents_body (body)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS logging.transcript_segments;
+
+ALTER TABLE logging.tasks DROP COLUMN language;
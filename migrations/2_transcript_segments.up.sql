@@ -0,0 +1,16 @@
+ALTER TABLE logging.tasks ADD COLUMN language VARCHAR(16);
+
+CREATE TABLE IF NOT EXISTS logging.transcript_segments (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    task_id INT UNSIGNED NOT NULL,
+    segment_index INT UNSIGNED NOT NULL,
+    start_time DOUBLE NOT NULL,
+    end_time DOUBLE NOT NULL,
+    speaker VARCHAR(64),
+    text TEXT,
+    confidence FLOAT,
+    words JSON,
+    UNIQUE KEY uq_transcript_segments_task_index (task_id, segment_index),
+    KEY idx_transcript_segments_task_time (task_id, start_time),
+    KEY idx_transcript_segments_speaker (task_id, speaker)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS logging.task_jobs (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    task_id INT UNSIGNED NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    payload JSON NOT NULL,
+    state VARCHAR(16) NOT NULL DEFAULT 'pending',
+    lease_id VARCHAR(64),
+    worker_id VARCHAR(128),
+    lease_expires_at DATETIME,
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    date_created DATETIME,
+    KEY idx_task_jobs_pool (kind, state, lease_expires_at),
+    KEY idx_task_jobs_task (task_id, kind)
+);
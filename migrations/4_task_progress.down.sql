@@ -0,0 +1 @@
+DROP TABLE IF EXISTS logging.task_progress;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS logging.task_progress (
+    task_id INT UNSIGNED NOT NULL PRIMARY KEY,
+    percent FLOAT NOT NULL,
+    eta_seconds INT,
+    stage VARCHAR(64),
+    message VARCHAR(1000),
+    date_updated DATETIME
+);
@@ -0,0 +1 @@
+ALTER TABLE logging.tasks DROP COLUMN metadata;
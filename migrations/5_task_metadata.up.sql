@@ -0,0 +1 @@
+ALTER TABLE logging.tasks ADD COLUMN metadata JSON;
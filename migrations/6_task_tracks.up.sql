@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS logging.task_tracks (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    task_id INT UNSIGNED NOT NULL,
+    source VARCHAR(32) NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    link VARCHAR(1000),
+    content_type VARCHAR(128),
+    metadata JSON,
+    date_created DATETIME,
+    UNIQUE KEY task_source (task_id, source)
+);
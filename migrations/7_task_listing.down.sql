@@ -0,0 +1,5 @@
+ALTER TABLE logging.protocols DROP KEY idx_protocols_task;
+ALTER TABLE logging.task_tracks DROP KEY idx_task_tracks_source;
+ALTER TABLE logging.tasks DROP KEY idx_tasks_created;
+ALTER TABLE logging.tasks DROP KEY idx_tasks_status;
+ALTER TABLE logging.tasks DROP COLUMN date_created;
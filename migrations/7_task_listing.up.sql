@@ -0,0 +1,5 @@
+ALTER TABLE logging.tasks ADD COLUMN date_created DATETIME;
+ALTER TABLE logging.tasks ADD KEY idx_tasks_status (task_status, id);
+ALTER TABLE logging.tasks ADD KEY idx_tasks_created (date_created, id);
+ALTER TABLE logging.task_tracks ADD KEY idx_task_tracks_source (source, task_id);
+ALTER TABLE logging.protocols ADD KEY idx_protocols_task (task_id);
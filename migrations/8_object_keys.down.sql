@@ -0,0 +1,3 @@
+ALTER TABLE logging.audio_file DROP COLUMN bucket, DROP COLUMN object_key;
+ALTER TABLE logging.task_tracks DROP COLUMN bucket, DROP COLUMN object_key;
+ALTER TABLE logging.protocols DROP COLUMN short_bucket, DROP COLUMN short_key, DROP COLUMN full_bucket, DROP COLUMN full_key;
@@ -0,0 +1,10 @@
+ALTER TABLE logging.audio_file ADD COLUMN bucket VARCHAR(63), ADD COLUMN object_key VARCHAR(1000);
+ALTER TABLE logging.task_tracks ADD COLUMN bucket VARCHAR(63), ADD COLUMN object_key VARCHAR(1000);
+ALTER TABLE logging.protocols
+    ADD COLUMN short_bucket VARCHAR(63), ADD COLUMN short_key VARCHAR(1000),
+    ADD COLUMN full_bucket VARCHAR(63), ADD COLUMN full_key VARCHAR(1000);
+
+-- ключи из старых presigned-ссылок заполняет приложение при старте
+-- (mysql.BackfillObjectKeys): ключ в ссылке экранирован, SQL его не раскодирует.
+-- link, text_short и text_full остаются, пока заполнение не проверено:
+-- SELECT COUNT(*) FROM logging.audio_file WHERE link IS NOT NULL AND object_key IS NULL;
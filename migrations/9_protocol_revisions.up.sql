@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS logging.protocol_revisions (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    task_id INT UNSIGNED NOT NULL,
+    revision INT UNSIGNED NOT NULL,
+    source VARCHAR(16) NOT NULL,
+    author VARCHAR(128),
+    reverted_from INT UNSIGNED,
+    bucket VARCHAR(63),
+    object_key VARCHAR(1000),
+    date_created DATETIME,
+    UNIQUE KEY uq_protocol_revisions_task (task_id, revision)
+);
+
+-- протоколы существующих задач становятся ревизией 1 при старте приложения
+-- (mysql.SeedLegacyRevisions): ключи старых протоколов заполняет
+-- mysql.BackfillObjectKeys, до него short_key пуст.